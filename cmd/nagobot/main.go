@@ -8,6 +8,10 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -21,8 +25,10 @@ import (
 	"github.com/joebot/nagobot/internal/llm"
 	"github.com/joebot/nagobot/internal/logging"
 	"github.com/joebot/nagobot/internal/mcp"
+	"github.com/joebot/nagobot/internal/session"
 	"github.com/joebot/nagobot/internal/stt"
 	"github.com/joebot/nagobot/internal/tool"
+	"github.com/joebot/nagobot/internal/usage"
 )
 
 func init() {
@@ -46,6 +52,10 @@ func main() {
 		cmdGateway()
 	case "status":
 		cmdStatus()
+	case "usage":
+		cmdUsage()
+	case "subagents":
+		cmdSubagents()
 	case "onboard":
 		cli.RunOnboard()
 	case "version", "--version", "-v":
@@ -72,6 +82,8 @@ func printUsage() {
 	fmt.Printf("    nagobot %-14s %s\n", "agent -m \"…\"", dim("Single message"))
 	fmt.Printf("    nagobot %-14s %s\n", "gateway", dim("Start channel gateway"))
 	fmt.Printf("    nagobot %-14s %s\n", "status", dim("Show configuration"))
+	fmt.Printf("    nagobot %-14s %s\n", "usage [period]", dim("Token usage by day, week or month"))
+	fmt.Printf("    nagobot %-14s %s\n", "subagents [id]", dim("Subagent runs, or one run in detail"))
 	fmt.Printf("    nagobot %-14s %s\n", "onboard", dim("Initialize setup"))
 	fmt.Printf("    nagobot %-14s %s\n", "version", dim("Show version"))
 	fmt.Println()
@@ -81,37 +93,39 @@ func printUsage() {
 
 func cmdAgent() {
 	cfg := mustLoadConfig()
-	provider := mustMakeProvider(cfg)
+	ledger := newLedger(cfg)
+	provider := usage.Meter(mustMakeProvider(cfg), ledger)
 	redirectLogs()
 
 	msgBus := bus.NewMessageBus()
-	loop := agent.NewLoop(agent.LoopConfig{
-		Bus:                 msgBus,
-		Provider:            provider,
-		Workspace:           cfg.WorkspacePath(),
-		Model:               cfg.Agents.Defaults.Model,
-		MaxIterations:       cfg.Agents.Defaults.MaxToolIterations,
-		MemoryWindow:        cfg.Agents.Defaults.MemoryWindow,
-		ContextLimit:        cfg.Agents.Defaults.ContextLimit,
-		ExecTimeout:         cfg.Tools.Exec.Timeout,
-		RestrictToWorkspace: cfg.Tools.RestrictToWorkspace,
-		BraveAPIKey:         cfg.Tools.Web.Search.APIKey,
-	})
+	router := newRouter(cfg, msgBus, provider, ledger)
 
-	// Initialize MCP servers.
-	mcpMgr := initMCP(cfg, loop)
-	if mcpMgr != nil {
-		defer mcpMgr.Close()
-	}
-
-	// Check for -m flag
+	// Check for -m and --profile flags
 	message := ""
+	profile := ""
 	for i := 2; i < len(os.Args); i++ {
-		if (os.Args[i] == "-m" || os.Args[i] == "--message") && i+1 < len(os.Args) {
+		switch {
+		case (os.Args[i] == "-m" || os.Args[i] == "--message") && i+1 < len(os.Args):
 			message = os.Args[i+1]
-			break
+			i++
+		case (os.Args[i] == "-p" || os.Args[i] == "--profile") && i+1 < len(os.Args):
+			profile = os.Args[i+1]
+			i++
 		}
 	}
+	if profile == "" {
+		profile, _ = router.Match(agent.RouteKey{Channel: "cli"})
+	} else if _, ok := cfg.Profile(profile); !ok {
+		fmt.Println(cli.ErrStyle.Render("  Unknown agent profile: " + profile))
+		os.Exit(1)
+	}
+	loop := router.Loop(profile)
+
+	// Initialize MCP servers.
+	mcpMgr := initMCP(cfg, loop)
+	if mcpMgr != nil {
+		defer mcpMgr.Close()
+	}
 
 	ctx := context.Background()
 
@@ -120,9 +134,10 @@ func cmdAgent() {
 			os.Exit(1)
 		}
 	} else {
+		p, _ := cfg.Profile(loop.Name())
 		if err := cli.RunChat(loop, ctx, cli.ChatConfig{
-			Model:     cfg.Agents.Defaults.Model,
-			Workspace: cfg.WorkspacePath(),
+			Model:     p.Model,
+			Workspace: p.Workspace,
 		}); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 			os.Exit(1)
@@ -134,21 +149,12 @@ func cmdAgent() {
 
 func cmdGateway() {
 	cfg := mustLoadConfig()
-	provider := mustMakeProvider(cfg)
+	ledger := newLedger(cfg)
+	provider := usage.Meter(mustMakeProvider(cfg), ledger)
 
 	msgBus := bus.NewMessageBus()
-	loop := agent.NewLoop(agent.LoopConfig{
-		Bus:                 msgBus,
-		Provider:            provider,
-		Workspace:           cfg.WorkspacePath(),
-		Model:               cfg.Agents.Defaults.Model,
-		MaxIterations:       cfg.Agents.Defaults.MaxToolIterations,
-		MemoryWindow:        cfg.Agents.Defaults.MemoryWindow,
-		ContextLimit:        cfg.Agents.Defaults.ContextLimit,
-		ExecTimeout:         cfg.Tools.Exec.Timeout,
-		RestrictToWorkspace: cfg.Tools.RestrictToWorkspace,
-		BraveAPIKey:         cfg.Tools.Web.Search.APIKey,
-	})
+	router := newRouter(cfg, msgBus, provider, ledger)
+	defaultLoop := router.Loop(agent.DefaultProfile)
 
 	fmt.Println()
 	fmt.Println(cli.TitleStyle.Render(fmt.Sprintf("  %s nagobot Gateway", cli.Logo)))
@@ -157,8 +163,12 @@ func cmdGateway() {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
+	if names := cfg.ProfileNames(); len(names) > 1 {
+		fmt.Printf("  "+cli.OkStyle.Render("✓")+" Agents (%s, %d routes)\n", strings.Join(names, ", "), len(cfg.Agents.Routes))
+	}
+
 	// Initialize MCP servers.
-	mcpMgr := initMCP(cfg, loop)
+	mcpMgr := initMCP(cfg, router.Loops()...)
 	if mcpMgr != nil {
 		defer mcpMgr.Close()
 		fmt.Printf("  "+cli.OkStyle.Render("✓")+" MCP (%d tools from %v)\n", mcpMgr.ToolCount(), mcpMgr.ServerNames())
@@ -173,7 +183,13 @@ func cmdGateway() {
 			if job.Payload.Deliver && job.Payload.Channel != "" && job.Payload.To != "" {
 				sessionKey = job.Payload.Channel + ":" + job.Payload.To
 			}
-			resp, err := loop.ProcessDirect(ctx, job.Payload.Message, sessionKey)
+			// A cron route picks the agent; otherwise the job runs on the
+			// agent serving the chat it delivers to.
+			profile, ok := router.Match(agent.RouteKey{Channel: "cron", ChatID: job.ID})
+			if !ok && sessionKey != "" {
+				profile, _ = router.Match(agent.RouteKey{Channel: job.Payload.Channel, ChatID: job.Payload.To})
+			}
+			resp, err := router.Loop(profile).ProcessDirect(usage.WithPurpose(ctx, usage.PurposeCron), job.Payload.Message, sessionKey)
 			if err != nil {
 				return "", err
 			}
@@ -186,7 +202,10 @@ func cmdGateway() {
 			}
 			return resp, nil
 		})
-		loop.ToolRegistry().Register(tool.NewCronTool(cronSvc))
+		cronTool := tool.NewCronTool(cronSvc)
+		for _, l := range router.Loops() {
+			l.ToolRegistry().Register(cronTool)
+		}
 		fmt.Printf("  "+cli.OkStyle.Render("✓")+" Cron (%d jobs)\n", cronSvc.JobCount())
 	}
 
@@ -198,7 +217,7 @@ func cmdGateway() {
 			transcriber = stt.NewGoogleSTT(cfg.Services.GoogleSTT.APIKey, cfg.Services.GoogleSTT.LanguageCode)
 			fmt.Println("  " + cli.OkStyle.Render("✓") + " Google STT")
 		}
-		discord = channel.NewDiscord(cfg.Channels.Discord, msgBus, loop.Commands(), transcriber)
+		discord = channel.NewDiscord(cfg.Channels.Discord, msgBus, defaultLoop.Commands(), transcriber)
 		msgBus.Subscribe("discord", func(ctx context.Context, msg *bus.OutboundMessage) error {
 			return discord.Send(ctx, msg)
 		})
@@ -211,7 +230,7 @@ func cmdGateway() {
 
 	// Start components
 	go msgBus.DispatchOutbound(ctx)
-	go loop.Run(ctx)
+	go router.Run(ctx)
 
 	if discord != nil {
 		go func() {
@@ -228,8 +247,10 @@ func cmdGateway() {
 	// Start heartbeat service if enabled
 	if cfg.Services.Heartbeat.Enabled {
 		interval := time.Duration(cfg.Services.Heartbeat.IntervalS) * time.Second
-		hb := heartbeat.NewService(cfg.WorkspacePath(), interval, func(ctx context.Context, prompt, sessionKey string) (string, error) {
-			return loop.ProcessDirect(ctx, prompt, sessionKey)
+		profile, _ := router.Match(agent.RouteKey{Channel: "heartbeat"})
+		loop := router.Loop(profile)
+		hb := heartbeat.NewService(loop.Workspace(), interval, func(ctx context.Context, prompt, sessionKey string) (string, error) {
+			return loop.ProcessDirect(usage.WithPurpose(ctx, usage.PurposeHeartbeat), prompt, sessionKey)
 		})
 		go hb.Run(ctx)
 		fmt.Println("  " + cli.OkStyle.Render("✓") + " Heartbeat" + cli.DimStyle.Render(fmt.Sprintf(" (every %s)", interval)))
@@ -243,9 +264,10 @@ func cmdGateway() {
 	}
 }
 
-// initMCP connects to configured MCP servers and registers their tools.
+// initMCP connects to configured MCP servers and registers their tools
+// with each loop, limited to the servers its profile enables.
 // Returns nil if no servers are configured.
-func initMCP(cfg *config.Config, loop *agent.Loop) *mcp.Manager {
+func initMCP(cfg *config.Config, loops ...*agent.Loop) *mcp.Manager {
 	if len(cfg.MCP.Servers) == 0 {
 		return nil
 	}
@@ -254,7 +276,10 @@ func initMCP(cfg *config.Config, loop *agent.Loop) *mcp.Manager {
 		slog.Error("MCP initialization failed", "err", err)
 		return nil
 	}
-	mgr.RegisterTools(loop.ToolRegistry())
+	for _, l := range loops {
+		p, _ := cfg.Profile(l.Name())
+		mgr.RegisterTools(l.ToolRegistry(), p.MCPServers...)
+	}
 	return mgr
 }
 
@@ -268,8 +293,109 @@ func cmdStatus() {
 	cli.RunStatus(cfg)
 }
 
+// --- usage command ---
+
+// cmdUsage prints token usage: nagobot usage [day|week|month] [-n count].
+func cmdUsage() {
+	cfg := mustLoadConfig()
+	period := usage.PeriodDay
+	n := 0
+	for i := 2; i < len(os.Args); i++ {
+		switch arg := os.Args[i]; {
+		case (arg == "-n" || arg == "--count") && i+1 < len(os.Args):
+			n, _ = strconv.Atoi(os.Args[i+1])
+			i++
+		default:
+			period = arg
+		}
+	}
+	if err := cli.RunUsage(newLedger(cfg), period, n); err != nil {
+		fmt.Println(cli.ErrStyle.Render("  Error: " + err.Error()))
+		os.Exit(1)
+	}
+}
+
+// --- subagents command ---
+
+// cmdSubagents prints the history of subagent runs: nagobot subagents
+// [id] [-n count].
+func cmdSubagents() {
+	id := ""
+	n := 20
+	for i := 2; i < len(os.Args); i++ {
+		switch arg := os.Args[i]; {
+		case (arg == "-n" || arg == "--count") && i+1 < len(os.Args):
+			n, _ = strconv.Atoi(os.Args[i+1])
+			i++
+		default:
+			id = arg
+		}
+	}
+	if err := cli.RunSubagents(filepath.Join(config.DataDir(), "subagents"), id, n); err != nil {
+		fmt.Println(cli.ErrStyle.Render("  Error: " + err.Error()))
+		os.Exit(1)
+	}
+}
+
 // --- helpers ---
 
+// newLedger opens the usage ledger at ~/.nagobot/usage.jsonl with the
+// configured price table.
+func newLedger(cfg *config.Config) *usage.Ledger {
+	prices := make(map[string]usage.Price, len(cfg.Usage.Prices))
+	for model, p := range cfg.Usage.Prices {
+		prices[model] = usage.Price{Input: p.Input, Output: p.Output, CacheRead: p.CacheRead, CacheWrite: p.CacheWrite}
+	}
+	return usage.NewLedger(filepath.Join(config.DataDir(), "usage.jsonl"), prices)
+}
+
+// newApprovals builds the tool approval policy, auditing decisions to
+// ~/.nagobot/approvals.jsonl. It returns nil when no rules are configured.
+func newApprovals(cfg *config.Config) *tool.ApprovalPolicy {
+	ac := cfg.Tools.Approval
+	if len(ac.Rules) == 0 {
+		return nil
+	}
+	rules := make([]tool.ApprovalRule, len(ac.Rules))
+	for i, r := range ac.Rules {
+		rules[i] = tool.ApprovalRule{Tool: r.Tool, Param: r.Param, Reason: r.Reason}
+		if r.Match != "" {
+			rules[i].Match = regexp.MustCompile(r.Match) // checked by Validate
+		}
+	}
+	timeout := time.Duration(ac.TimeoutSeconds) * time.Second
+	return tool.NewApprovalPolicy(rules, timeout, filepath.Join(config.DataDir(), "approvals.jsonl"))
+}
+
+// newBudgets builds the spending limits. Daily spend is kept in
+// ~/.nagobot/budgets.json, fed by the ledger.
+func newBudgets(cfg *config.Config, ledger *usage.Ledger) *agent.Budgets {
+	bc := cfg.Usage.Budgets
+	tracker := usage.NewTracker(filepath.Join(config.DataDir(), "budgets.json"))
+	ledger.Track(tracker)
+	channels := make(map[string]usage.Limits, len(bc.Channels))
+	for ch, l := range bc.Channels {
+		channels[ch] = budgetLimits(l)
+	}
+	return &agent.Budgets{
+		Turn:     budgetLimits(bc.Turn),
+		Session:  budgetLimits(bc.Session),
+		Channels: channels,
+		WarnAt:   bc.WarnAt,
+		Tracker:  tracker,
+	}
+}
+
+func budgetLimits(l config.BudgetLimits) usage.Limits {
+	return usage.Limits{
+		Tokens:    l.Tokens,
+		Cost:      l.Cost,
+		Time:      time.Duration(l.Seconds) * time.Second,
+		ToolCalls: l.ToolCalls,
+		Tools:     l.Tools,
+	}
+}
+
 func redirectLogs() {
 	logPath := filepath.Join(config.DataDir(), "agent.log")
 	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
@@ -292,6 +418,28 @@ func mustLoadConfig() *config.Config {
 }
 
 func mustMakeProvider(cfg *config.Config) llm.Provider {
+	if chain := cfg.Providers.Failover.Chain; len(chain) > 0 {
+		targets := make([]llm.RouterTarget, 0, len(chain))
+		for i, t := range chain {
+			model := t.Model
+			if i == 0 && model == "" {
+				model = cfg.Agents.Defaults.Model
+			}
+			name := strings.ToLower(t.Provider)
+			p := cfg.ProviderByName(name)
+			targets = append(targets, llm.RouterTarget{
+				Name:     name,
+				Provider: makeProvider(name, p, model),
+				Model:    model,
+			})
+		}
+		fo := cfg.Providers.Failover
+		return llm.NewRouter(targets, llm.RouterOptions{
+			FailureThreshold: fo.FailureThreshold,
+			Cooldown:         time.Duration(fo.CooldownSeconds) * time.Second,
+		})
+	}
+
 	match := cfg.GetProvider()
 	if match == nil || match.Config.APIKey == "" {
 		fmt.Println()
@@ -301,13 +449,133 @@ func mustMakeProvider(cfg *config.Config) llm.Provider {
 		os.Exit(1)
 	}
 
-	p := match.Config
-	model := cfg.Agents.Defaults.Model
+	return makeProvider(match.Name, match.Config, cfg.Agents.Defaults.Model)
+}
+
+// newRouter creates a loop for every agent profile, sharing one session
+// store, and a router that dispatches messages to them.
+func newRouter(cfg *config.Config, msgBus *bus.MessageBus, provider llm.Provider, ledger *usage.Ledger) *agent.Router {
+	sessions := session.NewManager()
+	approvals := newApprovals(cfg)
+	budgets := newBudgets(cfg, ledger)
+	var loops []*agent.Loop
+	for _, name := range cfg.ProfileNames() {
+		p, _ := cfg.Profile(name)
+		main := modelRole(cfg, &config.ModelRole{Provider: p.Provider, Model: p.Model}, ledger)
+		if main.Provider == nil {
+			main.Provider = provider
+		}
+		loop := agent.NewLoop(agent.LoopConfig{
+			Name:                name,
+			Sessions:            sessions,
+			Bus:                 msgBus,
+			Provider:            main.Provider,
+			Workspace:           p.Workspace,
+			Model:               p.Model,
+			MaxTokens:           p.MaxTokens,
+			Temperature:         p.Temperature,
+			Utility:             modelRole(cfg, p.Utility, ledger),
+			Subagent:            modelRole(cfg, p.Subagent, ledger),
+			MaxIterations:       p.MaxToolIterations,
+			MaxConcurrent:       cfg.Agents.Defaults.MaxConcurrentSessions,
+			FollowUp:            agent.FollowUpPolicy(cfg.Agents.Defaults.FollowUp),
+			ChannelFollowUp:     channelFollowUp(cfg),
+			MemoryWindow:        p.MemoryWindow,
+			ContextLimit:        p.ContextLimit,
+			ToolHistory:         session.ToolDetail(p.ToolHistory),
+			ToolResultChars:     p.ToolResultChars,
+			ExecTimeout:         cfg.Tools.Exec.Timeout,
+			RestrictToWorkspace: cfg.Tools.RestrictToWorkspace,
+			BraveAPIKey:         cfg.Tools.Web.Search.APIKey,
+			Usage:               ledger,
+			ThinkingBudget:      p.ThinkingBudget,
+			ReasoningEffort:     p.ReasoningEffort,
+			Tools:               p.Tools,
+			Skills:              p.Skills,
+			Approvals:           approvals,
+			Budgets:             budgets,
+			Spawn:               spawnPolicy(cfg, p.Spawn, ledger),
+			SubagentsDir:        filepath.Join(config.DataDir(), "subagents"),
+		})
+		addCommandHooks(loop, cfg.Hooks)
+		loops = append(loops, loop)
+	}
+
+	routes := make([]agent.Route, len(cfg.Agents.Routes))
+	for i, r := range cfg.Agents.Routes {
+		routes[i] = agent.Route{Profile: r.Profile, Channel: r.Channel, Guild: r.Guild, ChatID: r.ChatID, Sender: r.Sender}
+	}
+	return agent.NewRouter(msgBus, routes, loops...)
+}
+
+// addCommandHooks registers the configured external command hooks that
+// apply to the loop's profile.
+func addCommandHooks(loop *agent.Loop, hooks []config.HookConfig) {
+	for _, h := range hooks {
+		if len(h.Profiles) > 0 && !slices.Contains(h.Profiles, loop.Name()) {
+			continue
+		}
+		loop.AddHooks(agent.CommandHook{
+			Event:   h.Event,
+			Command: h.Command,
+			Args:    h.Args,
+			Env:     h.Env,
+			Tool:    h.Tool,
+			Timeout: time.Duration(h.TimeoutSeconds) * time.Second,
+		}.Hooks())
+	}
+}
+
+// channelFollowUp collects the channels' follow-up policy overrides.
+func channelFollowUp(cfg *config.Config) map[string]agent.FollowUpPolicy {
+	return map[string]agent.FollowUpPolicy{
+		"discord": agent.FollowUpPolicy(cfg.Channels.Discord.FollowUp),
+	}
+}
+
+// modelRole converts a configured model role. A role naming its own
+// provider gets a separate, metered client; otherwise the loop shares the
+// main provider.
+func modelRole(cfg *config.Config, r *config.ModelRole, ledger *usage.Ledger) agent.ModelRole {
+	if r == nil {
+		return agent.ModelRole{}
+	}
+	role := agent.ModelRole{Model: r.Model, MaxTokens: r.MaxTokens, Temperature: r.Temperature}
+	if r.Provider != "" {
+		role.Provider = usage.Meter(makeProvider(r.Provider, cfg.ProviderByName(r.Provider), r.Model), ledger)
+	}
+	return role
+}
+
+// spawnPolicy converts the spawn limits of a profile.
+func spawnPolicy(cfg *config.Config, s *config.SpawnConfig, ledger *usage.Ledger) agent.SpawnPolicy {
+	if s == nil {
+		return agent.SpawnPolicy{}
+	}
+	policy := agent.SpawnPolicy{
+		Profiles:      s.Profiles,
+		Models:        make(map[string]agent.ModelRole, len(s.Models)),
+		MaxIterations: s.MaxIterations,
+		Timeout:       time.Duration(s.TimeoutSeconds) * time.Second,
+		MaxGroupSize:  s.MaxGroupSize,
+		GroupTimeout:  time.Duration(s.GroupTimeoutSeconds) * time.Second,
+	}
+	for name, r := range s.Models {
+		policy.Models[name] = modelRole(cfg, &r, ledger)
+	}
+	return policy
+}
 
-	switch match.Name {
+// makeProvider creates the LLM client for a named provider. Names are
+// matched without regard to case, like config.ProviderByName.
+func makeProvider(name string, p *config.ProviderConfig, model string) llm.Provider {
+	name = strings.ToLower(name)
+	switch name {
 	case "anthropic":
 		return llm.NewAnthropicProvider(p.APIKey, p.APIBase, model, p.ExtraHeaders)
+	case "gemini":
+		return llm.NewGeminiProvider(p.APIKey, p.APIBase, model, p.ExtraHeaders)
 	default:
-		return llm.NewOpenAIProvider(p.APIKey, p.APIBase, model, p.ExtraHeaders)
+		return llm.NewOpenAIProvider(name, p.APIKey, p.APIBase, model, p.ExtraHeaders)
 	}
 }
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/joebot/nagobot/internal/config"
+	"github.com/joebot/nagobot/internal/llm"
+)
+
+func TestFailoverChainProviderNamesIgnoreCase(t *testing.T) {
+	var gotPath, gotKey string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotKey = r.URL.Path, r.Header.Get("x-api-key")
+		w.Write([]byte(`{"content": [{"type": "text", "text": "hi"}], "stop_reason": "end_turn", "usage": {"input_tokens": 3, "output_tokens": 1}}`))
+	}))
+	defer srv.Close()
+
+	cfg := &config.Config{}
+	cfg.Providers.Anthropic = config.ProviderConfig{APIKey: "akey", APIBase: srv.URL}
+	cfg.Providers.Failover.Chain = []config.FailoverTarget{{Provider: "Anthropic", Model: "claude-sonnet-4-5"}}
+
+	resp, err := mustMakeProvider(cfg).Chat(context.Background(), llm.ChatRequest{
+		Messages: []map[string]any{{"role": "user", "content": "hello"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotPath != "/v1/messages" || gotKey != "akey" || resp.Content != "hi" {
+		t.Errorf("request to %q with key %q, reply %q; want the Anthropic API", gotPath, gotKey, resp.Content)
+	}
+}
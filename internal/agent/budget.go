@@ -0,0 +1,160 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/joebot/nagobot/internal/usage"
+)
+
+// Budgets are the spending limits a loop enforces. Daily limits are
+// checked against the Tracker, which the usage ledger feeds with the
+// tokens and cost of every LLM call; without one they are not enforced.
+type Budgets struct {
+	Turn     usage.Limits            // each turn
+	Session  usage.Limits            // each session per day
+	Channels map[string]usage.Limits // each channel per day
+	WarnAt   float64                 // share of a limit that adds a notice to the reply; default 0.8
+	Tracker  *usage.Tracker
+}
+
+// today returns what session and channel have spent today.
+func (b *Budgets) today(session, channel string) (usage.Spend, usage.Spend) {
+	if b.Tracker == nil {
+		return usage.Spend{}, usage.Spend{}
+	}
+	return b.Tracker.Today(session, channel)
+}
+
+// dailyExceeded describes the daily limit of session or channel that
+// sess or ch has used up, or returns "".
+func (b *Budgets) dailyExceeded(channel string, sess, ch usage.Spend) string {
+	if r := b.Session.Exceeded(sess); r != "" {
+		return "this conversation's daily budget is used up (" + r + ")"
+	}
+	if r := b.Channels[channel].Exceeded(ch); r != "" {
+		return fmt.Sprintf("the daily budget of the %s channel is used up (%s)", channel, r)
+	}
+	return ""
+}
+
+// dailyToolExceeded describes the daily limit of session or channel that
+// another call of the named tool would go over, or returns "".
+func (b *Budgets) dailyToolExceeded(channel, name string, sess, ch usage.Spend) string {
+	if r := b.Session.ToolExceeded(sess, name); r != "" {
+		return "this conversation's daily budget allows no more (" + r + ")"
+	}
+	if r := b.Channels[channel].ToolExceeded(ch, name); r != "" {
+		return fmt.Sprintf("the daily budget of the %s channel allows no more (%s)", channel, r)
+	}
+	return ""
+}
+
+// useTool records a tool call against the daily budgets.
+func (b *Budgets) useTool(session, channel, name string) {
+	if b.Tracker != nil {
+		b.Tracker.Add(session, channel, usage.Spend{ToolCalls: 1, Tools: map[string]int{name: 1}})
+	}
+}
+
+// status describes the remaining budget of a session and its channel, one
+// line per limited budget.
+func (b *Budgets) status(session, channel string) string {
+	sess, ch := b.today(session, channel)
+	var lines []string
+	if r := b.Turn.Remaining(usage.Spend{}); r != "" {
+		lines = append(lines, "Budget per turn: "+r)
+	}
+	if r := b.Session.Remaining(sess); r != "" {
+		lines = append(lines, "Budget today, this conversation: "+r)
+	}
+	if r := b.Channels[channel].Remaining(ch); r != "" {
+		lines = append(lines, fmt.Sprintf("Budget today, %s channel: %s", channel, r))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// turnBudget tracks one turn against the budgets.
+type turnBudget struct {
+	b                *Budgets
+	session, channel string
+	start            time.Time
+	llm              *usage.Counter // tokens and cost of the turn's LLM calls
+	tools            usage.Spend    // the turn's tool calls
+}
+
+// startTurn returns a context that counts the LLM calls made with it, and
+// the budget of a turn in session.
+func (b *Budgets) startTurn(ctx context.Context, session, channel string) (context.Context, *turnBudget) {
+	t := &turnBudget{b: b, session: session, channel: channel, start: time.Now(), llm: &usage.Counter{}}
+	return usage.WithCounter(ctx, t.llm), t
+}
+
+// spend returns what the turn has used so far, and what its session and
+// channel have used today including the turn.
+func (t *turnBudget) spend() (turn, sess, ch usage.Spend) {
+	elapsed := time.Since(t.start)
+	turn = t.llm.Spend()
+	turn.Add(t.tools)
+	turn.Time = elapsed
+	// The tracker has the turn's tokens and tool calls, but its time only
+	// once the turn finishes.
+	sess, ch = t.b.today(t.session, t.channel)
+	sess.Time += elapsed
+	ch.Time += elapsed
+	return turn, sess, ch
+}
+
+// exceeded describes the budget the turn has used up, or returns "".
+func (t *turnBudget) exceeded() string {
+	turn, sess, ch := t.spend()
+	if r := t.b.Turn.Exceeded(turn); r != "" {
+		return "this turn's budget is used up (" + r + ")"
+	}
+	return t.b.dailyExceeded(t.channel, sess, ch)
+}
+
+// toolExceeded describes the budget another call of the named tool would
+// go over, or returns "".
+func (t *turnBudget) toolExceeded(name string) string {
+	turn, sess, ch := t.spend()
+	if r := t.b.Turn.ToolExceeded(turn, name); r != "" {
+		return "this turn's budget allows no more (" + r + ")"
+	}
+	return t.b.dailyToolExceeded(t.channel, name, sess, ch)
+}
+
+// useTool records a tool call of the turn.
+func (t *turnBudget) useTool(name string) {
+	t.tools.Add(usage.Spend{ToolCalls: 1, Tools: map[string]int{name: 1}})
+	t.b.useTool(t.session, t.channel, name)
+}
+
+// warning returns a notice for the user when the turn brought a budget
+// close to its limit, or "".
+func (t *turnBudget) warning() string {
+	warnAt := t.b.WarnAt
+	if warnAt <= 0 {
+		warnAt = 0.8
+	}
+	turn, sess, ch := t.spend()
+	if r := t.b.Session.Near(sess, warnAt); r != "" {
+		return "Budget notice: this conversation has used " + r + " of its daily budget."
+	}
+	if r := t.b.Channels[t.channel].Near(ch, warnAt); r != "" {
+		return fmt.Sprintf("Budget notice: the %s channel has used %s of its daily budget.", t.channel, r)
+	}
+	if r := t.b.Turn.Near(turn, warnAt); r != "" {
+		return "Budget notice: this turn used " + r + " of its budget."
+	}
+	return ""
+}
+
+// finish records the turn's wall-clock time against the daily budgets.
+func (t *turnBudget) finish() {
+	if t.b.Tracker != nil {
+		t.b.Tracker.Add(t.session, t.channel, usage.Spend{Time: time.Since(t.start)})
+	}
+}
@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joebot/nagobot/internal/bus"
+	"github.com/joebot/nagobot/internal/llm"
+	"github.com/joebot/nagobot/internal/usage"
+)
+
+func TestBudgets(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tokens := map[string]int{"prompt_tokens": 400, "completion_tokens": 100}
+	provider := &scriptProvider{responses: []*llm.ChatResponse{
+		{Usage: tokens, ToolCalls: []llm.ToolCallRequest{
+			{ID: "c1", Name: "list_dir", Arguments: map[string]any{"path": "."}},
+			{ID: "c2", Name: "list_dir", Arguments: map[string]any{"path": ".."}},
+		}},
+		{Usage: tokens, Content: "first"},
+		{Usage: tokens, Content: "second"},
+		{Usage: tokens, Content: "third"},
+	}}
+	ledger := usage.NewLedger(filepath.Join(t.TempDir(), "usage.jsonl"), nil)
+	tracker := usage.NewTracker("")
+	ledger.Track(tracker)
+	loop := NewLoop(LoopConfig{
+		Bus:       bus.NewMessageBus(),
+		Provider:  usage.Meter(provider, ledger),
+		Workspace: t.TempDir(),
+		Budgets: &Budgets{
+			Turn:    usage.Limits{ToolCalls: 1},
+			Session: usage.Limits{Tokens: 1200},
+			Tracker: tracker,
+		},
+	})
+	ctx := context.Background()
+
+	reply, err := loop.ProcessDirect(ctx, "look around", "test:budget")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(reply, "first") || !strings.Contains(reply, "Budget notice") {
+		t.Errorf("first reply = %q, want a budget notice at 1000/1200 tokens", reply)
+	}
+	if results := toolResults(provider.requests[1]); len(results) != 2 || !strings.Contains(results[1], "allows no more") {
+		t.Errorf("tool results = %q, want the second call refused", results)
+	}
+
+	if reply, _ := loop.ProcessDirect(ctx, "again", "test:budget"); reply != "second" {
+		t.Errorf("second reply = %q", reply)
+	}
+	reply, _ = loop.ProcessDirect(ctx, "once more", "test:budget")
+	if !strings.Contains(reply, "daily budget is used up") {
+		t.Errorf("third reply = %q, want a refusal", reply)
+	}
+	if len(provider.requests) != 3 {
+		t.Errorf("model called %d times, want 3", len(provider.requests))
+	}
+
+	out, _ := loop.ProcessDirect(ctx, "/context", "test:budget")
+	if !strings.Contains(out, "Budget today, this conversation: tokens 0 of 1.2k left") {
+		t.Errorf("/context = %q", out)
+	}
+}
@@ -0,0 +1,302 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/joebot/nagobot/internal/bus"
+	"github.com/joebot/nagobot/internal/command"
+	"github.com/joebot/nagobot/internal/session"
+)
+
+// sessionRole returns the main model role, with the model switched by
+// /model for this conversation. A model that is no longer configured is
+// ignored.
+func (l *Loop) sessionRole(sess *session.Session) ModelRole {
+	role := l.main
+	if choice, ok := l.modelChoices()[sess.Model]; ok && sess.Model != "" {
+		role.Provider, role.Model = choice.Provider, choice.Model
+	}
+	return role
+}
+
+// modelChoices returns the models /model can switch to: those of the
+// agent's model roles and spawn models, each served by its own provider.
+func (l *Loop) modelChoices() map[string]ModelRole {
+	roles := []ModelRole{l.main, l.utility, l.subagents.role}
+	for _, name := range l.subagents.ModelNames() {
+		roles = append(roles, l.subagents.models[name])
+	}
+	choices := make(map[string]ModelRole, len(roles))
+	for _, r := range roles {
+		if _, ok := choices[r.Model]; !ok && r.Model != "" {
+			choices[r.Model] = r
+		}
+	}
+	return choices
+}
+
+func (l *Loop) handleModel(_ context.Context, sess *session.Session, msg *bus.InboundMessage, args command.Args) (*bus.OutboundMessage, error) {
+	choices := slices.Sorted(maps.Keys(l.modelChoices()))
+	var content string
+	switch name := args.String("name"); name {
+	case "":
+		content = fmt.Sprintf("Model: %s (agent default)", l.main.Model)
+		if sess.Model != "" {
+			content = fmt.Sprintf("Model: %s (set for this conversation; agent default %s)", sess.Model, l.main.Model)
+		}
+		content += "\nAvailable: " + strings.Join(choices, ", ")
+	case "default":
+		sess.Model = ""
+		l.sessions.Save(sess)
+		content = fmt.Sprintf("Model reset to %s.", l.main.Model)
+	default:
+		if !slices.Contains(choices, name) {
+			content = fmt.Sprintf("Unknown model %s. Available: %s", name, strings.Join(choices, ", "))
+			break
+		}
+		sess.Model = name
+		l.sessions.Save(sess)
+		content = fmt.Sprintf("Model switched to %s for this conversation.", name)
+	}
+	return &bus.OutboundMessage{
+		Channel: msg.Channel,
+		ChatID:  msg.ChatID,
+		Content: content,
+	}, nil
+}
+
+// lastExchange returns the index of the last user message in sess, which
+// starts the last exchange, or -1.
+func lastExchange(sess *session.Session) int {
+	for i := len(sess.Messages) - 1; i >= 0; i-- {
+		if sess.Messages[i].Role == "user" {
+			return i
+		}
+	}
+	return -1
+}
+
+func (l *Loop) handleRetry(ctx context.Context, sess *session.Session, msg *bus.InboundMessage, _ command.Args) (*bus.OutboundMessage, error) {
+	// An unfinished turn is the last exchange: start it over.
+	if cp := l.sessions.LoadCheckpoint(sess.Key); cp != nil {
+		l.sessions.DeleteCheckpoint(sess.Key)
+		retry := *msg
+		retry.Content = cp.Content
+		retry.Media = cp.Media
+		return l.turn(ctx, sess, &retry)
+	}
+
+	i := lastExchange(sess)
+	if i < 0 {
+		return &bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			Content: "Nothing to retry.",
+		}, nil
+	}
+
+	// Answer the last user message again in place of the old answer.
+	// Attachments were saved with it and are passed as local paths.
+	saved := sess.Messages
+	last := sess.Messages[i]
+	sess.Messages = sess.Messages[:i:i]
+	retry := *msg
+	retry.Content = last.Content
+	retry.Media = last.Media
+	resp, err := l.turn(ctx, sess, &retry)
+	if err != nil && len(sess.Messages) == i {
+		sess.Messages = saved // the turn failed before saving anything
+	}
+	return resp, err
+}
+
+func (l *Loop) handleUndo(_ context.Context, sess *session.Session, msg *bus.InboundMessage, _ command.Args) (*bus.OutboundMessage, error) {
+	content := "Nothing to undo."
+	if cp := l.sessions.LoadCheckpoint(sess.Key); cp != nil {
+		l.sessions.DeleteCheckpoint(sess.Key)
+		content = fmt.Sprintf("Removed the unfinished turn: %q", truncate(cp.Content, 80))
+	} else if i := lastExchange(sess); i >= 0 {
+		content = fmt.Sprintf("Removed the last exchange: %q", truncate(sess.Messages[i].Content, 80))
+		sess.Messages = sess.Messages[:i]
+		l.sessions.Save(sess)
+	}
+	return &bus.OutboundMessage{
+		Channel: msg.Channel,
+		ChatID:  msg.ChatID,
+		Content: content,
+	}, nil
+}
+
+// handleContinue resumes the checkpointed turn of the session, allowing it
+// the given number of further LLM calls.
+func (l *Loop) handleContinue(ctx context.Context, sess *session.Session, msg *bus.InboundMessage, args command.Args) (*bus.OutboundMessage, error) {
+	cp := l.sessions.LoadCheckpoint(sess.Key)
+	if cp == nil {
+		return &bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			Content: "Nothing to continue.",
+		}, nil
+	}
+	ctx, budget := l.budgets.startTurn(ctx, sess.Key, msg.Channel)
+	defer budget.finish()
+	if refusal := refuseOverBudget(sess, msg, budget); refusal != nil {
+		return refusal, nil
+	}
+
+	steps := args.Int("steps")
+	if steps <= 0 {
+		steps = l.maxIterations
+	}
+	slog.Info("Continuing turn", "session", sess.Key, "iterations", cp.Iterations, "steps", steps, "stopped", cp.Reason)
+	cp.Status, cp.Reason = session.CheckpointRunning, ""
+	cp.Limit = cp.Iterations + steps
+	restoreInlineMedia(cp)
+	return l.react(ctx, sess, msg, cp, budget)
+}
+
+// announceCheckpoints tells the chats whose turns were cut off by a restart
+// that they can continue them.
+func (l *Loop) announceCheckpoints() {
+	for _, cp := range l.sessions.Checkpoints() {
+		if cp.Agent != l.name || cp.Status != session.CheckpointRunning {
+			continue
+		}
+		slog.Info("Found turn cut off by restart", "session", cp.Key, "iterations", cp.Iterations)
+		cp.Status, cp.Reason = session.CheckpointStopped, "restart"
+		l.checkpoint(cp)
+		l.publish(&bus.OutboundMessage{
+			Channel: cp.Channel,
+			ChatID:  cp.ChatID,
+			Content: fmt.Sprintf("I was restarted while working on %q. Send /continue to pick up where I left off.", truncate(cp.Content, 80)),
+		})
+	}
+}
+
+// handleTasks shows and controls the subagents spawned from the chat.
+func (l *Loop) handleTasks(_ context.Context, _ *session.Session, msg *bus.InboundMessage, args command.Args) (*bus.OutboundMessage, error) {
+	chat := msg.Channel + ":" + msg.ChatID
+	id := args.String("id")
+	var content string
+	switch action := args.String("action"); {
+	case action == "" || action == "list":
+		content = l.subagents.List(chat)
+	case id == "":
+		content = fmt.Sprintf("Usage: /tasks %s <id>", action)
+	case action == "show":
+		transcript, err := l.subagents.Transcript(chat, id)
+		content = transcript
+		if err != nil {
+			content = "Error: " + err.Error()
+		}
+	case action == "cancel":
+		content = fmt.Sprintf("Cancelled subagent %s. Its partial result will be reported here.", id)
+		if err := l.subagents.Cancel(chat, id); err != nil {
+			content = "Error: " + err.Error()
+		}
+	}
+	return &bus.OutboundMessage{
+		Channel: msg.Channel,
+		ChatID:  msg.ChatID,
+		Content: content,
+	}, nil
+}
+
+var conversationName = regexp.MustCompile(`^[A-Za-z0-9.-]{1,32}$`)
+
+// handleSession manages the named conversations of a chat. The chat's
+// default conversation records which one is active.
+func (l *Loop) handleSession(_ context.Context, sess *session.Session, msg *bus.InboundMessage, args command.Args) (*bus.OutboundMessage, error) {
+	reply := func(content string) (*bus.OutboundMessage, error) {
+		return &bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			Content: content,
+		}, nil
+	}
+	chat := msg.SessionKey()
+	base := l.sessions.GetOrCreate(chat)
+	current := session.ConversationName(sess.Key)
+	name := args.String("name")
+
+	switch args.String("action") {
+	case "list":
+		var sb strings.Builder
+		sb.WriteString("Conversations:\n")
+		listed := false
+		for _, n := range l.sessions.Conversations(chat) {
+			marker := "  "
+			if n == current {
+				marker, listed = "* ", true
+			}
+			s := l.sessions.GetOrCreate(session.ConversationKey(chat, n))
+			sb.WriteString(fmt.Sprintf("%s%s (%d messages)\n", marker, n, s.Len()))
+		}
+		if !listed {
+			sb.WriteString(fmt.Sprintf("* %s (new)\n", current))
+		}
+		return reply(strings.TrimRight(sb.String(), "\n"))
+
+	case "switch":
+		if name == "" {
+			return reply("Usage: /session switch <name>")
+		}
+		if !conversationName.MatchString(name) {
+			return reply("Conversation names may use up to 32 letters, digits, dots and dashes.")
+		}
+		if name == current {
+			return reply(fmt.Sprintf("Already in conversation %s.", name))
+		}
+		base.Active = name
+		if name == session.DefaultConversation {
+			base.Active = ""
+		}
+		l.sessions.Save(base)
+		if !l.sessions.Exists(session.ConversationKey(chat, name)) {
+			return reply(fmt.Sprintf("Started conversation %s.", name))
+		}
+		return reply(fmt.Sprintf("Switched to conversation %s.", name))
+
+	default: // rename
+		if name == "" {
+			return reply("Usage: /session rename <name>")
+		}
+		if !conversationName.MatchString(name) || name == session.DefaultConversation {
+			return reply("Conversation names may use up to 32 letters, digits, dots and dashes, and cannot be \"default\".")
+		}
+		key := session.ConversationKey(chat, name)
+		if l.sessions.Exists(key) {
+			return reply(fmt.Sprintf("Conversation %s already exists.", name))
+		}
+		renamed := l.sessions.GetOrCreate(key)
+		renamed.Messages = sess.Messages
+		renamed.Model = sess.Model
+		renamed.ShowReasoning = sess.ShowReasoning
+		l.sessions.Save(renamed)
+		// An unfinished turn moves with its conversation.
+		if cp := l.sessions.LoadCheckpoint(sess.Key); cp != nil {
+			cp.Key = key
+			if err := l.sessions.SaveCheckpoint(cp); err != nil {
+				slog.Warn("Failed to move checkpoint", "from", sess.Key, "to", key, "err", err)
+			} else {
+				l.sessions.DeleteCheckpoint(sess.Key)
+			}
+		}
+		if sess.Key == chat {
+			// The default conversation stays, empty, to hold the metadata.
+			sess.Clear()
+			sess.Model = ""
+		} else {
+			l.sessions.Delete(sess.Key)
+		}
+		base.Active = name
+		l.sessions.Save(base)
+		return reply(fmt.Sprintf("Renamed conversation %s to %s.", current, name))
+	}
+}
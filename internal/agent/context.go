@@ -57,9 +57,11 @@ func (c *ContextBuilder) BuildSystemPrompt() string {
 }
 
 // BuildMessages constructs the complete message list for an LLM call.
+// media lists local paths of files attached to the current message.
 func (c *ContextBuilder) BuildMessages(
 	history []map[string]any,
 	currentMessage string,
+	media []string,
 	channel string,
 	chatID string,
 ) []map[string]any {
@@ -73,7 +75,7 @@ func (c *ContextBuilder) BuildMessages(
 
 	messages = append(messages, history...)
 
-	messages = append(messages, map[string]any{"role": "user", "content": currentMessage})
+	messages = append(messages, map[string]any{"role": "user", "content": buildUserContent(currentMessage, media)})
 
 	return messages
 }
@@ -89,7 +91,9 @@ func (c *ContextBuilder) AddToolResult(messages []map[string]any, toolCallID, to
 }
 
 // AddAssistantMessage appends an assistant message (optionally with tool calls).
-func (c *ContextBuilder) AddAssistantMessage(messages []map[string]any, content string, toolCalls []map[string]any, reasoningContent string) []map[string]any {
+// thinkingBlocks are the provider's signed reasoning blocks, which must be
+// echoed back while a tool-use turn continues.
+func (c *ContextBuilder) AddAssistantMessage(messages []map[string]any, content string, toolCalls []map[string]any, reasoningContent string, thinkingBlocks []map[string]any) []map[string]any {
 	msg := map[string]any{"role": "assistant", "content": content}
 	if len(toolCalls) > 0 {
 		msg["tool_calls"] = toolCalls
@@ -97,6 +101,9 @@ func (c *ContextBuilder) AddAssistantMessage(messages []map[string]any, content
 	if reasoningContent != "" {
 		msg["reasoning_content"] = reasoningContent
 	}
+	if len(thinkingBlocks) > 0 {
+		msg["thinking_blocks"] = thinkingBlocks
+	}
 	return append(messages, msg)
 }
 
@@ -0,0 +1,158 @@
+package agent
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/joebot/nagobot/internal/bus"
+	"github.com/joebot/nagobot/internal/session"
+)
+
+// FollowUpPolicy decides what happens to a message that arrives while its
+// session is still processing an earlier one.
+type FollowUpPolicy string
+
+const (
+	// FollowUpInterrupt cancels the active turn and handles the newest
+	// message. The interrupted message and the work done so far are kept
+	// in the session history.
+	FollowUpInterrupt FollowUpPolicy = "interrupt"
+	// FollowUpQueue lets the active turn finish and then handles queued
+	// messages one by one, in order.
+	FollowUpQueue FollowUpPolicy = "queue"
+	// FollowUpCoalesce lets the active turn finish and then handles all
+	// queued messages together as a single turn.
+	FollowUpCoalesce FollowUpPolicy = "coalesce"
+)
+
+// followUpPolicy returns the policy for messages from channel. Subagent
+// announcements are always queued so they never cut a turn short; a
+// message of the chat may still interrupt an announcement's turn, which
+// then ends silently with the announcement kept in the history.
+func (l *Loop) followUpPolicy(channel string) FollowUpPolicy {
+	if p, ok := l.channelFollowUp[channel]; ok && p != "" {
+		return p
+	}
+	if channel == "system" {
+		return FollowUpQueue
+	}
+	return l.followUp
+}
+
+// nextTurn takes the messages for the next turn from the head of a
+// session's queue. It returns the message to process, any messages it
+// supersedes without being processed, and the rest of the queue.
+// Subagent announcements share the queue of the chat they report to but
+// are never superseded or merged: each is processed on its own, in turn.
+func (l *Loop) nextTurn(pending []*bus.InboundMessage) (next *bus.InboundMessage, superseded, rest []*bus.InboundMessage) {
+	if pending[0].Channel == "system" {
+		return pending[0], nil, pending[1:]
+	}
+	head := 0
+	for head < len(pending) && pending[head].Channel != "system" {
+		head++
+	}
+	switch l.followUpPolicy(pending[0].Channel) {
+	case FollowUpInterrupt:
+		// Every message but the newest was interrupted before it started.
+		return pending[head-1], pending[:head-1], pending[head:]
+	case FollowUpCoalesce:
+		// Merge the leading run of plain messages; slash commands are
+		// handled on their own.
+		n := 0
+		for n < head && !isSlashCommand(pending[n].Content) {
+			n++
+		}
+		if n <= 1 {
+			return pending[0], nil, pending[1:]
+		}
+		return coalesce(pending[:n]), nil, pending[n:]
+	default:
+		return pending[0], nil, pending[1:]
+	}
+}
+
+func isSlashCommand(content string) bool {
+	return strings.HasPrefix(strings.TrimSpace(content), "/")
+}
+
+// coalesce merges consecutive messages into one, keeping the callbacks and
+// metadata of the last so the reply goes where the user last wrote.
+func coalesce(msgs []*bus.InboundMessage) *bus.InboundMessage {
+	merged := *msgs[len(msgs)-1]
+	contents := make([]string, 0, len(msgs))
+	var media []string
+	for _, m := range msgs {
+		if m.Content != "" {
+			contents = append(contents, m.Content)
+		}
+		media = append(media, m.Media...)
+	}
+	merged.Content = strings.Join(contents, "\n\n")
+	merged.Media = media
+	slog.Info("Coalesced queued messages", "session", merged.SessionKey(), "count", len(msgs))
+	return &merged
+}
+
+// recordInterrupted saves a user message whose turn was cut short, its tool
+// steps and a note of the work done, so the next turn knows what was
+// attempted.
+func recordInterrupted(sess *session.Session, content string, media []string, transcript []session.Message, steps, toolsUsed []string) {
+	note := "[Interrupted by a newer message before replying.]"
+	if len(steps) > 0 {
+		note += "\nWork done so far:\n" + strings.Join(steps, "\n")
+	}
+	sess.AddMessageWithMedia("user", content, media)
+	sess.AddSteps(transcript)
+	sess.AddMessage("assistant", note, toolsUsed...)
+}
+
+// completeToolCalls adds a result for every call of the last step that was
+// not run, since providers reject tool calls without results.
+func completeToolCalls(transcript []session.Message) []session.Message {
+	last := -1
+	for i, m := range transcript {
+		if len(m.ToolCalls) > 0 {
+			last = i
+		}
+	}
+	if last < 0 {
+		return transcript
+	}
+	answered := make(map[string]bool)
+	for _, m := range transcript[last+1:] {
+		answered[m.ToolCallID] = true
+	}
+	for _, tc := range transcript[last].ToolCalls {
+		if !answered[tc.ID] {
+			transcript = append(transcript, session.NewToolResultMessage(tc.ID, tc.Name, "[Not run: interrupted]", nil))
+		}
+	}
+	return transcript
+}
+
+// recordSuperseded saves messages that were interrupted before their turn
+// started.
+func (l *Loop) recordSuperseded(msgs []*bus.InboundMessage) {
+	if len(msgs) == 0 {
+		return
+	}
+	base := msgs[0].SessionKey()
+	defer l.sessions.Lock(base)()
+	key := l.sessions.Active(base)
+	sess := l.sessions.GetOrCreate(key)
+	for _, m := range msgs {
+		if !isSlashCommand(m.Content) {
+			recordInterrupted(sess, m.Content, nil, nil, nil, nil)
+		}
+	}
+	if err := l.sessions.Save(sess); err != nil {
+		slog.Warn("Failed to save session", "session", key, "err", err)
+	}
+}
+
+// toolStep describes a tool call and its result for an interruption note.
+func toolStep(name, args, result string) string {
+	return fmt.Sprintf("- %s %s → %s", name, truncate(args, 200), truncate(result, 300))
+}
@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joebot/nagobot/internal/bus"
+)
+
+func TestNextTurn(t *testing.T) {
+	msgs := func(contents ...string) []*bus.InboundMessage {
+		out := make([]*bus.InboundMessage, len(contents))
+		for i, c := range contents {
+			out[i] = &bus.InboundMessage{Channel: "discord", ChatID: "1", Content: c}
+		}
+		return out
+	}
+
+	l := &Loop{followUp: FollowUpInterrupt}
+	next, superseded, rest := l.nextTurn(msgs("a", "b", "c"))
+	if next.Content != "c" || len(superseded) != 2 || len(rest) != 0 {
+		t.Errorf("interrupt: next=%q superseded=%d rest=%d", next.Content, len(superseded), len(rest))
+	}
+
+	l = &Loop{followUp: FollowUpQueue}
+	next, superseded, rest = l.nextTurn(msgs("a", "b", "c"))
+	if next.Content != "a" || len(superseded) != 0 || len(rest) != 2 {
+		t.Errorf("queue: next=%q superseded=%d rest=%d", next.Content, len(superseded), len(rest))
+	}
+
+	l = &Loop{followUp: FollowUpQueue, channelFollowUp: map[string]FollowUpPolicy{"discord": FollowUpCoalesce}}
+	next, _, rest = l.nextTurn(msgs("a", "b", "/usage", "c"))
+	if next.Content != "a\n\nb" || len(rest) != 2 {
+		t.Errorf("coalesce: next=%q rest=%d", next.Content, len(rest))
+	}
+	next, _, rest = l.nextTurn(rest)
+	if next.Content != "/usage" || len(rest) != 1 {
+		t.Errorf("coalesce command: next=%q rest=%d", next.Content, len(rest))
+	}
+
+	// An announcement queued behind user messages is neither superseded
+	// nor merged.
+	pending := msgs("a", "b", "c")
+	pending[1] = &bus.InboundMessage{Channel: "system", ChatID: "discord:1", Content: "result"}
+	l = &Loop{followUp: FollowUpInterrupt}
+	next, superseded, rest = l.nextTurn(pending)
+	if next.Content != "a" || len(superseded) != 0 || len(rest) != 2 {
+		t.Errorf("interrupt before announcement: next=%q superseded=%d rest=%d", next.Content, len(superseded), len(rest))
+	}
+	next, _, rest = l.nextTurn(rest)
+	if next.Content != "result" || len(rest) != 1 {
+		t.Errorf("announcement: next=%q rest=%d", next.Content, len(rest))
+	}
+}
+
+func TestInterruptKeepsHistory(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	msgBus := bus.NewMessageBus()
+	release := make(chan struct{})
+	defer close(release)
+	loop := NewLoop(LoopConfig{Bus: msgBus, Provider: gateProvider{release}, Workspace: t.TempDir()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go loop.Run(ctx)
+
+	msgBus.PublishInbound(&bus.InboundMessage{Channel: "test", ChatID: "a", Content: "slow"})
+	msgBus.PublishInbound(&bus.InboundMessage{Channel: "test", ChatID: "a", Content: "fast"})
+
+	select {
+	case <-msgBus.Outbound:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reply after interrupting")
+	}
+
+	var got []string
+	for _, m := range loop.sessions.GetOrCreate("test:a").Messages {
+		got = append(got, m.Role+": "+m.Content)
+	}
+	want := []string{"user: slow", "assistant: [Interrupted", "user: fast", "assistant: done"}
+	if len(got) != len(want) {
+		t.Fatalf("history = %q, want %d messages", got, len(want))
+	}
+	for i := range want {
+		if !strings.HasPrefix(got[i], want[i]) {
+			t.Errorf("history[%d] = %q, want prefix %q", i, got[i], want[i])
+		}
+	}
+}
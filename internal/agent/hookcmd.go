@@ -0,0 +1,241 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/joebot/nagobot/internal/bus"
+	"github.com/joebot/nagobot/internal/llm"
+	"github.com/joebot/nagobot/internal/tool"
+	"github.com/joebot/nagobot/internal/usage"
+)
+
+// Events a CommandHook can run on, named after the Hooks fields.
+const (
+	HookBeforeMessage = "beforeMessage"
+	HookAfterMessage  = "afterMessage"
+	HookBeforeLLM     = "beforeLLM"
+	HookAfterLLM      = "afterLLM"
+	HookBeforeTool    = "beforeTool"
+	HookAfterTool     = "afterTool"
+)
+
+// CommandHook runs an external command as a hook. The command receives a
+// hookEvent as JSON on stdin and may print a hookReply as JSON on stdout;
+// empty output changes nothing. A non-zero exit, a timeout or
+// {"block": true} vetoes, with stderr or the reply's reason as the reason.
+type CommandHook struct {
+	Event   string // one of the Hook* events
+	Command string
+	Args    []string
+	Env     map[string]string
+	Tool    string        // tool name or path.Match pattern for tool events; empty matches all
+	Timeout time.Duration // default 10s
+}
+
+// hookEvent is the JSON sent to a command hook. Only the fields of the
+// event are set.
+type hookEvent struct {
+	Event     string           `json:"event"`
+	Session   string           `json:"session,omitempty"`
+	Channel   string           `json:"channel,omitempty"`
+	ChatID    string           `json:"chatId,omitempty"`
+	Sender    string           `json:"sender,omitempty"`
+	Purpose   string           `json:"purpose,omitempty"` // of an LLM call, e.g. "chat" or "compress"
+	Model     string           `json:"model,omitempty"`
+	Messages  []map[string]any `json:"messages,omitempty"`
+	Tool      string           `json:"tool,omitempty"`
+	Arguments map[string]any   `json:"arguments,omitempty"`
+	ToolCalls []hookToolCall   `json:"toolCalls,omitempty"`
+	Result    *string          `json:"result,omitempty"`
+	Content   *string          `json:"content,omitempty"`
+	Media     []string         `json:"media,omitempty"`
+}
+
+type hookToolCall struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments"`
+}
+
+// hookReply is the JSON a command hook may print. Fields that are set
+// replace the corresponding fields of the event: messages for beforeLLM,
+// arguments for beforeTool, result for afterTool, content otherwise.
+type hookReply struct {
+	Block     bool             `json:"block"`
+	Reason    string           `json:"reason"`
+	Messages  []map[string]any `json:"messages"`
+	Arguments map[string]any   `json:"arguments"`
+	Result    *string          `json:"result"`
+	Content   *string          `json:"content"`
+}
+
+// Hooks returns the Go hooks that run the command on its event.
+func (h CommandHook) Hooks() Hooks {
+	switch h.Event {
+	case HookBeforeMessage:
+		return Hooks{BeforeMessage: func(ctx context.Context, msg *bus.InboundMessage) error {
+			reply, err := h.run(ctx, hookEvent{
+				Session: msg.SessionKey(),
+				Channel: msg.Channel,
+				ChatID:  msg.ChatID,
+				Sender:  msg.SenderID,
+				Content: &msg.Content,
+				Media:   msg.Media,
+			})
+			if err == nil && reply.Content != nil {
+				msg.Content = *reply.Content
+			}
+			return err
+		}}
+	case HookAfterMessage:
+		return Hooks{AfterMessage: func(ctx context.Context, msg *bus.OutboundMessage) error {
+			reply, err := h.run(ctx, hookEvent{
+				Channel: msg.Channel,
+				ChatID:  msg.ChatID,
+				Content: &msg.Content,
+				Media:   msg.Media,
+			})
+			if err == nil && reply.Content != nil {
+				msg.Content = *reply.Content
+			}
+			return err
+		}}
+	case HookBeforeLLM:
+		return Hooks{BeforeLLM: func(ctx context.Context, req *llm.ChatRequest) error {
+			reply, err := h.run(ctx, llmEvent(ctx, *req))
+			if err == nil && reply.Messages != nil {
+				req.Messages = reply.Messages
+			}
+			return err
+		}}
+	case HookAfterLLM:
+		return Hooks{AfterLLM: func(ctx context.Context, req llm.ChatRequest, resp *llm.ChatResponse) error {
+			ev := llmEvent(ctx, req)
+			ev.Messages = nil // the prompt was sent to beforeLLM
+			ev.Content = &resp.Content
+			for _, tc := range resp.ToolCalls {
+				ev.ToolCalls = append(ev.ToolCalls, hookToolCall{ID: tc.ID, Name: tc.Name, Arguments: tc.Arguments})
+			}
+			reply, err := h.run(ctx, ev)
+			if err == nil && reply.Content != nil {
+				resp.Content = *reply.Content
+			}
+			return err
+		}}
+	case HookBeforeTool:
+		return Hooks{BeforeTool: func(ctx context.Context, ec tool.ExecContext, name string, params map[string]any) error {
+			if !h.matchesTool(name) {
+				return nil
+			}
+			reply, err := h.run(ctx, toolEvent(ec, name, params))
+			if err == nil && reply.Arguments != nil {
+				clear(params)
+				for k, v := range reply.Arguments {
+					params[k] = v
+				}
+			}
+			return err
+		}}
+	case HookAfterTool:
+		return Hooks{AfterTool: func(ctx context.Context, ec tool.ExecContext, name string, params map[string]any, result *tool.ToolResult) error {
+			if !h.matchesTool(name) {
+				return nil
+			}
+			ev := toolEvent(ec, name, params)
+			ev.Result = &result.Content
+			ev.Media = result.Media
+			reply, err := h.run(ctx, ev)
+			if err == nil && reply.Result != nil {
+				result.Content = *reply.Result
+			}
+			return err
+		}}
+	}
+	return Hooks{}
+}
+
+func llmEvent(ctx context.Context, req llm.ChatRequest) hookEvent {
+	tags := usage.TagsFrom(ctx)
+	return hookEvent{
+		Session:  tags.Session,
+		Channel:  tags.Channel,
+		Purpose:  orDefault(tags.Purpose, usage.PurposeChat),
+		Model:    req.Model,
+		Messages: req.Messages,
+	}
+}
+
+func toolEvent(ec tool.ExecContext, name string, params map[string]any) hookEvent {
+	return hookEvent{
+		Session:   ec.SessionKey,
+		Channel:   ec.Channel,
+		ChatID:    ec.ChatID,
+		Sender:    ec.SenderID,
+		Tool:      name,
+		Arguments: params,
+	}
+}
+
+func (h CommandHook) matchesTool(name string) bool {
+	if h.Tool == "" {
+		return true
+	}
+	ok, _ := path.Match(h.Tool, name)
+	return ok
+}
+
+// run sends ev to the command and reads its reply. Vetoes are returned as
+// errors.
+func (h CommandHook) run(ctx context.Context, ev hookEvent) (hookReply, error) {
+	var reply hookReply
+	ev.Event = h.Event
+	input, err := json.Marshal(ev)
+	if err != nil {
+		return reply, fmt.Errorf("encoding %s event: %w", h.Event, err)
+	}
+
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, h.Command, h.Args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Env = os.Environ()
+	for k, v := range h.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return reply, fmt.Errorf("hook %s timed out after %s", h.Command, timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return reply, errors.New(msg)
+		}
+		return reply, fmt.Errorf("hook %s: %w", h.Command, err)
+	}
+	if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return reply, nil
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &reply); err != nil {
+		return reply, fmt.Errorf("hook %s printed invalid JSON: %w", h.Command, err)
+	}
+	if reply.Block {
+		return reply, errors.New(orDefault(reply.Reason, "blocked by "+h.Command))
+	}
+	return reply, nil
+}
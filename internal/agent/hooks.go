@@ -0,0 +1,164 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/joebot/nagobot/internal/bus"
+	"github.com/joebot/nagobot/internal/llm"
+	"github.com/joebot/nagobot/internal/tool"
+)
+
+// ErrBlocked marks an LLM call vetoed by a hook.
+var ErrBlocked = errors.New("blocked by hook")
+
+// Hooks are functions run around the work of a Loop, to log, rewrite or
+// veto it. Before hooks may modify their argument and veto it by returning
+// an error; after hooks may modify the result and veto it the same way.
+// Nil hooks are skipped.
+//
+// While any AfterLLM or AfterMessage hook is registered, answers are not
+// streamed, so that nothing reaches the user before the hooks saw it.
+type Hooks struct {
+	// BeforeMessage runs when a message arrives, before slash commands and
+	// the turn. Subagent results arrive on the "system" channel. A veto
+	// drops the message without a reply.
+	BeforeMessage func(ctx context.Context, msg *bus.InboundMessage) error
+	// AfterMessage runs before a reply or a message tool message is sent.
+	// A veto drops it.
+	AfterMessage func(ctx context.Context, msg *bus.OutboundMessage) error
+
+	// BeforeLLM and AfterLLM run around every LLM call of the loop and its
+	// subagents, including compression and memory consolidation; the
+	// purpose is in usage.TagsFrom(ctx). A veto fails the call with
+	// ErrBlocked.
+	BeforeLLM func(ctx context.Context, req *llm.ChatRequest) error
+	AfterLLM  func(ctx context.Context, req llm.ChatRequest, resp *llm.ChatResponse) error
+
+	// BeforeTool and AfterTool are added to the loop's tool registry and
+	// to those of its subagents.
+	BeforeTool tool.BeforeFunc
+	AfterTool  tool.AfterFunc
+}
+
+// AddHooks registers h. Hooks run in the order they were added. Call it
+// before the loop processes messages.
+func (l *Loop) AddHooks(h Hooks) {
+	l.hooks = append(l.hooks, h)
+	if h.BeforeTool != nil {
+		l.tools.Hooks().Before(h.BeforeTool)
+	}
+	if h.AfterTool != nil {
+		l.tools.Hooks().After(h.AfterTool)
+	}
+}
+
+// holdsOutput reports whether hooks may rewrite answers, which must then
+// not be streamed.
+func (l *Loop) holdsOutput() bool {
+	for _, h := range l.hooks {
+		if h.AfterLLM != nil || h.AfterMessage != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// beforeMessage runs the BeforeMessage hooks and reports whether msg may
+// be processed.
+func (l *Loop) beforeMessage(ctx context.Context, msg *bus.InboundMessage) bool {
+	for _, h := range l.hooks {
+		if h.BeforeMessage == nil {
+			continue
+		}
+		if err := h.BeforeMessage(ctx, msg); err != nil {
+			slog.Info("Message blocked by hook", "channel", msg.Channel, "sender", msg.SenderID, "err", err)
+			return false
+		}
+	}
+	return true
+}
+
+// afterMessage runs the AfterMessage hooks and reports whether msg may be
+// sent.
+func (l *Loop) afterMessage(ctx context.Context, msg *bus.OutboundMessage) bool {
+	for _, h := range l.hooks {
+		if h.AfterMessage == nil {
+			continue
+		}
+		if err := h.AfterMessage(ctx, msg); err != nil {
+			slog.Info("Reply blocked by hook", "channel", msg.Channel, "chat", msg.ChatID, "err", err)
+			return false
+		}
+	}
+	return true
+}
+
+// publish sends msg to the bus unless an AfterMessage hook vetoes it.
+func (l *Loop) publish(msg *bus.OutboundMessage) {
+	if l.afterMessage(context.Background(), msg) {
+		l.bus.PublishOutbound(msg)
+	}
+}
+
+// hookedProvider runs a loop's LLM hooks around the calls of the wrapped
+// provider. It reads the hooks at call time, so hooks added after the loop
+// was created apply.
+type hookedProvider struct {
+	llm.Provider
+	loop *Loop
+}
+
+func (p *hookedProvider) Chat(ctx context.Context, req llm.ChatRequest) (*llm.ChatResponse, error) {
+	if err := p.before(ctx, &req); err != nil {
+		return nil, err
+	}
+	resp, err := p.Provider.Chat(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.after(ctx, req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (p *hookedProvider) ChatStream(ctx context.Context, req llm.ChatRequest, onEvent llm.StreamHandler) (*llm.ChatResponse, error) {
+	if err := p.before(ctx, &req); err != nil {
+		return nil, err
+	}
+	resp, err := p.Provider.ChatStream(ctx, req, onEvent)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.after(ctx, req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (p *hookedProvider) before(ctx context.Context, req *llm.ChatRequest) error {
+	for _, h := range p.loop.hooks {
+		if h.BeforeLLM == nil {
+			continue
+		}
+		if err := h.BeforeLLM(ctx, req); err != nil {
+			return fmt.Errorf("%w: %v", ErrBlocked, err)
+		}
+	}
+	return nil
+}
+
+func (p *hookedProvider) after(ctx context.Context, req llm.ChatRequest, resp *llm.ChatResponse) error {
+	for _, h := range p.loop.hooks {
+		if h.AfterLLM == nil {
+			continue
+		}
+		if err := h.AfterLLM(ctx, req, resp); err != nil {
+			return fmt.Errorf("%w: %v", ErrBlocked, err)
+		}
+	}
+	return nil
+}
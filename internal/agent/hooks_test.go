@@ -0,0 +1,116 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joebot/nagobot/internal/bus"
+	"github.com/joebot/nagobot/internal/llm"
+	"github.com/joebot/nagobot/internal/tool"
+)
+
+func TestHooks(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	provider := &scriptProvider{responses: []*llm.ChatResponse{
+		{ToolCalls: []llm.ToolCallRequest{{ID: "c1", Name: "exec", Arguments: map[string]any{"command": "rm -rf /"}}}},
+	}}
+	loop := NewLoop(LoopConfig{Bus: bus.NewMessageBus(), Provider: provider, Workspace: t.TempDir()})
+
+	var toolResult string
+	loop.AddHooks(Hooks{
+		BeforeMessage: func(ctx context.Context, msg *bus.InboundMessage) error {
+			if msg.Content == "ignore me" {
+				return errors.New("ignored")
+			}
+			msg.Content = strings.ToUpper(msg.Content)
+			return nil
+		},
+		BeforeTool: func(_ context.Context, ec tool.ExecContext, name string, params map[string]any) error {
+			if strings.HasPrefix(params["command"].(string), "rm ") {
+				return errors.New("rm is not allowed")
+			}
+			return nil
+		},
+		AfterTool: func(_ context.Context, ec tool.ExecContext, name string, params map[string]any, result *tool.ToolResult) error {
+			toolResult = result.Content
+			return nil
+		},
+		AfterLLM: func(ctx context.Context, req llm.ChatRequest, resp *llm.ChatResponse) error {
+			resp.Content = strings.ReplaceAll(resp.Content, "done", "[redacted]")
+			return nil
+		},
+	})
+
+	reply, err := loop.ProcessDirect(context.Background(), "clean up", "test:hooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != "[redacted]" {
+		t.Errorf("reply = %q, want the AfterLLM rewrite", reply)
+	}
+	if got := llm.ContentText(provider.requests[0].Messages[len(provider.requests[0].Messages)-1]["content"]); !strings.Contains(got, "CLEAN UP") {
+		t.Errorf("prompt ends with %q, want the BeforeMessage rewrite", got)
+	}
+	if toolResult != "" {
+		t.Errorf("AfterTool ran for a vetoed call: %q", toolResult)
+	}
+	if results := toolResults(provider.requests[1]); len(results) != 1 || !strings.Contains(results[0], "rm is not allowed") {
+		t.Errorf("tool results = %q, want the veto", results)
+	}
+
+	calls := len(provider.requests)
+	if reply, err := loop.ProcessDirect(context.Background(), "ignore me", "test:hooks"); err != nil || reply != "" {
+		t.Errorf("vetoed message: reply %q, err %v", reply, err)
+	}
+	if len(provider.requests) != calls {
+		t.Error("vetoed message reached the model")
+	}
+}
+
+func toolResults(req llm.ChatRequest) []string {
+	var results []string
+	for _, m := range req.Messages {
+		if m["role"] == "tool" {
+			results = append(results, llm.ContentText(m["content"]))
+		}
+	}
+	return results
+}
+
+func TestCommandHook(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "hook.sh")
+	os.WriteFile(script, []byte(`#!/bin/sh
+input=$(cat)
+case "$input" in
+*'"git push'*) echo '{"block": true, "reason": "no pushing"}' ;;
+*'"ls"'*) echo '{"arguments": {"command": "ls -la"}}' ;;
+*'"fail"'*) echo 'broken hook' >&2; exit 1 ;;
+esac
+`), 0o755)
+
+	before := CommandHook{Event: HookBeforeTool, Command: script, Tool: "ex*"}.Hooks().BeforeTool
+	ctx, ec := context.Background(), tool.ExecContext{}
+
+	params := map[string]any{"command": "ls"}
+	if err := before(ctx, ec, "exec", params); err != nil || params["command"] != "ls -la" {
+		t.Errorf("rewrite: params %v, err %v", params, err)
+	}
+	if err := before(ctx, ec, "exec", map[string]any{"command": "git push"}); err == nil || err.Error() != "no pushing" {
+		t.Errorf("block: err %v, want the reason", err)
+	}
+	if err := before(ctx, ec, "exec", map[string]any{"command": "fail"}); err == nil || err.Error() != "broken hook" {
+		t.Errorf("failed hook: err %v, want stderr", err)
+	}
+	params = map[string]any{"command": "pwd"}
+	if err := before(ctx, ec, "exec", params); err != nil || params["command"] != "pwd" {
+		t.Errorf("no output: params %v, err %v", params, err)
+	}
+	if err := before(ctx, ec, "read_file", map[string]any{"command": "git push"}); err != nil {
+		t.Errorf("hook ran for a tool outside its pattern: %v", err)
+	}
+}
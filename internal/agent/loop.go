@@ -3,9 +3,12 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/joebot/nagobot/internal/bus"
@@ -13,43 +16,126 @@ import (
 	"github.com/joebot/nagobot/internal/llm"
 	"github.com/joebot/nagobot/internal/session"
 	"github.com/joebot/nagobot/internal/tool"
+	"github.com/joebot/nagobot/internal/usage"
 )
 
-// slashHandler is the callback signature for a slash command.
-type slashHandler func(ctx context.Context, sess *session.Session, msg *bus.InboundMessage) (*bus.OutboundMessage, error)
+// slashHandler is the callback signature for a slash command. sess is the
+// chat's active conversation, locked for the call.
+type slashHandler func(ctx context.Context, sess *session.Session, msg *bus.InboundMessage, args command.Args) (*bus.OutboundMessage, error)
 
 // Loop is the core agent processing engine.
 // It receives messages, builds context, calls the LLM, executes tools, and sends responses.
 type Loop struct {
+	name          string // agent profile served by this loop
 	bus           *bus.MessageBus
-	provider      llm.Provider
+	main          ModelRole // user-facing conversation
+	utility       ModelRole // compression, memory consolidation, summaries
 	workspace     string
-	model         string
 	maxIterations int
 	memoryWindow  int
 	contextLimit  int
 
+	toolHistory     session.ToolDetail // tool steps replayed from earlier turns
+	toolResultChars int                // longest tool result kept in a session
+
+	thinkingBudget  int
+	reasoningEffort string
+
 	context   *ContextBuilder
 	sessions  *session.Manager
 	tools     *tool.Registry
 	subagents *SubagentManager
+	ledger    *usage.Ledger
+	budgets   *Budgets
+	tokens    *llm.TokenCounter
 
 	slashDefs  []command.Command
 	slashIndex map[string]slashHandler
+	hooks      []Hooks
+
+	maxConcurrent   int
+	slots           chan struct{} // held by each running turn
+	followUp        FollowUpPolicy
+	channelFollowUp map[string]FollowUpPolicy
+	memoryMu        sync.Mutex // serializes memory consolidation across sessions
+
+	heldMu sync.Mutex
+	held   map[string][]*bus.InboundMessage // announcements waiting for a chat's running turn, by chat
+}
+
+// ModelRole selects the provider, model and sampling parameters for one
+// kind of LLM call. Zero fields, and a nil Temperature, are inherited from
+// the main role.
+type ModelRole struct {
+	Provider    llm.Provider
+	Model       string
+	MaxTokens   int
+	Temperature *float64
+}
+
+// inherit fills r's unset fields from main. A role with its own provider
+// but no model uses that provider's default model.
+func (r ModelRole) inherit(main ModelRole) ModelRole {
+	if r.Provider == nil {
+		r.Provider = main.Provider
+		if r.Model == "" {
+			r.Model = main.Model
+		}
+	} else if r.Model == "" {
+		r.Model = r.Provider.DefaultModel()
+	}
+	if r.MaxTokens == 0 {
+		r.MaxTokens = main.MaxTokens
+	}
+	if r.Temperature == nil {
+		r.Temperature = main.Temperature
+	}
+	return r
+}
+
+// request returns a chat request for this role.
+func (r ModelRole) request(messages, tools []map[string]any) llm.ChatRequest {
+	return llm.ChatRequest{
+		Messages:    messages,
+		Tools:       tools,
+		Model:       r.Model,
+		MaxTokens:   r.MaxTokens,
+		Temperature: r.Temperature,
+	}
 }
 
 // LoopConfig holds configuration for creating an agent loop.
 type LoopConfig struct {
+	Name                string           // agent profile name; defaults to DefaultProfile
+	Sessions            *session.Manager // shared between loops; created if nil
 	Bus                 *bus.MessageBus
 	Provider            llm.Provider
 	Workspace           string
 	Model               string
+	MaxTokens           int
+	Temperature         float64
+	Utility             ModelRole // compression and consolidation; zero fields inherit
+	Subagent            ModelRole // background subagents; zero fields inherit
 	MaxIterations       int
+	MaxConcurrent       int                       // sessions processed at once by Run
+	FollowUp            FollowUpPolicy            // for messages arriving while the session is busy
+	ChannelFollowUp     map[string]FollowUpPolicy // per-channel overrides of FollowUp
 	MemoryWindow        int
 	ContextLimit        int
+	ToolHistory         session.ToolDetail // tool steps replayed from earlier turns; default full
+	ToolResultChars     int                // tool results are truncated to this in sessions
 	ExecTimeout         int
 	RestrictToWorkspace bool
 	BraveAPIKey         string
+	Usage               *usage.Ledger        // optional; enables /usage
+	ThinkingBudget      int                  // reasoning tokens per LLM call; 0 disables
+	ReasoningEffort     string               // llm.EffortLow/Medium/High; empty disables
+	Tools               []string             // enabled tool names or patterns; empty enables all
+	Skills              []string             // enabled skills; empty enables all
+	Approvals           *tool.ApprovalPolicy // tool calls needing confirmation; nil gates none
+	Budgets             *Budgets             // spending limits; nil limits nothing
+	Spawn               SpawnPolicy          // what spawned subagents may use
+	SubagentsDir        string               // subagent runs are saved here; empty keeps them in memory
 }
 
 // NewLoop creates a new agent loop.
@@ -60,32 +146,93 @@ func NewLoop(cfg LoopConfig) *Loop {
 	if cfg.MemoryWindow <= 0 {
 		cfg.MemoryWindow = 50
 	}
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = 4
+	}
+	if cfg.FollowUp == "" {
+		cfg.FollowUp = FollowUpInterrupt
+	}
 	if cfg.ContextLimit <= 0 {
 		cfg.ContextLimit = 80000
 	}
-	model := cfg.Model
-	if model == "" {
-		model = cfg.Provider.DefaultModel()
+	if cfg.ToolHistory == "" {
+		cfg.ToolHistory = session.ToolDetailFull
+	}
+	if cfg.ToolResultChars <= 0 {
+		cfg.ToolResultChars = 2000
+	}
+	if cfg.Name == "" {
+		cfg.Name = DefaultProfile
+	}
+	if cfg.Sessions == nil {
+		cfg.Sessions = session.NewManager()
+	}
+	if cfg.Budgets == nil {
+		cfg.Budgets = &Budgets{}
+	}
+	temperature := cfg.Temperature
+	main := ModelRole{
+		Provider:    cfg.Provider,
+		Model:       cfg.Model,
+		MaxTokens:   cfg.MaxTokens,
+		Temperature: &temperature,
+	}
+	if main.Model == "" {
+		main.Model = cfg.Provider.DefaultModel()
 	}
 
 	l := &Loop{
-		bus:           cfg.Bus,
-		provider:      cfg.Provider,
-		workspace:     cfg.Workspace,
-		model:         model,
-		maxIterations: cfg.MaxIterations,
-		memoryWindow:  cfg.MemoryWindow,
-		contextLimit:  cfg.ContextLimit,
-		context:       NewContextBuilder(cfg.Workspace),
-		sessions:      session.NewManager(),
-		tools:         tool.NewRegistry(),
+		name:            cfg.Name,
+		bus:             cfg.Bus,
+		main:            main,
+		utility:         cfg.Utility.inherit(main),
+		workspace:       cfg.Workspace,
+		maxIterations:   cfg.MaxIterations,
+		memoryWindow:    cfg.MemoryWindow,
+		contextLimit:    cfg.ContextLimit,
+		toolHistory:     cfg.ToolHistory,
+		toolResultChars: cfg.ToolResultChars,
+		thinkingBudget:  cfg.ThinkingBudget,
+		reasoningEffort: cfg.ReasoningEffort,
+		context:         NewContextBuilder(cfg.Workspace),
+		sessions:        cfg.Sessions,
+		tools:           tool.NewRegistry(),
 		subagents: NewSubagentManager(
-			cfg.Provider, cfg.Workspace, model, cfg.Bus,
+			cfg.Subagent.inherit(main), cfg.Workspace, cfg.Bus,
 			cfg.ExecTimeout, cfg.RestrictToWorkspace,
 		),
+		ledger:     cfg.Usage,
+		budgets:    cfg.Budgets,
+		tokens:     llm.NewTokenCounter(main.Model),
 		slashIndex: make(map[string]slashHandler),
+
+		maxConcurrent:   cfg.MaxConcurrent,
+		slots:           make(chan struct{}, cfg.MaxConcurrent),
+		followUp:        cfg.FollowUp,
+		channelFollowUp: cfg.ChannelFollowUp,
 	}
 
+	// LLM calls of every role, and tool calls of subagents, go through the
+	// loop's hooks.
+	l.main.Provider = &hookedProvider{Provider: l.main.Provider, loop: l}
+	l.utility.Provider = &hookedProvider{Provider: l.utility.Provider, loop: l}
+	l.subagents.setPolicy(cfg.Spawn)
+	l.subagents.role.Provider = &hookedProvider{Provider: l.subagents.role.Provider, loop: l}
+	for name, role := range l.subagents.models {
+		role.Provider = &hookedProvider{Provider: role.Provider, loop: l}
+		l.subagents.models[name] = role
+	}
+	l.subagents.source = l.tools
+	l.subagents.publish = l.publish
+	l.subagents.dir = cfg.SubagentsDir
+	l.subagents.hooks = l.tools.Hooks()
+	l.subagents.agent = cfg.Name
+	l.subagents.allowedTools = cfg.Tools
+	l.context.skills.Restrict(cfg.Skills)
+	l.tools.Restrict(cfg.Tools)
+	l.tools.SetApprovals(cfg.Approvals)
+	l.subagents.approvals = cfg.Approvals
+	l.subagents.budgets = cfg.Budgets
 	l.registerDefaultTools(cfg)
 	l.registerSlashCommands()
 	return l
@@ -101,17 +248,19 @@ func (l *Loop) registerDefaultTools(cfg LoopConfig) {
 	l.tools.Register(&tool.EditFileTool{AllowedDir: allowedDir})
 	l.tools.Register(&tool.ListDirTool{AllowedDir: allowedDir})
 	l.tools.Register(tool.NewShellTool(cfg.Workspace, cfg.ExecTimeout, cfg.RestrictToWorkspace))
-	l.tools.Register(tool.NewMessageTool(cfg.Bus.PublishOutbound))
-	l.tools.Register(tool.NewSpawnTool(l.subagents.Spawn))
+	l.tools.Register(tool.NewMessageTool(l.publish))
+	l.tools.Register(tool.NewSpawnTool(l.subagents.Spawn, l.subagents.ProfileNames(), l.subagents.ModelNames()))
+	l.tools.Register(tool.NewSpawnGroupTool(l.subagents.SpawnGroup, l.subagents.ProfileNames(), l.subagents.ModelNames()))
+	l.tools.Register(tool.NewSubagentsTool(l.subagents))
 	if cfg.BraveAPIKey != "" {
 		l.tools.Register(tool.NewWebSearchTool(cfg.BraveAPIKey))
 	}
 	l.tools.Register(tool.NewWebFetchTool())
 }
 
-func (l *Loop) registerCommand(name, description string, handler slashHandler) {
-	l.slashDefs = append(l.slashDefs, command.Command{Name: name, Description: description})
-	l.slashIndex[name] = handler
+func (l *Loop) registerCommand(cmd command.Command, handler slashHandler) {
+	l.slashDefs = append(l.slashDefs, cmd)
+	l.slashIndex[cmd.Name] = handler
 }
 
 // Commands returns the registered slash command definitions.
@@ -124,19 +273,64 @@ func (l *Loop) ToolRegistry() *tool.Registry {
 	return l.tools
 }
 
+// Name returns the agent profile this loop serves.
+func (l *Loop) Name() string {
+	return l.name
+}
+
+// Workspace returns the loop's workspace directory.
+func (l *Loop) Workspace() string {
+	return l.workspace
+}
+
 func (l *Loop) registerSlashCommands() {
-	l.registerCommand("new", "Start a new conversation", l.handleNew)
-	l.registerCommand("compact", "Compress current context", l.handleCompact)
-	l.registerCommand("context", "Show current context usage", l.handleContext)
-	l.registerCommand("cron", "Show scheduled cron jobs", l.handleCron)
-	l.registerCommand("stop", "Stop current processing", l.handleStop)
-	l.registerCommand("help", "Show available commands", l.handleHelp)
+	l.registerCommand(command.Command{Name: "new", Description: "Start a new conversation"}, l.handleNew)
+	l.registerCommand(command.Command{Name: "compact", Description: "Compress current context"}, l.handleCompact)
+	l.registerCommand(command.Command{Name: "context", Description: "Show current context usage"}, l.handleContext)
+	l.registerCommand(command.Command{Name: "cron", Description: "Show scheduled cron jobs"}, l.handleCron)
+	l.registerCommand(command.Command{Name: "usage", Description: "Show token usage and cost"}, l.handleUsage)
+	l.registerCommand(command.Command{Name: "reasoning", Description: "Show or hide the model's reasoning"}, l.handleReasoning)
+	l.registerCommand(command.Command{
+		Name:        "model",
+		Description: "Show or switch the model of this conversation",
+		Options: []command.Option{
+			{Name: "name", Description: `Model name, or "default" for the agent's model`},
+		},
+	}, l.handleModel)
+	l.registerCommand(command.Command{Name: "retry", Description: "Regenerate the last answer"}, l.handleRetry)
+	l.registerCommand(command.Command{Name: "undo", Description: "Remove the last exchange"}, l.handleUndo)
+	l.registerCommand(command.Command{
+		Name:        "continue",
+		Description: "Continue a turn that stopped before finishing",
+		Options: []command.Option{
+			{Name: "steps", Description: "Further steps to allow; default the agent's limit", Type: command.OptionInteger},
+		},
+	}, l.handleContinue)
+	l.registerCommand(command.Command{
+		Name:        "session",
+		Description: "List, switch or rename the conversations in this chat",
+		Options: []command.Option{
+			{Name: "action", Description: "What to do", Required: true, Choices: []string{"list", "switch", "rename"}},
+			{Name: "name", Description: "Conversation name"},
+		},
+	}, l.handleSession)
+	l.registerCommand(command.Command{
+		Name:        "tasks",
+		Description: "List, inspect or cancel the subagents of this chat",
+		Options: []command.Option{
+			{Name: "action", Description: "What to do; default list", Choices: []string{"list", "show", "cancel"}},
+			{Name: "id", Description: "Subagent ID"},
+		},
+	}, l.handleTasks)
+	l.registerCommand(command.Command{Name: "stop", Description: "Stop current processing"}, l.handleStop)
+	l.registerCommand(command.Command{Name: "help", Description: "Show available commands"}, l.handleHelp)
 }
 
-func (l *Loop) handleNew(ctx context.Context, sess *session.Session, msg *bus.InboundMessage) (*bus.OutboundMessage, error) {
+func (l *Loop) handleNew(ctx context.Context, sess *session.Session, msg *bus.InboundMessage, _ command.Args) (*bus.OutboundMessage, error) {
 	l.consolidateMemory(ctx, sess, true)
 	sess.Clear()
 	l.sessions.Save(sess)
+	l.sessions.DeleteCheckpoint(sess.Key)
 	return &bus.OutboundMessage{
 		Channel: msg.Channel,
 		ChatID:  msg.ChatID,
@@ -144,8 +338,9 @@ func (l *Loop) handleNew(ctx context.Context, sess *session.Session, msg *bus.In
 	}, nil
 }
 
-func (l *Loop) handleCompact(ctx context.Context, sess *session.Session, msg *bus.InboundMessage) (*bus.OutboundMessage, error) {
-	history := sess.GetHistory(len(sess.Messages))
+func (l *Loop) handleCompact(ctx context.Context, sess *session.Session, msg *bus.InboundMessage, _ command.Args) (*bus.OutboundMessage, error) {
+	// Compression keeps only text, so tool steps are not replayed.
+	history := sess.GetHistory(len(sess.Messages), session.ToolDetailNone)
 	if len(history) < 5 {
 		return &bus.OutboundMessage{
 			Channel: msg.Channel,
@@ -157,9 +352,9 @@ func (l *Loop) handleCompact(ctx context.Context, sess *session.Session, msg *bu
 	messages = append(messages, map[string]any{"role": "system", "content": l.context.BuildSystemPrompt()})
 	messages = append(messages, history...)
 
-	tokensBefore := estimateTokens(messages)
+	tokensBefore := l.countTokens(messages)
 	compressed := l.compressMessages(ctx, messages)
-	tokensAfter := estimateTokens(compressed)
+	tokensAfter := l.countTokens(compressed)
 
 	if tokensAfter >= tokensBefore {
 		return &bus.OutboundMessage{
@@ -186,26 +381,30 @@ func (l *Loop) handleCompact(ctx context.Context, sess *session.Session, msg *bu
 	}, nil
 }
 
-func (l *Loop) handleContext(_ context.Context, sess *session.Session, msg *bus.InboundMessage) (*bus.OutboundMessage, error) {
-	history := sess.GetHistory(len(sess.Messages))
+func (l *Loop) handleContext(_ context.Context, sess *session.Session, msg *bus.InboundMessage, _ command.Args) (*bus.OutboundMessage, error) {
+	history := sess.GetHistory(len(sess.Messages), l.toolHistory)
 	messages := make([]map[string]any, 0, len(history)+1)
 	messages = append(messages, map[string]any{"role": "system", "content": l.context.BuildSystemPrompt()})
 	messages = append(messages, history...)
-	tokens := estimateTokens(messages)
+	tokens := l.countTokens(messages)
 	usage := float64(tokens) / float64(l.contextLimit) * 100
+	content := fmt.Sprintf("Context: ~%d tokens (%.0f%% of %d limit), %d messages [%s]",
+		tokens, usage, l.contextLimit, sess.Len(), l.tokens.Tokenizer().Name())
+	if budget := l.budgets.status(sess.Key, msg.Channel); budget != "" {
+		content += "\n" + budget
+	}
 	return &bus.OutboundMessage{
 		Channel: msg.Channel,
 		ChatID:  msg.ChatID,
-		Content: fmt.Sprintf("Context: ~%d tokens (%.0f%% of %d limit), %d messages",
-			tokens, usage, l.contextLimit, len(sess.Messages)),
+		Content: content,
 	}, nil
 }
 
-func (l *Loop) handleHelp(_ context.Context, _ *session.Session, msg *bus.InboundMessage) (*bus.OutboundMessage, error) {
+func (l *Loop) handleHelp(_ context.Context, _ *session.Session, msg *bus.InboundMessage, _ command.Args) (*bus.OutboundMessage, error) {
 	var sb strings.Builder
 	sb.WriteString("nagobot commands:\n")
 	for _, cmd := range l.slashDefs {
-		sb.WriteString(fmt.Sprintf("/%s — %s\n", cmd.Name, cmd.Description))
+		sb.WriteString(fmt.Sprintf("%s — %s\n", cmd.Usage(), cmd.Description))
 	}
 	return &bus.OutboundMessage{
 		Channel: msg.Channel,
@@ -214,7 +413,7 @@ func (l *Loop) handleHelp(_ context.Context, _ *session.Session, msg *bus.Inboun
 	}, nil
 }
 
-func (l *Loop) handleCron(_ context.Context, _ *session.Session, msg *bus.InboundMessage) (*bus.OutboundMessage, error) {
+func (l *Loop) handleCron(ctx context.Context, _ *session.Session, msg *bus.InboundMessage, _ command.Args) (*bus.OutboundMessage, error) {
 	ct, ok := l.tools.Get("cron").(*tool.CronTool)
 	if !ok {
 		return &bus.OutboundMessage{
@@ -223,7 +422,7 @@ func (l *Loop) handleCron(_ context.Context, _ *session.Session, msg *bus.Inboun
 			Content: "Cron service is not enabled.",
 		}, nil
 	}
-	result, _ := ct.Execute(context.Background(), map[string]any{"action": "list"})
+	result, _ := ct.Execute(ctx, tool.ExecContext{}, map[string]any{"action": "list"})
 	return &bus.OutboundMessage{
 		Channel: msg.Channel,
 		ChatID:  msg.ChatID,
@@ -231,7 +430,77 @@ func (l *Loop) handleCron(_ context.Context, _ *session.Session, msg *bus.Inboun
 	}, nil
 }
 
-func (l *Loop) handleStop(_ context.Context, _ *session.Session, msg *bus.InboundMessage) (*bus.OutboundMessage, error) {
+func (l *Loop) handleUsage(_ context.Context, sess *session.Session, msg *bus.InboundMessage, _ command.Args) (*bus.OutboundMessage, error) {
+	if l.ledger == nil {
+		return &bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			Content: "Usage tracking is not enabled.",
+		}, nil
+	}
+	now := time.Now()
+	monthStart := usage.PeriodStart(usage.PeriodMonth, now, 0)
+	// The session total needs the whole ledger; the rest only this month.
+	records, err := l.ledger.Load(time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Token usage:\n")
+	sb.WriteString(fmt.Sprintf("This session — %s\n", usage.Sum(records, func(r usage.Record) bool { return r.Session == sess.Key })))
+	for _, p := range []struct {
+		label string
+		since time.Time
+	}{
+		{"Today", usage.PeriodStart(usage.PeriodDay, now, 0)},
+		{"This week", usage.PeriodStart(usage.PeriodWeek, now, 0)},
+		{"This month", monthStart},
+	} {
+		since := p.since
+		sb.WriteString(fmt.Sprintf("%s — %s\n", p.label, usage.Sum(records, func(r usage.Record) bool { return !r.Time.Before(since) })))
+	}
+	var monthRecords []usage.Record
+	for _, r := range records {
+		if !r.Time.Before(monthStart) {
+			monthRecords = append(monthRecords, r)
+		}
+	}
+	if groups := usage.GroupBy(monthRecords, func(r usage.Record) string { return r.Model }); len(groups) > 0 {
+		sb.WriteString("\nBy model (this month):\n")
+		for _, g := range groups {
+			sb.WriteString(fmt.Sprintf("%s — %s\n", g.Key, g.Totals))
+		}
+	}
+	if budget := l.budgets.status(sess.Key, msg.Channel); budget != "" {
+		sb.WriteString("\n" + budget + "\n")
+	}
+	return &bus.OutboundMessage{
+		Channel: msg.Channel,
+		ChatID:  msg.ChatID,
+		Content: strings.TrimRight(sb.String(), "\n"),
+	}, nil
+}
+
+func (l *Loop) handleReasoning(_ context.Context, sess *session.Session, msg *bus.InboundMessage, _ command.Args) (*bus.OutboundMessage, error) {
+	sess.ShowReasoning = !sess.ShowReasoning
+	l.sessions.Save(sess)
+
+	content := "Reasoning hidden."
+	if sess.ShowReasoning {
+		content = "Reasoning will be shown above each reply."
+		if l.thinkingBudget == 0 && l.reasoningEffort == "" {
+			content += " Extended thinking is off (agents.defaults.thinkingBudget), so only models that always reason will show any."
+		}
+	}
+	return &bus.OutboundMessage{
+		Channel: msg.Channel,
+		ChatID:  msg.ChatID,
+		Content: content,
+	}, nil
+}
+
+func (l *Loop) handleStop(_ context.Context, _ *session.Session, msg *bus.InboundMessage, _ command.Args) (*bus.OutboundMessage, error) {
 	return &bus.OutboundMessage{
 		Channel: msg.Channel,
 		ChatID:  msg.ChatID,
@@ -240,91 +509,180 @@ func (l *Loop) handleStop(_ context.Context, _ *session.Session, msg *bus.Inboun
 }
 
 // Run starts the agent loop, processing messages from the bus.
-// Messages are processed in a goroutine so that new inbound messages can
-// interrupt the current task. When a message arrives for a session that is
-// already being processed, the active task is cancelled and the new message
-// is processed instead.
+// Each session's messages are processed in their own goroutine, so a slow
+// turn in one session does not hold up the others; at most maxConcurrent
+// turns run at once. A message that arrives for a session that is already
+// being processed is handled according to its channel's FollowUpPolicy.
 // Blocks until ctx is cancelled.
 func (l *Loop) Run(ctx context.Context) {
-	slog.Info("Agent loop started")
+	l.run(ctx, l.bus.Inbound)
+}
 
-	type activeTask struct {
-		cancel context.CancelFunc
-		done   <-chan struct{}
-		key    string
+// run processes messages from inbound; see Run. A Router gives each loop
+// its own inbound channel.
+func (l *Loop) run(ctx context.Context, inbound <-chan *bus.InboundMessage) {
+	slog.Info("Agent loop started", "agent", l.name, "max_concurrent", l.maxConcurrent)
+	l.announceCheckpoints()
+	l.subagents.resume()
+
+	// sessionState tracks a session with a turn in flight. It is only
+	// accessed from this goroutine.
+	type sessionState struct {
+		cancel  context.CancelFunc
+		pending []*bus.InboundMessage // arrived while the active turn ran
 	}
-	var current *activeTask
-
-	for {
-		var doneCh <-chan struct{}
-		if current != nil {
-			doneCh = current.done
+	active := make(map[string]*sessionState)
+	finished := make(chan string)
+	slots := l.slots
+
+	start := func(msg *bus.InboundMessage, superseded []*bus.InboundMessage) {
+		key := turnKey(msg)
+		msgCtx, cancel := context.WithCancel(ctx)
+		if st := active[key]; st != nil {
+			st.cancel = cancel
+		} else {
+			active[key] = &sessionState{cancel: cancel}
 		}
+		go func() {
+			defer func() {
+				cancel()
+				select {
+				case finished <- key:
+				case <-ctx.Done():
+				}
+			}()
+			l.recordSuperseded(superseded)
+			select {
+			case slots <- struct{}{}:
+			case <-msgCtx.Done():
+				// Interrupted while waiting for a slot.
+				l.recordSuperseded([]*bus.InboundMessage{msg})
+				return
+			}
+			defer func() { <-slots }()
+			l.runTurn(ctx, msgCtx, msg)
+		}()
+	}
 
+	for {
 		select {
 		case <-ctx.Done():
-			if current != nil {
-				current.cancel()
+			for _, st := range active {
+				st.cancel()
 			}
 			slog.Info("Agent loop stopping")
 			return
 
-		case <-doneCh:
-			current = nil
-
-		case msg := <-l.bus.Inbound:
-			if current != nil {
-				if current.key == msg.SessionKey() {
-					slog.Info("Interrupting active processing", "session", current.key)
-					current.cancel()
-				}
-				<-current.done
-				current = nil
+		case key := <-finished:
+			st := active[key]
+			if st == nil || len(st.pending) == 0 {
+				delete(active, key)
+				continue
 			}
-
-			msgCtx, cancel := context.WithCancel(ctx)
-			done := make(chan struct{})
-			current = &activeTask{
-				cancel: cancel,
-				done:   done,
-				key:    msg.SessionKey(),
+			next, superseded, rest := l.nextTurn(st.pending)
+			st.pending = rest
+			start(next, superseded)
+
+		case msg := <-inbound:
+			key := turnKey(msg)
+			st, busy := active[key]
+			if !busy {
+				start(msg, nil)
+				continue
 			}
+			st.pending = append(st.pending, msg)
+			if l.followUpPolicy(msg.Channel) == FollowUpInterrupt {
+				slog.Info("Interrupting active processing", "session", key)
+				st.cancel()
+			} else {
+				slog.Info("Queued follow-up message", "session", key, "queued", len(st.pending))
+			}
+		}
+	}
+}
 
-			go func(msg *bus.InboundMessage, msgCtx context.Context, cancel context.CancelFunc) {
-				defer close(done)
-				defer cancel()
-
-				resp, err := l.processMessage(msgCtx, msg)
-				if err != nil {
-					if ctx.Err() != nil {
-						return // app shutting down
-					}
-					if msgCtx.Err() != nil {
-						return // interrupted by user
-					}
-					slog.Error("processing message", "err", err)
-					l.bus.PublishOutbound(&bus.OutboundMessage{
-						Channel: msg.Channel,
-						ChatID:  msg.ChatID,
-						Content: "Sorry, I ran into a technical issue while processing your message. Please try again, or start a new session with /new if the problem persists.",
-					})
-					return
-				}
-				if resp != nil {
-					l.bus.PublishOutbound(resp)
-				}
-			}(msg, msgCtx, cancel)
+// turnKey is the key under which Run orders the turns of msg: its chat,
+// or for a subagent announcement the chat it reports to, so that the
+// announcement waits for that chat's turn rather than for its lock.
+func turnKey(msg *bus.InboundMessage) string {
+	if msg.Channel == "system" {
+		channel, chatID := systemOrigin(msg.ChatID)
+		return channel + ":" + chatID
+	}
+	return msg.SessionKey()
+}
+
+// systemOrigin splits the chat ID of a system message, "channel:chatID",
+// into the origin chat it is about.
+func systemOrigin(chatID string) (string, string) {
+	if i := strings.Index(chatID, ":"); i >= 0 {
+		return chatID[:i], chatID[i+1:]
+	}
+	return "cli", chatID
+}
+
+// loopContextKey carries the loop's context in the context of a turn.
+type loopContextKey struct{}
+
+// withLoopContext records loopCtx, the context of the loop running a turn,
+// in msgCtx, so the turn can tell a shutdown from an interruption.
+func withLoopContext(msgCtx, loopCtx context.Context) context.Context {
+	return context.WithValue(msgCtx, loopContextKey{}, loopCtx)
+}
+
+// shuttingDown reports whether the loop running the turn of ctx is
+// stopping.
+func shuttingDown(ctx context.Context) bool {
+	loopCtx, _ := ctx.Value(loopContextKey{}).(context.Context)
+	return loopCtx != nil && loopCtx.Err() != nil
+}
+
+// runTurn processes one inbound message and publishes the response. ctx is
+// the loop's context; msgCtx is cancelled when the turn is interrupted.
+func (l *Loop) runTurn(ctx, msgCtx context.Context, msg *bus.InboundMessage) {
+	resp, err := l.processMessage(withLoopContext(msgCtx, ctx), msg)
+	if err != nil {
+		if ctx.Err() != nil {
+			return // app shutting down
+		}
+		if msgCtx.Err() != nil {
+			return // interrupted by user
 		}
+		slog.Error("processing message", "err", err)
+		l.publish(&bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			Content: userErrorMessage(err),
+		})
+		return
+	}
+	if resp != nil {
+		l.bus.PublishOutbound(resp)
 	}
 }
 
 // ProcessDirect processes a message directly (for CLI usage).
 func (l *Loop) ProcessDirect(ctx context.Context, content, sessionKey string) (string, error) {
+	return l.ProcessDirectStream(ctx, content, sessionKey, nil)
+}
+
+// ProcessDirectStream is like ProcessDirect but streams the answer: onText is
+// called with the text produced so far each time the model emits more.
+func (l *Loop) ProcessDirectStream(ctx context.Context, content, sessionKey string, onText func(text string)) (string, error) {
+	return l.ProcessDirectInteractive(ctx, content, sessionKey, onText, nil)
+}
+
+// ProcessDirectInteractive is like ProcessDirectStream, and asks approve to
+// confirm tool calls gated by the approval policy. Without approve such
+// calls are declined.
+func (l *Loop) ProcessDirectInteractive(ctx context.Context, content, sessionKey string, onText func(text string), approve bus.ApproveFunc) (string, error) {
 	msg := &bus.InboundMessage{
-		Channel:  "cli",
-		SenderID: "user",
-		ChatID:   "direct",
-		Content:  content,
+		Channel:     "cli",
+		SenderID:    "user",
+		ChatID:      "direct",
+		Content:     content,
+		StreamFunc:  onText,
+		ApproveFunc: approve,
 	}
 	if sessionKey != "" {
 		// Parse channel:chatID from session key
@@ -347,39 +705,98 @@ func (l *Loop) ProcessDirect(ctx context.Context, content, sessionKey string) (s
 // chatWithRetry wraps provider.Chat with automatic retries for transient errors
 // (network issues, rate limits, overloaded models). Uses exponential backoff.
 func chatWithRetry(ctx context.Context, provider llm.Provider, req llm.ChatRequest) (*llm.ChatResponse, error) {
+	return withRetry(ctx, func() (*llm.ChatResponse, error) {
+		return provider.Chat(ctx, req)
+	})
+}
+
+// maxRetryWait caps how long a server-requested Retry-After is honored.
+// Longer waits are treated as a hard failure so the user is not left hanging.
+const maxRetryWait = 60 * time.Second
+
+// withRetry calls fn until it succeeds, retrying retryable failures up to
+// twice. Rate-limit responses wait for the provider's Retry-After when given;
+// auth failures, bad requests and context overflow are returned immediately.
+func withRetry(ctx context.Context, fn func() (*llm.ChatResponse, error)) (*llm.ChatResponse, error) {
 	const maxRetries = 2
 	var lastErr error
 	for attempt := 0; attempt <= maxRetries; attempt++ {
 		if attempt > 0 {
 			delay := time.Duration(attempt) * 2 * time.Second
-			slog.Warn("LLM call failed, retrying", "attempt", attempt, "err", lastErr)
+			if wait := llm.RetryAfter(lastErr); wait > maxRetryWait {
+				return nil, lastErr
+			} else if wait > delay {
+				delay = wait
+			}
+			slog.Warn("LLM call failed, retrying", "attempt", attempt, "delay", delay, "err", lastErr)
 			select {
 			case <-ctx.Done():
 				return nil, ctx.Err()
 			case <-time.After(delay):
 			}
 		}
-		resp, err := provider.Chat(ctx, req)
+		resp, err := fn()
 		if err == nil {
 			return resp, nil
 		}
 		lastErr = err
+		if ctx.Err() != nil || !llm.IsRetryable(err) {
+			return nil, err
+		}
 	}
 	return nil, lastErr
 }
 
+// userErrorMessage returns a user-facing explanation for a failed turn.
+// Technical details stay in the log.
+func userErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, llm.ErrRateLimited), errors.Is(err, llm.ErrOverloaded):
+		return "The AI service is busy right now. Please try again in a moment."
+	case errors.Is(err, llm.ErrAuth):
+		return "I can't reach the AI service because of a configuration problem. Please ask the administrator to check the API key."
+	case errors.Is(err, llm.ErrContentFiltered):
+		return "Sorry, I can't help with that request."
+	case errors.Is(err, llm.ErrContextLength):
+		return "This conversation has grown too long for me to process. Please start a new session with /new."
+	case errors.Is(err, ErrBlocked):
+		return "Sorry, this request was blocked."
+	}
+	return "Sorry, I ran into a technical issue while processing your message. Please try again, or start a new session with /new if the problem persists."
+}
+
+// processMessage handles msg and returns the reply to send, passing both
+// through the message hooks. A vetoed message or reply returns nil.
 func (l *Loop) processMessage(ctx context.Context, msg *bus.InboundMessage) (*bus.OutboundMessage, error) {
-	// Handle system messages (subagent completion announcements)
+	if !l.beforeMessage(ctx, msg) {
+		return nil, nil
+	}
+	resp, err := l.handleMessage(ctx, msg)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+	if !l.afterMessage(ctx, resp) {
+		return nil, nil
+	}
+	return resp, nil
+}
+
+func (l *Loop) handleMessage(ctx context.Context, msg *bus.InboundMessage) (*bus.OutboundMessage, error) {
+	// Handle system messages (subagent completion announcements) in the
+	// active session of the origin chat, given as "channel:chatID".
 	if msg.Channel == "system" {
-		originChannel, originChatID, response := ProcessSystemMessage(
-			ctx, l.provider, l.model, l.context, l.tools,
-			msg.ChatID, msg.Content, l.maxIterations,
-		)
-		return &bus.OutboundMessage{
-			Channel: originChannel,
-			ChatID:  originChatID,
-			Content: response,
-		}, nil
+		originChannel, originChatID := systemOrigin(msg.ChatID)
+		origin := originChannel + ":" + originChatID
+		defer l.sessions.Lock(origin)()
+		sess := l.sessions.GetOrCreate(l.sessions.Active(origin))
+		// A turn of the session is still running, e.g. in another
+		// process; the announcement would land in the middle of it.
+		if l.turnRunning(sess.Key) {
+			l.holdAnnouncement(origin, msg)
+			return nil, nil
+		}
+		ctx = usage.WithSession(usage.WithPurpose(ctx, usage.PurposeSubagent), sess.Key, originChannel)
+		return l.processSystemMessage(ctx, sess, msg, originChannel, originChatID)
 	}
 
 	preview := msg.Content
@@ -388,131 +805,327 @@ func (l *Loop) processMessage(ctx context.Context, msg *bus.InboundMessage) (*bu
 	}
 	slog.Info("Processing message", "channel", msg.Channel, "sender", msg.SenderID, "preview", preview)
 
-	// Get or create session
-	sess := l.sessions.GetOrCreate(msg.SessionKey())
+	// Get or create the chat's active conversation. The lock covers all
+	// conversations of the chat.
+	defer l.sessions.Lock(msg.SessionKey())()
+	defer l.releaseAnnouncements(msg.SessionKey())
+	sess := l.sessions.GetOrCreate(l.sessions.Active(msg.SessionKey()))
+	ctx = usage.WithSession(ctx, sess.Key, msg.Channel)
 
 	// Handle slash commands
-	cmdName := strings.TrimSpace(strings.ToLower(msg.Content))
-	if strings.HasPrefix(cmdName, "/") {
-		if handler, ok := l.slashIndex[cmdName[1:]]; ok {
-			return handler(ctx, sess, msg)
+	if name, rest, ok := command.Split(msg.Content); ok {
+		if handler, ok := l.slashIndex[name]; ok {
+			cmd, _ := command.Find(l.slashDefs, name)
+			args, err := cmd.Parse(rest)
+			if err != nil {
+				return &bus.OutboundMessage{
+					Channel: msg.Channel,
+					ChatID:  msg.ChatID,
+					Content: "Invalid command: " + err.Error(),
+				}, nil
+			}
+			return handler(ctx, sess, msg, args)
 		}
 	}
+	return l.turn(ctx, sess, msg)
+}
+
+// turn answers a user message in sess, which the caller has locked: it
+// runs the ReAct loop and saves the exchange.
+func (l *Loop) turn(ctx context.Context, sess *session.Session, msg *bus.InboundMessage) (*bus.OutboundMessage, error) {
+	// Count the turn's spending, and refuse it once a daily budget is used
+	// up.
+	ctx, budget := l.budgets.startTurn(ctx, sess.Key, msg.Channel)
+	defer budget.finish()
+	if refusal := refuseOverBudget(sess, msg, budget); refusal != nil {
+		return refusal, nil
+	}
+
+	// A new message leaves an unfinished turn behind; keep what it did.
+	l.abandonCheckpoint(sess)
 
 	// Consolidate memory if session is too large
-	if len(sess.Messages) > l.memoryWindow {
+	if sess.Len() > l.memoryWindow {
 		emitProgress(msg, "Consolidating memory...")
 		l.consolidateMemory(ctx, sess, false)
 	}
 
-	// Set message tool context
-	if mt, ok := l.tools.Get("message").(*tool.MessageTool); ok {
-		mt.SetContext(msg.Channel, msg.ChatID)
+	// Store attachments in the workspace so they can be sent to the model
+	// and referenced from later turns.
+	var media []string
+	if len(msg.Media) > 0 {
+		emitProgress(msg, "Downloading attachments...")
+		media = saveInboundMedia(ctx, filepath.Join(l.workspace, "media", "inbox"), msg.Media)
 	}
 
-	// Set spawn tool context
-	if st, ok := l.tools.Get("spawn").(*tool.SpawnTool); ok {
-		st.SetContext(msg.Channel, msg.ChatID)
+	cp := &session.Checkpoint{
+		Key:     sess.Key,
+		Agent:   l.name,
+		Channel: msg.Channel,
+		ChatID:  msg.ChatID,
+		Status:  session.CheckpointRunning,
+		Content: msg.Content,
+		Media:   media,
+		Messages: l.context.BuildMessages(
+			sess.GetHistory(l.memoryWindow, l.toolHistory),
+			msg.Content,
+			media,
+			msg.Channel,
+			msg.ChatID,
+		),
+		Limit: l.maxIterations,
 	}
+	return l.react(ctx, sess, msg, cp, budget)
+}
 
-	// Set cron tool context
-	if ct, ok := l.tools.Get("cron").(*tool.CronTool); ok {
-		ct.SetContext(msg.Channel, msg.ChatID)
+// turnRunning reports whether the session key has a turn in progress, or
+// one cut off by a restart that has yet to be picked up.
+func (l *Loop) turnRunning(key string) bool {
+	cp := l.sessions.LoadCheckpoint(key)
+	return cp != nil && cp.Status == session.CheckpointRunning
+}
+
+// holdAnnouncement keeps msg, a subagent announcement for chat, until the
+// running turn of the chat's session has ended.
+func (l *Loop) holdAnnouncement(chat string, msg *bus.InboundMessage) {
+	l.heldMu.Lock()
+	defer l.heldMu.Unlock()
+	if l.held == nil {
+		l.held = make(map[string][]*bus.InboundMessage)
 	}
+	l.held[chat] = append(l.held[chat], msg)
+	slog.Info("Holding subagent announcement until the running turn ends", "chat", chat, "held", len(l.held[chat]))
+}
 
-	// Build initial messages
-	messages := l.context.BuildMessages(
-		sess.GetHistory(l.memoryWindow),
-		msg.Content,
-		msg.Channel,
-		msg.ChatID,
-	)
+// releaseAnnouncements queues the announcements held for chat again once
+// its active session has no running turn. It is called as each turn of
+// the chat ends, with the chat locked, so they follow that turn.
+func (l *Loop) releaseAnnouncements(chat string) {
+	l.heldMu.Lock()
+	msgs := l.held[chat]
+	if len(msgs) == 0 || l.turnRunning(l.sessions.Active(chat)) {
+		l.heldMu.Unlock()
+		return
+	}
+	delete(l.held, chat)
+	l.heldMu.Unlock()
+	slog.Info("Releasing held subagent announcements", "chat", chat, "count", len(msgs))
+	for _, msg := range msgs {
+		l.bus.PublishInbound(msg)
+	}
+}
+
+// refuseOverBudget returns the reply refusing a turn once a daily budget
+// is used up, or nil.
+func refuseOverBudget(sess *session.Session, msg *bus.InboundMessage, budget *turnBudget) *bus.OutboundMessage {
+	reason := budget.exceeded()
+	if reason == "" {
+		return nil
+	}
+	slog.Info("Turn refused by budget", "session", sess.Key, "reason", reason)
+	return &bus.OutboundMessage{
+		Channel: msg.Channel,
+		ChatID:  msg.ChatID,
+		Content: fmt.Sprintf("Sorry, I can't take on more right now: %s. Daily budgets start over at midnight.", reason),
+	}
+}
+
+// abandonCheckpoint records the unfinished turn of sess, if any, as
+// interrupted, so its steps stay in the history.
+func (l *Loop) abandonCheckpoint(sess *session.Session) {
+	cp := l.sessions.LoadCheckpoint(sess.Key)
+	if cp == nil {
+		return
+	}
+	slog.Info("Abandoning unfinished turn", "session", sess.Key, "steps", len(cp.Steps))
+	recordInterrupted(sess, cp.Content, cp.Media, completeToolCalls(cp.Transcript), cp.Steps, cp.ToolsUsed)
+	l.sessions.Save(sess)
+	l.sessions.DeleteCheckpoint(sess.Key)
+}
+
+// checkpoint saves cp. A failure is logged: the turn goes on, it just
+// cannot be continued after a restart.
+func (l *Loop) checkpoint(cp *session.Checkpoint) {
+	if err := l.sessions.SaveCheckpoint(withoutInlineMedia(cp)); err != nil {
+		slog.Warn("Failed to save checkpoint", "session", cp.Key, "err", err)
+	}
+}
+
+// react runs the ReAct loop of the turn in cp until the model answers. The
+// state is checkpointed after every step; a turn that runs out of
+// iterations or budget keeps its checkpoint so /continue can pick it up,
+// and a finished turn is saved to sess.
+func (l *Loop) react(ctx context.Context, sess *session.Session, msg *bus.InboundMessage, cp *session.Checkpoint, budget *turnBudget) (*bus.OutboundMessage, error) {
+	// Tools that reply, spawn or schedule default to this chat.
+	ec := tool.ExecContext{
+		Channel:    msg.Channel,
+		ChatID:     msg.ChatID,
+		SenderID:   msg.SenderID,
+		SessionKey: sess.Key,
+		Workspace:  l.workspace,
+		Approve:    msg.ApproveFunc,
+	}
+
+	interrupted := func() (*bus.OutboundMessage, error) {
+		// A shutdown leaves the turn running, to be picked up after the
+		// restart; see announceCheckpoints.
+		if shuttingDown(ctx) {
+			slog.Info("Turn cut off by shutdown", "session", sess.Key, "steps", len(cp.Steps))
+			cp.Status = session.CheckpointRunning
+			l.checkpoint(cp)
+			return nil, ctx.Err()
+		}
+		slog.Info("Turn interrupted", "session", sess.Key, "steps", len(cp.Steps))
+		recordInterrupted(sess, cp.Content, cp.Media, completeToolCalls(cp.Transcript), cp.Steps, cp.ToolsUsed)
+		l.sessions.Save(sess)
+		l.sessions.DeleteCheckpoint(sess.Key)
+		return nil, ctx.Err()
+	}
+	// stop keeps the checkpoint for /continue and tells the user why the
+	// turn stopped.
+	stop := func(reason, content string) (*bus.OutboundMessage, error) {
+		slog.Info("Turn stopped", "session", sess.Key, "reason", reason, "steps", len(cp.Steps))
+		cp.Status, cp.Reason = session.CheckpointStopped, reason
+		l.checkpoint(cp)
+		return &bus.OutboundMessage{Channel: msg.Channel, ChatID: msg.ChatID, Content: content}, nil
+	}
 
 	// ReAct loop
 	var finalContent string
-	var toolsUsed []string
-	var mediaFiles []string
-	for i := 0; i < l.maxIterations; i++ {
+	// Prompt size of the last request as reported by the provider, and the
+	// number of messages it covered; messages added since are counted on top.
+	var reportedTokens, reportedMsgs int
+	for {
 		// Check for interruption
 		if ctx.Err() != nil {
-			return nil, ctx.Err()
+			return interrupted()
+		}
+
+		// Execute the requested tools sequentially. They may have been
+		// requested before a restart.
+		if len(cp.Pending) > 0 {
+			for len(cp.Pending) > 0 {
+				if ctx.Err() != nil {
+					return interrupted()
+				}
+				tc := cp.Pending[0]
+				var args map[string]any
+				json.Unmarshal([]byte(tc.Arguments), &args)
+				cp.ToolsUsed = append(cp.ToolsUsed, tc.Name)
+				var result tool.ToolResult
+				if reason := budget.toolExceeded(tc.Name); reason != "" {
+					slog.Info("Tool call refused by budget", "tool", tc.Name, "reason", reason)
+					result.Content = fmt.Sprintf("Error: %s was not run because %s. Answer with what you have.", tc.Name, reason)
+				} else {
+					emitProgress(msg, fmt.Sprintf("Running tool: %s", tc.Name))
+					slog.Info("Tool call", "tool", tc.Name, "args", truncate(tc.Arguments, 200))
+					budget.useTool(tc.Name)
+					result = l.tools.Execute(ctx, ec, tc.Name, args)
+				}
+				// A call cut off by a shutdown runs again after the restart.
+				if shuttingDown(ctx) {
+					cp.ToolsUsed = cp.ToolsUsed[:len(cp.ToolsUsed)-1]
+					return interrupted()
+				}
+				if len(result.Media) > 0 {
+					cp.MediaFiles = append(cp.MediaFiles, result.Media...)
+				}
+				cp.Messages = l.context.AddToolResult(cp.Messages, tc.ID, tc.Name, result.Content)
+				cp.Transcript = append(cp.Transcript, session.NewToolResultMessage(tc.ID, tc.Name, truncate(result.Content, l.toolResultChars), result.Media))
+				cp.Steps = append(cp.Steps, toolStep(tc.Name, tc.Arguments, result.Content))
+				cp.Pending = cp.Pending[1:]
+				if len(cp.Pending) == 0 {
+					// Inject reflection prompt to guide next action
+					cp.Messages = append(cp.Messages, map[string]any{
+						"role":    "user",
+						"content": "[SYSTEM] Review the tool results above. If you have enough information, respond to the user's original request. If files were generated that the user needs, use the 'message' tool with the 'files' parameter to deliver them — your text response alone cannot send files. Do NOT output reflection or meta-commentary — just answer the user or call tools.",
+					})
+				}
+				l.checkpoint(cp)
+			}
+			continue
+		}
+
+		if cp.Iterations >= cp.Limit {
+			return stop("iterations", fmt.Sprintf("I've used all %d steps allowed for this request without finishing. Send /continue to let me keep going, or /continue <steps> to allow a given number of further steps.", cp.Limit))
+		}
+		if reason := budget.exceeded(); reason != "" {
+			return stop("budget", fmt.Sprintf("I had to stop before finishing because %s. The steps so far are kept: send /continue once there is budget again.", reason))
 		}
 
 		// Compress context before each LLM call if approaching the limit.
-		if estimateTokens(messages) > l.contextLimit {
+		promptTokens := reportedTokens + l.tokens.Count(cp.Messages[reportedMsgs:], nil)
+		if reportedTokens == 0 {
+			promptTokens = l.countTokens(cp.Messages)
+		}
+		if promptTokens > l.contextLimit {
 			emitProgress(msg, "Compressing context...")
-			messages = l.compressMessages(ctx, messages)
+			cp.Messages = l.compressMessages(ctx, cp.Messages)
+			reportedTokens, reportedMsgs = 0, 0
 		}
 
 		emitProgress(msg, "Thinking...")
-		resp, err := chatWithRetry(ctx, l.provider, llm.ChatRequest{
-			Messages: messages,
-			Tools:    l.tools.Definitions(),
-			Model:    l.model,
-		})
+		tools := l.tools.Definitions()
+		role := l.sessionRole(sess)
+		req := role.request(cp.Messages, tools)
+		req.ThinkingBudget = l.thinkingBudget
+		req.ReasoningEffort = l.reasoningEffort
+		cp.Iterations++
+		resp, err := l.chat(ctx, msg, role.Provider, sess.ShowReasoning, req)
 		if err != nil {
-			return nil, fmt.Errorf("LLM call: %w", err)
-		}
-
-		// Handle LLM error responses (e.g. context length exceeded).
-		// Try compressing and retrying once before giving up.
-		if resp.FinishReason == "error" {
-			slog.Warn("LLM returned error", "content", truncate(resp.Content, 200))
-			compressed := l.compressMessages(ctx, messages)
-			tokensBefore := estimateTokens(messages)
-			tokensAfter := estimateTokens(compressed)
-			if tokensAfter < tokensBefore {
-				messages = compressed
-				slog.Info("Retrying after context compression",
-					"tokens_before", tokensBefore,
-					"tokens_after", tokensAfter)
-				continue // retry this iteration
+			if ctx.Err() != nil {
+				return interrupted()
 			}
-			return nil, fmt.Errorf("LLM error: %s", truncate(resp.Content, 500))
-		}
-
-		if resp.HasToolCalls() {
-			// Build tool call dicts for the assistant message
-			toolCallDicts := make([]map[string]any, len(resp.ToolCalls))
-			for i, tc := range resp.ToolCalls {
-				argsJSON, _ := json.Marshal(tc.Arguments)
-				toolCallDicts[i] = map[string]any{
-					"id":   tc.ID,
-					"type": "function",
-					"function": map[string]any{
-						"name":      tc.Name,
-						"arguments": string(argsJSON),
-					},
-				}
+			// A model without vision rejects image and file parts: fall
+			// back to the text references and retry.
+			if errors.Is(err, llm.ErrInvalidRequest) && llm.HasMedia(cp.Messages) {
+				slog.Warn("LLM rejected attachments, retrying as text", "err", err)
+				cp.Messages, _ = llm.StripMedia(cp.Messages)
+				reportedTokens, reportedMsgs = 0, 0
+				continue
 			}
-
-			messages = l.context.AddAssistantMessage(messages, resp.Content, toolCallDicts, resp.ReasoningContent)
-
-			// Execute tools sequentially
-			for _, tc := range resp.ToolCalls {
-				if ctx.Err() != nil {
-					return nil, ctx.Err()
-				}
-				toolsUsed = append(toolsUsed, tc.Name)
-				emitProgress(msg, fmt.Sprintf("Running tool: %s", tc.Name))
-				argsJSON, _ := json.Marshal(tc.Arguments)
-				slog.Info("Tool call", "tool", tc.Name, "args", truncate(string(argsJSON), 200))
-				result := l.tools.Execute(ctx, tc.Name, tc.Arguments)
-				if len(result.Media) > 0 {
-					mediaFiles = append(mediaFiles, result.Media...)
+			// The provider rejected the prompt as too long: compress and
+			// retry. Any other error ends the turn.
+			if errors.Is(err, llm.ErrContextLength) {
+				slog.Warn("LLM context overflow", "err", err)
+				emitProgress(msg, "Compressing context...")
+				compressed := l.compressMessages(ctx, cp.Messages)
+				tokensBefore := l.countTokens(cp.Messages)
+				tokensAfter := l.countTokens(compressed)
+				if tokensAfter < tokensBefore {
+					cp.Messages = compressed
+					reportedTokens, reportedMsgs = 0, 0
+					slog.Info("Retrying after context compression",
+						"tokens_before", tokensBefore,
+						"tokens_after", tokensAfter)
+					continue // retry this iteration
 				}
-				messages = l.context.AddToolResult(messages, tc.ID, tc.Name, result.Content)
 			}
+			// Keep the steps so far: /continue retries the call.
+			cp.Status, cp.Reason = session.CheckpointStopped, "error"
+			l.checkpoint(cp)
+			return nil, fmt.Errorf("LLM call: %w", err)
+		}
+		if pt := resp.Usage["prompt_tokens"]; pt > 0 {
+			l.tokens.Observe(cp.Messages, tools, pt)
+			reportedTokens, reportedMsgs = pt, len(cp.Messages)
+		}
+		if resp.ReasoningContent != "" {
+			cp.Reasoning = append(cp.Reasoning, resp.ReasoningContent)
+		}
 
-			// Inject reflection prompt to guide next action
-			messages = append(messages, map[string]any{
-				"role":    "user",
-				"content": "[SYSTEM] Review the tool results above. If you have enough information, respond to the user's original request. If files were generated that the user needs, use the 'message' tool with the 'files' parameter to deliver them — your text response alone cannot send files. Do NOT output reflection or meta-commentary — just answer the user or call tools.",
-			})
-		} else {
+		if !resp.HasToolCalls() {
 			finalContent = resp.Content
 			break
 		}
+
+		cp.Messages = l.context.AddAssistantMessage(cp.Messages, resp.Content, toolCallDicts(resp.ToolCalls), resp.ReasoningContent, resp.ThinkingBlocks)
+		cp.Pending = sessionToolCalls(resp.ToolCalls)
+		cp.Transcript = append(cp.Transcript, session.NewToolCallMessage(resp.Content, cp.Pending))
+		if resp.Content != "" {
+			cp.Steps = append(cp.Steps, "- "+truncate(resp.Content, 300))
+		}
+		l.checkpoint(cp)
 	}
 
 	if finalContent == "" {
@@ -522,29 +1135,81 @@ func (l *Loop) processMessage(ctx context.Context, msg *bus.InboundMessage) (*bu
 	// Log response preview
 	slog.Info("Response", "channel", msg.Channel, "preview", truncate(finalContent, 120))
 
-	// Save to session (only user/assistant, not tool intermediates)
-	sess.AddMessage("user", msg.Content)
-	sess.AddMessage("assistant", finalContent, toolsUsed...)
+	// Save to session: the user message, the tool steps, then the answer
+	sess.AddMessageWithMedia("user", cp.Content, cp.Media)
+	sess.AddSteps(cp.Transcript)
+	sess.AddMessage("assistant", finalContent, cp.ToolsUsed...)
 	l.sessions.Save(sess)
+	l.sessions.DeleteCheckpoint(sess.Key)
+
+	content := finalContent
+	if sess.ShowReasoning && len(cp.Reasoning) > 0 {
+		content = formatReasoning(strings.Join(cp.Reasoning, "\n\n")) + "\n\n" + finalContent
+	}
+	if note := budget.warning(); note != "" {
+		content += "\n\n" + note
+	}
 
 	return &bus.OutboundMessage{
 		Channel:  msg.Channel,
 		ChatID:   msg.ChatID,
-		Content:  finalContent,
-		Media:    mediaFiles,
+		Content:  content,
+		Media:    cp.MediaFiles,
 		Metadata: msg.Metadata,
 	}, nil
 }
 
-// estimateTokens returns a rough token count for a message array.
-// Uses JSON byte length / 3 as a heuristic (~3 bytes per token on average).
-// estimateTokens returns a rough token count for a message array.
-// Uses JSON byte length / 4 as a heuristic. This is intentionally
-// conservative (overestimates token count) so that compression
-// triggers before hitting the actual model limit.
-func estimateTokens(messages []map[string]any) int {
-	data, _ := json.Marshal(messages)
-	return len(data) / 4
+// chat runs one LLM call for a user turn on provider. When the inbound
+// message has a StreamFunc the response is streamed and the accumulated
+// answer text is forwarded to it as it grows, preceded by the reasoning if
+// showReasoning.
+// Answers that hooks may rewrite are not streamed.
+func (l *Loop) chat(ctx context.Context, msg *bus.InboundMessage, provider llm.Provider, showReasoning bool, req llm.ChatRequest) (*llm.ChatResponse, error) {
+	if msg.StreamFunc == nil || l.holdsOutput() {
+		return chatWithRetry(ctx, provider, req)
+	}
+	var text, reasoning strings.Builder
+	onEvent := func(ev llm.StreamEvent) {
+		switch {
+		case ev.Type == llm.StreamText:
+			text.WriteString(ev.Delta)
+		case ev.Type == llm.StreamReasoning && showReasoning:
+			reasoning.WriteString(ev.Delta)
+		default:
+			return
+		}
+		if reasoning.Len() == 0 {
+			msg.StreamFunc(text.String())
+			return
+		}
+		msg.StreamFunc(formatReasoning(reasoning.String()) + "\n\n" + text.String())
+	}
+	return withRetry(ctx, func() (*llm.ChatResponse, error) {
+		// A retry streams the answer again from the start: drop what a
+		// failed attempt sent.
+		if text.Len() > 0 || reasoning.Len() > 0 {
+			text.Reset()
+			reasoning.Reset()
+			msg.StreamFunc("")
+		}
+		return provider.ChatStream(ctx, req, onEvent)
+	})
+}
+
+// formatReasoning renders reasoning as a Markdown quote so that it reads
+// apart from the answer.
+func formatReasoning(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i, line := range lines {
+		lines[i] = "> " + line
+	}
+	return "> **Reasoning**\n" + strings.Join(lines, "\n")
+}
+
+// countTokens returns the prompt size of messages plus the tool
+// definitions sent with them, calibrated against provider-reported usage.
+func (l *Loop) countTokens(messages []map[string]any) int {
+	return l.tokens.Count(messages, l.tools.Definitions())
 }
 
 // compressMessages uses the LLM to summarize older messages when the context
@@ -576,7 +1241,7 @@ func (l *Loop) compressMessages(ctx context.Context, messages []map[string]any)
 	var sb strings.Builder
 	for _, m := range toSummarize {
 		role, _ := m["role"].(string)
-		content, _ := m["content"].(string)
+		content := llm.ContentText(m["content"])
 		if content == "" {
 			continue
 		}
@@ -591,13 +1256,10 @@ func (l *Loop) compressMessages(ctx context.Context, messages []map[string]any)
 %s
 Reply with ONLY the summary, no preamble.`, sb.String())
 
-	resp, err := l.provider.Chat(ctx, llm.ChatRequest{
-		Messages: []map[string]any{
-			{"role": "system", "content": "You are a conversation summarizer. Create a concise summary preserving key information needed to continue the conversation."},
-			{"role": "user", "content": prompt},
-		},
-		Model: l.model,
-	})
+	resp, err := l.utility.Provider.Chat(usage.WithPurpose(ctx, usage.PurposeCompress), l.utility.request([]map[string]any{
+		{"role": "system", "content": "You are a conversation summarizer. Create a concise summary preserving key information needed to continue the conversation."},
+		{"role": "user", "content": prompt},
+	}, nil))
 	if err != nil {
 		slog.Error("Context compression failed", "err", err)
 		return messages
@@ -619,8 +1281,8 @@ Reply with ONLY the summary, no preamble.`, sb.String())
 		"original_msgs", len(messages),
 		"summarized", len(toSummarize),
 		"compressed_msgs", len(compressed),
-		"original_tokens", estimateTokens(messages),
-		"compressed_tokens", estimateTokens(compressed),
+		"original_tokens", l.countTokens(messages),
+		"compressed_tokens", l.countTokens(compressed),
 	)
 
 	return compressed
@@ -635,6 +1297,7 @@ func (l *Loop) consolidateMemory(ctx context.Context, sess *session.Session, arc
 	}
 
 	memory := NewMemoryStore(l.workspace)
+	keepFrom := 0
 
 	var oldMessages []session.Message
 	var keepCount int
@@ -648,16 +1311,21 @@ func (l *Loop) consolidateMemory(ctx context.Context, sess *session.Session, arc
 		if keepCount > 10 {
 			keepCount = 10
 		}
-		if len(sess.Messages) <= keepCount {
+		if sess.Len() <= keepCount {
 			return
 		}
-		oldMessages = sess.Messages[:len(sess.Messages)-keepCount]
+		keepFrom = sess.RecentStart(keepCount)
+		oldMessages = sess.Messages[:keepFrom]
 	}
 
 	if len(oldMessages) == 0 {
 		return
 	}
 
+	// MEMORY.md is shared by all sessions; update it one at a time.
+	l.memoryMu.Lock()
+	defer l.memoryMu.Unlock()
+
 	slog.Info("Memory consolidation started",
 		"total", len(sess.Messages),
 		"archiving", len(oldMessages),
@@ -678,7 +1346,16 @@ func (l *Loop) consolidateMemory(ctx context.Context, sess *session.Session, arc
 		if len(m.ToolsUsed) > 0 {
 			toolInfo = fmt.Sprintf(" [tools: %s]", strings.Join(m.ToolsUsed, ", "))
 		}
-		lines = append(lines, fmt.Sprintf("[%s] %s%s: %s", ts, strings.ToUpper(m.Role), toolInfo, m.Content))
+		switch {
+		case m.Role == "tool":
+			lines = append(lines, fmt.Sprintf("[%s] TOOL %s: %s", ts, m.Name, truncate(m.Content, 300)))
+		case len(m.ToolCalls) > 0:
+			for _, tc := range m.ToolCalls {
+				lines = append(lines, fmt.Sprintf("[%s] CALL %s %s", ts, tc.Name, truncate(tc.Arguments, 200)))
+			}
+		default:
+			lines = append(lines, fmt.Sprintf("[%s] %s%s: %s", ts, strings.ToUpper(m.Role), toolInfo, m.Content))
+		}
 	}
 	conversation := strings.Join(lines, "\n")
 	currentMemory := memory.ReadLongTerm()
@@ -697,13 +1374,10 @@ func (l *Loop) consolidateMemory(ctx context.Context, sess *session.Session, arc
 
 Respond with ONLY valid JSON, no markdown fences.`, orDefault(currentMemory, "(empty)"), conversation)
 
-	resp, err := l.provider.Chat(ctx, llm.ChatRequest{
-		Messages: []map[string]any{
-			{"role": "system", "content": "You are a memory consolidation agent. Respond only with valid JSON."},
-			{"role": "user", "content": prompt},
-		},
-		Model: l.model,
-	})
+	resp, err := l.utility.Provider.Chat(usage.WithPurpose(ctx, usage.PurposeMemory), l.utility.request([]map[string]any{
+		{"role": "system", "content": "You are a memory consolidation agent. Respond only with valid JSON."},
+		{"role": "user", "content": prompt},
+	}, nil))
 	if err != nil {
 		slog.Error("Memory consolidation LLM call failed", "err", err)
 		return
@@ -741,7 +1415,7 @@ Respond with ONLY valid JSON, no markdown fences.`, orDefault(currentMemory, "(e
 	if archiveAll {
 		sess.Messages = nil
 	} else {
-		sess.Messages = sess.Messages[len(sess.Messages)-keepCount:]
+		sess.Messages = sess.Messages[keepFrom:]
 	}
 	l.sessions.Save(sess)
 	slog.Info("Memory consolidation done", "remaining", len(sess.Messages))
@@ -754,6 +1428,37 @@ func orDefault(s, def string) string {
 	return s
 }
 
+// toolCallDicts converts tool calls for the assistant message that
+// requested them.
+func toolCallDicts(calls []llm.ToolCallRequest) []map[string]any {
+	dicts := make([]map[string]any, len(calls))
+	for i, tc := range calls {
+		argsJSON, _ := json.Marshal(tc.Arguments)
+		dicts[i] = map[string]any{
+			"id":   tc.ID,
+			"type": "function",
+			"function": map[string]any{
+				"name":      tc.Name,
+				"arguments": string(argsJSON),
+			},
+		}
+		if tc.Signature != "" {
+			dicts[i]["thought_signature"] = tc.Signature
+		}
+	}
+	return dicts
+}
+
+// sessionToolCalls converts tool calls for storing in a session.
+func sessionToolCalls(calls []llm.ToolCallRequest) []session.ToolCall {
+	out := make([]session.ToolCall, len(calls))
+	for i, tc := range calls {
+		argsJSON, _ := json.Marshal(tc.Arguments)
+		out[i] = session.ToolCall{ID: tc.ID, Name: tc.Name, Arguments: string(argsJSON)}
+	}
+	return out
+}
+
 func truncate(s string, maxLen int) string {
 	if len(s) <= maxLen {
 		return s
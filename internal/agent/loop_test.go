@@ -0,0 +1,430 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joebot/nagobot/internal/bus"
+	"github.com/joebot/nagobot/internal/llm"
+	"github.com/joebot/nagobot/internal/session"
+	"github.com/joebot/nagobot/internal/tool"
+)
+
+type stubProvider struct{ model string }
+
+func (p stubProvider) Chat(context.Context, llm.ChatRequest) (*llm.ChatResponse, error) {
+	return &llm.ChatResponse{}, nil
+}
+
+func (p stubProvider) ChatStream(ctx context.Context, req llm.ChatRequest, _ llm.StreamHandler) (*llm.ChatResponse, error) {
+	return p.Chat(ctx, req)
+}
+
+func (p stubProvider) DefaultModel() string { return p.model }
+
+func TestModelRoleInherit(t *testing.T) {
+	mainProvider := stubProvider{"main-default"}
+	warm, cool, zero := 0.7, 0.2, 0.0
+	main := ModelRole{Provider: mainProvider, Model: "big", MaxTokens: 8192, Temperature: &warm}
+
+	if got := (ModelRole{}).inherit(main); got != main {
+		t.Errorf("empty role = %+v, want main", got)
+	}
+
+	got := ModelRole{Model: "small", MaxTokens: 1024}.inherit(main)
+	want := ModelRole{Provider: mainProvider, Model: "small", MaxTokens: 1024, Temperature: &warm}
+	if got != want {
+		t.Errorf("model override = %+v, want %+v", got, want)
+	}
+
+	// A role on another provider must not inherit the main model name.
+	other := stubProvider{"cheap-default"}
+	got = ModelRole{Provider: other, Temperature: &cool}.inherit(main)
+	want = ModelRole{Provider: other, Model: "cheap-default", MaxTokens: 8192, Temperature: &cool}
+	if got != want {
+		t.Errorf("provider override = %+v, want %+v", got, want)
+	}
+
+	// A temperature of 0 is set, not inherited.
+	if got := (ModelRole{Temperature: &zero}).inherit(main); *got.Temperature != 0 {
+		t.Errorf("zero temperature = %v, want 0", *got.Temperature)
+	}
+}
+
+// gateProvider answers immediately, except for the message "slow", which
+// blocks until release is closed or the request is cancelled.
+type gateProvider struct{ release chan struct{} }
+
+func (p gateProvider) Chat(ctx context.Context, req llm.ChatRequest) (*llm.ChatResponse, error) {
+	last := req.Messages[len(req.Messages)-1]
+	if llm.ContentText(last["content"]) == "slow" {
+		select {
+		case <-p.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return &llm.ChatResponse{Content: "done"}, nil
+}
+
+func (p gateProvider) ChatStream(ctx context.Context, req llm.ChatRequest, _ llm.StreamHandler) (*llm.ChatResponse, error) {
+	return p.Chat(ctx, req)
+}
+
+func (p gateProvider) DefaultModel() string { return "gate" }
+
+func TestRunProcessesSessionsConcurrently(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	msgBus := bus.NewMessageBus()
+	release := make(chan struct{})
+	defer close(release)
+	loop := NewLoop(LoopConfig{Bus: msgBus, Provider: gateProvider{release}, Workspace: t.TempDir()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go loop.Run(ctx)
+
+	msgBus.PublishInbound(&bus.InboundMessage{Channel: "test", ChatID: "a", Content: "slow"})
+	msgBus.PublishInbound(&bus.InboundMessage{Channel: "test", ChatID: "b", Content: "fast"})
+
+	select {
+	case out := <-msgBus.Outbound:
+		if out.ChatID != "b" {
+			t.Fatalf("first reply went to %q, want b", out.ChatID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("session b was blocked by session a")
+	}
+
+	// Stopping the loop keeps session a's turn to continue after a restart.
+	cancel()
+	for deadline := time.Now().Add(5 * time.Second); loop.sessions.LoadCheckpoint("test:a") == nil; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("no checkpoint for the turn cut off by the shutdown")
+		}
+	}
+}
+
+func TestAnnouncementWaitsForItsChat(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	msgBus := bus.NewMessageBus()
+	release := make(chan struct{})
+	loop := NewLoop(LoopConfig{Bus: msgBus, Provider: gateProvider{release}, Workspace: t.TempDir(), MaxConcurrent: 2})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go loop.Run(ctx)
+
+	// The announcement for chat a queues behind its turn instead of
+	// taking the second slot, which session b needs.
+	msgBus.PublishInbound(&bus.InboundMessage{Channel: "test", ChatID: "a", Content: "slow"})
+	for deadline := time.Now().Add(5 * time.Second); len(loop.slots) == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("session a's turn did not start")
+		}
+	}
+	time.Sleep(20 * time.Millisecond) // until it holds the session lock
+	msgBus.PublishInbound(&bus.InboundMessage{Channel: "system", SenderID: "subagent", ChatID: "test:a", Content: "[Subagent 'x' completed successfully]"})
+	time.Sleep(20 * time.Millisecond)
+	msgBus.PublishInbound(&bus.InboundMessage{Channel: "test", ChatID: "b", Content: "fast"})
+
+	select {
+	case out := <-msgBus.Outbound:
+		if out.ChatID != "b" {
+			t.Fatalf("first reply went to %q, want b", out.ChatID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("session b was blocked by the announcement")
+	}
+
+	close(release)
+	for replies := 0; replies < 2; {
+		select {
+		case out := <-msgBus.Outbound:
+			if out.ChatID == "a" {
+				replies++
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("chat a got %d replies, want the turn's and the announcement's", replies)
+		}
+	}
+}
+
+// scriptProvider returns its responses in order, then "done", and keeps
+// the requests it received.
+type scriptProvider struct {
+	responses []*llm.ChatResponse
+	requests  []llm.ChatRequest
+}
+
+func (p *scriptProvider) Chat(_ context.Context, req llm.ChatRequest) (*llm.ChatResponse, error) {
+	p.requests = append(p.requests, req)
+	if len(p.responses) == 0 {
+		return &llm.ChatResponse{Content: "done"}, nil
+	}
+	resp := p.responses[0]
+	p.responses = p.responses[1:]
+	return resp, nil
+}
+
+func (p *scriptProvider) ChatStream(ctx context.Context, req llm.ChatRequest, _ llm.StreamHandler) (*llm.ChatResponse, error) {
+	return p.Chat(ctx, req)
+}
+
+func (p *scriptProvider) DefaultModel() string { return "script" }
+
+func TestToolStepsReplayed(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	for _, detail := range []session.ToolDetail{session.ToolDetailFull, session.ToolDetailNone} {
+		workspace := t.TempDir()
+		p := &scriptProvider{responses: []*llm.ChatResponse{{
+			ToolCalls: []llm.ToolCallRequest{{ID: "call1", Name: "list_dir", Arguments: map[string]any{"path": workspace}}},
+		}}}
+		loop := NewLoop(LoopConfig{Bus: bus.NewMessageBus(), Provider: p, Workspace: workspace, ToolHistory: detail})
+		key := "cli:" + string(detail)
+
+		if _, err := loop.ProcessDirect(context.Background(), "what is here?", key); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loop.ProcessDirect(context.Background(), "and now?", key); err != nil {
+			t.Fatal(err)
+		}
+
+		var roles []string
+		for _, m := range p.requests[len(p.requests)-1].Messages[1:] {
+			role, _ := m["role"].(string)
+			if _, ok := m["tool_calls"]; ok {
+				role += "+calls"
+			}
+			roles = append(roles, role)
+		}
+		want := "user assistant+calls tool assistant user"
+		if detail == session.ToolDetailNone {
+			want = "user assistant user"
+		}
+		if got := strings.Join(roles, " "); got != want {
+			t.Errorf("%s: replayed %q, want %q", detail, got, want)
+		}
+	}
+}
+
+func TestHistoryCommands(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	loop := NewLoop(LoopConfig{Bus: bus.NewMessageBus(), Provider: &scriptProvider{}, Workspace: t.TempDir(),
+		Utility: ModelRole{Model: "small"}})
+	send := func(content string) string {
+		t.Helper()
+		resp, err := loop.ProcessDirect(context.Background(), content, "cli:cmds")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	history := func(key string) string {
+		var parts []string
+		for _, m := range loop.sessions.GetOrCreate(key).Messages {
+			parts = append(parts, m.Content)
+		}
+		return strings.Join(parts, "|")
+	}
+
+	send("one")
+	send("two")
+	send("/retry")
+	if got := history("cli:cmds"); got != "one|done|two|done" {
+		t.Errorf("after /retry: %q", got)
+	}
+	send("/undo")
+	if got := history("cli:cmds"); got != "one|done" {
+		t.Errorf("after /undo: %q", got)
+	}
+
+	send("/session switch work")
+	send("three")
+	if got := history("cli:cmds#work"); got != "three|done" {
+		t.Errorf("work conversation: %q", got)
+	}
+	loop.sessions.SaveCheckpoint(&session.Checkpoint{Key: "cli:cmds#work", Channel: "cli", ChatID: "cmds", Content: "four"})
+	send("/session rename ideas")
+	if got := history("cli:cmds#ideas"); got != "three|done" {
+		t.Errorf("renamed conversation: %q", got)
+	}
+	if loop.sessions.LoadCheckpoint("cli:cmds#ideas") == nil || loop.sessions.LoadCheckpoint("cli:cmds#work") != nil {
+		t.Error("checkpoint not moved with the conversation")
+	}
+	loop.sessions.DeleteCheckpoint("cli:cmds#ideas")
+	if list := send("/session list"); !strings.Contains(list, "* ideas") || strings.Contains(list, "work") {
+		t.Errorf("list = %q", list)
+	}
+	send("/session switch default")
+	if got := history(loop.sessions.Active("cli:cmds")); got != "one|done" {
+		t.Errorf("default conversation: %q", got)
+	}
+
+	if resp := send("/session delete"); !strings.HasPrefix(resp, "Invalid command") {
+		t.Errorf("bad action: %q", resp)
+	}
+	if resp := send("/model smal"); !strings.Contains(resp, "Unknown model smal. Available: script, small") {
+		t.Errorf("typo accepted: %q", resp)
+	}
+	send("/model small")
+	if m := loop.sessions.GetOrCreate("cli:cmds").Model; m != "small" {
+		t.Errorf("model = %q", m)
+	}
+}
+
+func TestContinue(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	workspace := t.TempDir()
+	p := &scriptProvider{responses: []*llm.ChatResponse{
+		{ToolCalls: []llm.ToolCallRequest{{ID: "call1", Name: "list_dir", Arguments: map[string]any{"path": workspace}}}},
+		{ToolCalls: []llm.ToolCallRequest{{ID: "call2", Name: "list_dir", Arguments: map[string]any{"path": workspace}}}},
+		{Content: "finished"},
+	}}
+	b := bus.NewMessageBus()
+	loop := NewLoop(LoopConfig{Bus: b, Provider: p, Workspace: workspace, MaxIterations: 1})
+	ctx := context.Background()
+
+	reply, err := loop.ProcessDirect(ctx, "research", "cli:long")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(reply, "/continue") {
+		t.Errorf("reply = %q, want a hint to continue", reply)
+	}
+	cp := loop.sessions.LoadCheckpoint("cli:long")
+	if cp == nil || cp.Iterations != 1 || cp.Status != session.CheckpointStopped || len(cp.Transcript) != 2 {
+		t.Fatalf("checkpoint = %+v", cp)
+	}
+
+	// A checkpoint left running was cut off by a restart.
+	cp.Status = session.CheckpointRunning
+	loop.sessions.SaveCheckpoint(cp)
+	loop.announceCheckpoints()
+	select {
+	case out := <-b.Outbound:
+		if out.ChatID != "long" || !strings.Contains(out.Content, "restarted") {
+			t.Errorf("notice = %+v", out)
+		}
+	default:
+		t.Error("no restart notice")
+	}
+
+	if reply, _ := loop.ProcessDirect(ctx, "/continue 5", "cli:long"); reply != "finished" {
+		t.Errorf("continued reply = %q", reply)
+	}
+	if loop.sessions.LoadCheckpoint("cli:long") != nil {
+		t.Error("checkpoint kept after the turn finished")
+	}
+	msgs := loop.sessions.GetOrCreate("cli:long").Messages
+	if len(msgs) != 6 || msgs[0].Content != "research" || msgs[5].Content != "finished" {
+		t.Errorf("history = %+v", msgs)
+	}
+	if reply, _ := loop.ProcessDirect(ctx, "/continue", "cli:long"); reply != "Nothing to continue." {
+		t.Errorf("second /continue = %q", reply)
+	}
+}
+
+// flakyStreamProvider streams part of an answer and fails on its first
+// call, then streams the whole answer.
+type flakyStreamProvider struct{ calls int }
+
+func (p *flakyStreamProvider) Chat(ctx context.Context, req llm.ChatRequest) (*llm.ChatResponse, error) {
+	return p.ChatStream(ctx, req, func(llm.StreamEvent) {})
+}
+
+func (p *flakyStreamProvider) ChatStream(_ context.Context, _ llm.ChatRequest, onEvent llm.StreamHandler) (*llm.ChatResponse, error) {
+	p.calls++
+	if p.calls == 1 {
+		onEvent(llm.StreamEvent{Type: llm.StreamText, Delta: "Half an ans"})
+		return nil, errors.New("connection reset")
+	}
+	onEvent(llm.StreamEvent{Type: llm.StreamText, Delta: "The answer."})
+	return &llm.ChatResponse{Content: "The answer."}, nil
+}
+
+func (p *flakyStreamProvider) DefaultModel() string { return "flaky" }
+
+func TestStreamRetryStartsOver(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	loop := NewLoop(LoopConfig{Bus: bus.NewMessageBus(), Provider: &flakyStreamProvider{}, Workspace: t.TempDir()})
+	var streamed []string
+	if _, err := loop.ProcessDirectStream(context.Background(), "hi", "cli:s", func(text string) {
+		streamed = append(streamed, text)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Half an ans", "", "The answer."}; !slices.Equal(streamed, want) {
+		t.Errorf("streamed %q, want %q", streamed, want)
+	}
+}
+
+// blockTool blocks until its call is cancelled the first time it runs,
+// then returns at once.
+type blockTool struct {
+	started chan struct{}
+	calls   int
+}
+
+func (t *blockTool) Name() string               { return "block" }
+func (t *blockTool) Description() string        { return "blocks" }
+func (t *blockTool) Parameters() map[string]any { return map[string]any{"type": "object"} }
+
+func (t *blockTool) Execute(ctx context.Context, _ tool.ExecContext, _ map[string]any) (tool.ToolResult, error) {
+	t.calls++
+	if t.calls == 1 {
+		close(t.started)
+		<-ctx.Done()
+		return tool.ToolResult{Content: "Error: cancelled"}, nil
+	}
+	return tool.ToolResult{Content: "blocked no more"}, nil
+}
+
+func TestShutdownKeepsCheckpoint(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	p := &scriptProvider{responses: []*llm.ChatResponse{
+		{ToolCalls: []llm.ToolCallRequest{{ID: "call1", Name: "block", Arguments: map[string]any{}}}},
+		{Content: "finished"},
+	}}
+	b := bus.NewMessageBus()
+	loop := NewLoop(LoopConfig{Bus: b, Provider: p, Workspace: t.TempDir()})
+	block := &blockTool{started: make(chan struct{})}
+	loop.tools.Register(block)
+
+	// The gateway stops while the tool runs.
+	loopCtx, stop := context.WithCancel(context.Background())
+	msgCtx, cancel := context.WithCancel(loopCtx)
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		_, err := loop.processMessage(withLoopContext(msgCtx, loopCtx), &bus.InboundMessage{Channel: "cli", ChatID: "sd", Content: "work"})
+		done <- err
+	}()
+	<-block.started
+	stop()
+	if err := <-done; err == nil {
+		t.Fatal("turn finished despite the shutdown")
+	}
+
+	cp := loop.sessions.LoadCheckpoint("cli:sd")
+	if cp == nil || cp.Status != session.CheckpointRunning || len(cp.Pending) != 1 || len(cp.ToolsUsed) != 0 {
+		t.Fatalf("checkpoint = %+v", cp)
+	}
+	if n := loop.sessions.GetOrCreate("cli:sd").Len(); n != 0 {
+		t.Errorf("turn recorded in history with %d messages", n)
+	}
+
+	// After the restart the turn carries on with the cut-off call.
+	loop.announceCheckpoints()
+	<-b.Outbound
+	if reply, _ := loop.ProcessDirect(context.Background(), "/continue", "cli:sd"); reply != "finished" {
+		t.Errorf("continued reply = %q", reply)
+	}
+	if block.calls != 2 {
+		t.Errorf("tool ran %d times, want 2", block.calls)
+	}
+}
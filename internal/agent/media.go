@@ -0,0 +1,252 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/joebot/nagobot/internal/llm"
+	"github.com/joebot/nagobot/internal/session"
+)
+
+const (
+	// maxMediaDownload caps the size of a downloaded attachment.
+	maxMediaDownload = 50 << 20
+	// maxInlineMedia caps attachments sent to the model inline; Anthropic
+	// rejects images over 5 MB. Larger files are only referenced by path.
+	maxInlineMedia = 5 << 20
+)
+
+// inlineImageTypes are the image formats all vision providers accept.
+var inlineImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// saveInboundMedia stores a message's attachments in dir and returns their
+// local paths. URLs are downloaded; local paths are kept only if they name
+// a file already in dir, so a message cannot make the agent read any file on
+// the host. Attachments that fail to download are logged and skipped.
+func saveInboundMedia(ctx context.Context, dir string, refs []string) []string {
+	var paths []string
+	for _, ref := range refs {
+		if !strings.HasPrefix(ref, "http://") && !strings.HasPrefix(ref, "https://") {
+			if path, ok := inboxFile(dir, ref); ok {
+				paths = append(paths, path)
+			} else {
+				slog.Warn("Attachment outside the inbox ignored", "path", ref)
+			}
+			continue
+		}
+		path, err := downloadMedia(ctx, ref, dir)
+		if err != nil {
+			slog.Error("Failed to save attachment", "url", ref, "err", err)
+			continue
+		}
+		slog.Info("Saved attachment", "path", path)
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// inboxFile reports whether path is a regular file inside dir, after
+// resolving symlinks, and returns its cleaned path.
+func inboxFile(dir, path string) (string, bool) {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", false
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return "", false
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", false
+	}
+	resolved, err = filepath.Abs(resolved)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	if info, err := os.Stat(resolved); err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+	return filepath.Clean(path), true
+}
+
+// downloadMedia fetches rawURL into dir under a timestamped file name with a
+// random suffix, so attachments saved in the same second never collide.
+func downloadMedia(ctx context.Context, rawURL, dir string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxMediaDownload+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxMediaDownload {
+		return "", fmt.Errorf("attachment exceeds %d MB", maxMediaDownload>>20)
+	}
+
+	name := "attachment"
+	if u, err := url.Parse(rawURL); err == nil {
+		if base := unsafeFileChars.ReplaceAllString(filepath.Base(u.Path), "_"); base != "" && base != "." && base != "_" {
+			name = base
+		}
+	}
+	if filepath.Ext(name) == "" {
+		if exts, _ := mime.ExtensionsByType(resp.Header.Get("Content-Type")); len(exts) > 0 {
+			name += exts[0]
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, time.Now().Format("20060102-150405")+"-"+hex.EncodeToString(suffix)+"-"+name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// buildUserContent returns the content of a user message with attachments.
+// Every attachment is named in the text, so models without vision and later
+// turns (whose history is text only) can still refer to the stored file;
+// images and PDFs small enough are also attached inline.
+func buildUserContent(text string, media []string) any {
+	if len(media) == 0 {
+		return text
+	}
+
+	refs, inline := loadMedia(media)
+	if len(refs) > 0 {
+		text = strings.TrimSpace(text + "\n\n" + strings.Join(refs, "\n"))
+	}
+	if len(inline) == 0 {
+		return text
+	}
+	return append([]any{llm.TextPart(text)}, inline...)
+}
+
+// loadMedia reads the attachments at the given paths and returns the text
+// references to them and the parts of those to attach inline.
+func loadMedia(media []string) (refs []string, inline []any) {
+	for _, path := range media {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			slog.Warn("Attachment unreadable", "path", path, "err", err)
+			continue
+		}
+		mimeType := detectMIME(path, data)
+		refs = append(refs, mediaReference(path))
+		if len(data) > maxInlineMedia {
+			continue
+		}
+		switch {
+		case inlineImageTypes[mimeType]:
+			inline = append(inline, llm.ImagePart(mimeType, data))
+		case mimeType == "application/pdf":
+			inline = append(inline, llm.FilePart(filepath.Base(path), mimeType, data))
+		}
+	}
+	return refs, inline
+}
+
+// withoutInlineMedia returns the checkpoint to persist for cp: the inline
+// attachments of the turn's user message, which can be megabytes and would
+// be rewritten at every step, are left out. The message keeps its text,
+// which names the files, and MediaMessage records where restoreInlineMedia
+// puts them back.
+func withoutInlineMedia(cp *session.Checkpoint) *session.Checkpoint {
+	saved := *cp
+	saved.MediaMessage = 0
+	if len(cp.Media) == 0 {
+		return &saved
+	}
+	for i := len(cp.Messages) - 1; i >= 0; i-- {
+		msg := cp.Messages[i]
+		if msg["role"] != "user" || !llm.HasMedia([]map[string]any{msg}) {
+			continue
+		}
+		saved.Messages = append([]map[string]any(nil), cp.Messages...)
+		stripped := make(map[string]any, len(msg))
+		for k, v := range msg {
+			stripped[k] = v
+		}
+		stripped["content"] = llm.ContentText(msg["content"])
+		saved.Messages[i] = stripped
+		saved.MediaMessage = i + 1
+		break
+	}
+	return &saved
+}
+
+// restoreInlineMedia reattaches the inline parts left out of a loaded
+// checkpoint by withoutInlineMedia, reading them again from cp.Media.
+func restoreInlineMedia(cp *session.Checkpoint) {
+	i := cp.MediaMessage - 1
+	cp.MediaMessage = 0
+	if i < 0 || i >= len(cp.Messages) {
+		return
+	}
+	_, inline := loadMedia(cp.Media)
+	if len(inline) == 0 {
+		return
+	}
+	msg := make(map[string]any, len(cp.Messages[i]))
+	for k, v := range cp.Messages[i] {
+		msg[k] = v
+	}
+	msg["content"] = append([]any{llm.TextPart(llm.ContentText(msg["content"]))}, inline...)
+	cp.Messages[i] = msg
+}
+
+// mediaReference is the text line naming a stored attachment.
+func mediaReference(path string) string {
+	return "[Attached file: " + path + "]"
+}
+
+// detectMIME returns the MIME type of a file from its extension, falling
+// back to content sniffing.
+func detectMIME(path string, data []byte) string {
+	if t := mime.TypeByExtension(strings.ToLower(filepath.Ext(path))); t != "" {
+		t, _, _ = strings.Cut(t, ";")
+		return t
+	}
+	t, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	return t
+}
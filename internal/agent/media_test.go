@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joebot/nagobot/internal/bus"
+	"github.com/joebot/nagobot/internal/llm"
+)
+
+func TestSaveInboundMediaInboxOnly(t *testing.T) {
+	root := t.TempDir()
+	inbox := filepath.Join(root, "inbox")
+	os.MkdirAll(inbox, 0o755)
+	inside := filepath.Join(inbox, "photo.png")
+	outside := filepath.Join(root, "secret.txt")
+	os.WriteFile(inside, []byte("png"), 0o644)
+	os.WriteFile(outside, []byte("secret"), 0o644)
+	link := filepath.Join(inbox, "link.txt")
+	if err := os.Symlink(outside, link); err != nil {
+		t.Fatal(err)
+	}
+
+	refs := []string{inside, outside, link, filepath.Join(inbox, "..", "secret.txt"), inbox, "/etc/passwd"}
+	got := saveInboundMedia(context.Background(), inbox, refs)
+	if len(got) != 1 || got[0] != inside {
+		t.Errorf("saved = %v, want only %s", got, inside)
+	}
+}
+
+func TestDownloadMediaUniqueNames(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	got := saveInboundMedia(context.Background(), dir, []string{srv.URL + "/a.png", srv.URL + "/a.png"})
+	if len(got) != 2 || got[0] == got[1] {
+		t.Fatalf("saved = %v, want two distinct files", got)
+	}
+	for _, path := range got {
+		if !strings.HasSuffix(path, "-a.png") {
+			t.Errorf("path = %q", path)
+		}
+	}
+}
+
+func TestCheckpointLeavesOutInlineMedia(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	workspace := t.TempDir()
+	inbox := filepath.Join(workspace, "media", "inbox")
+	os.MkdirAll(inbox, 0o755)
+	image := filepath.Join(inbox, "photo.png")
+	os.WriteFile(image, []byte("png"), 0o644)
+
+	p := &scriptProvider{responses: []*llm.ChatResponse{
+		{ToolCalls: []llm.ToolCallRequest{{ID: "call1", Name: "list_dir", Arguments: map[string]any{"path": workspace}}}},
+		{Content: "a photo"},
+	}}
+	loop := NewLoop(LoopConfig{Bus: bus.NewMessageBus(), Provider: p, Workspace: workspace, MaxIterations: 1})
+	ctx := context.Background()
+
+	msg := &bus.InboundMessage{Channel: "cli", SenderID: "user", ChatID: "pics", Content: "what is this?", Media: []string{image}}
+	if _, err := loop.handleMessage(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	if !llm.HasMedia(p.requests[0].Messages) {
+		t.Fatal("image not sent inline")
+	}
+	cp := loop.sessions.LoadCheckpoint("cli:pics")
+	if cp == nil {
+		t.Fatal("no checkpoint")
+	}
+	data, _ := json.Marshal(cp.Messages)
+	if strings.Contains(string(data), "base64") || llm.HasMedia(cp.Messages) {
+		t.Errorf("checkpoint keeps inline media: %s", data)
+	}
+	if text := llm.ContentText(cp.Messages[cp.MediaMessage-1]["content"]); !strings.Contains(text, mediaReference(image)) {
+		t.Errorf("user message = %q", text)
+	}
+
+	if reply, _ := loop.ProcessDirect(ctx, "/continue", "cli:pics"); reply != "a photo" {
+		t.Errorf("continued reply = %q", reply)
+	}
+	if last := p.requests[len(p.requests)-1]; !llm.HasMedia(last.Messages) {
+		t.Error("image not restored when the turn continued")
+	}
+}
@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/joebot/nagobot/internal/bus"
+)
+
+// DefaultProfile is the agent profile used when no route matches.
+const DefaultProfile = "default"
+
+// Route sends matching messages to an agent profile. Empty fields match
+// anything.
+type Route struct {
+	Profile string
+	Channel string // e.g. "discord", "cli", "cron", "heartbeat", "webhook"
+	Guild   string // Discord server ID
+	ChatID  string // Discord channel ID, cron job ID, ...
+	Sender  string
+}
+
+// RouteKey describes where a message or job comes from.
+type RouteKey struct {
+	Channel string
+	Guild   string
+	ChatID  string
+	Sender  string
+}
+
+func (r Route) matches(k RouteKey) bool {
+	return (r.Channel == "" || r.Channel == k.Channel) &&
+		(r.Guild == "" || r.Guild == k.Guild) &&
+		(r.ChatID == "" || r.ChatID == k.ChatID) &&
+		(r.Sender == "" || r.Sender == k.Sender)
+}
+
+// Router dispatches inbound messages from one bus to the loops of several
+// agent profiles, so one gateway process can serve differently configured
+// agents in different channels.
+type Router struct {
+	bus    *bus.MessageBus
+	routes []Route
+	order  []*Loop
+	loops  map[string]*Loop
+}
+
+// NewRouter creates a router over loops, which must include one named
+// DefaultProfile. Routes are tried in order and the first match wins.
+// The loops share the first loop's concurrency limit, so it stays global.
+func NewRouter(msgBus *bus.MessageBus, routes []Route, loops ...*Loop) *Router {
+	r := &Router{bus: msgBus, routes: routes, order: loops, loops: make(map[string]*Loop, len(loops))}
+	for _, l := range loops {
+		l.slots = loops[0].slots
+		r.loops[l.Name()] = l
+	}
+	return r
+}
+
+// Loops returns the loops in the order they were given.
+func (r *Router) Loops() []*Loop {
+	return r.order
+}
+
+// Match returns the profile for k and whether a route matched; without a
+// match it returns DefaultProfile.
+func (r *Router) Match(k RouteKey) (profile string, matched bool) {
+	for _, route := range r.routes {
+		if route.matches(k) {
+			if _, ok := r.loops[route.Profile]; ok {
+				return route.Profile, true
+			}
+			slog.Warn("Route targets unknown agent profile", "profile", route.Profile)
+		}
+	}
+	return DefaultProfile, false
+}
+
+// Loop returns the loop serving profile, or the default loop.
+func (r *Router) Loop(profile string) *Loop {
+	if l, ok := r.loops[profile]; ok {
+		return l
+	}
+	return r.loops[DefaultProfile]
+}
+
+// Resolve returns the loop that should handle msg. Messages that name
+// their agent (subagent results) go back to it.
+func (r *Router) Resolve(msg *bus.InboundMessage) *Loop {
+	if name, ok := msg.Metadata["agent"].(string); ok && name != "" {
+		return r.Loop(name)
+	}
+	guild, _ := msg.Metadata["guild_id"].(string)
+	profile, _ := r.Match(RouteKey{
+		Channel: msg.Channel,
+		Guild:   guild,
+		ChatID:  msg.ChatID,
+		Sender:  msg.SenderID,
+	})
+	return r.Loop(profile)
+}
+
+// Run starts every loop and feeds each the messages routed to it.
+// Blocks until ctx is cancelled.
+func (r *Router) Run(ctx context.Context) {
+	inbound := make(map[*Loop]chan *bus.InboundMessage, len(r.loops))
+	for _, l := range r.loops {
+		ch := make(chan *bus.InboundMessage, cap(r.bus.Inbound))
+		inbound[l] = ch
+		go l.run(ctx, ch)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-r.bus.Inbound:
+			l := r.Resolve(msg)
+			slog.Debug("Routed message", "agent", l.Name(), "channel", msg.Channel, "chat", msg.ChatID)
+			select {
+			case inbound[l] <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/joebot/nagobot/internal/bus"
+)
+
+func TestRouterResolve(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	msgBus := bus.NewMessageBus()
+	newLoop := func(name string) *Loop {
+		return NewLoop(LoopConfig{Name: name, Bus: msgBus, Provider: stubProvider{"m"}, Workspace: t.TempDir()})
+	}
+	r := NewRouter(msgBus, []Route{
+		{Profile: "dev", Channel: "discord", ChatID: "dev-channel"},
+		{Profile: "ops", Channel: "discord", Guild: "ops-guild"},
+		{Profile: "missing", Channel: "cli"},
+	}, newLoop(DefaultProfile), newLoop("dev"), newLoop("ops"))
+
+	tests := []struct {
+		msg  bus.InboundMessage
+		want string
+	}{
+		{bus.InboundMessage{Channel: "discord", ChatID: "dev-channel"}, "dev"},
+		{bus.InboundMessage{Channel: "discord", ChatID: "x", Metadata: map[string]any{"guild_id": "ops-guild"}}, "ops"},
+		{bus.InboundMessage{Channel: "discord", ChatID: "x"}, DefaultProfile},
+		{bus.InboundMessage{Channel: "cli", ChatID: "direct"}, DefaultProfile}, // route to unknown profile
+		{bus.InboundMessage{Channel: "system", ChatID: "discord:x", Metadata: map[string]any{"agent": "ops"}}, "ops"},
+	}
+	for _, tt := range tests {
+		if got := r.Resolve(&tt.msg).Name(); got != tt.want {
+			t.Errorf("Resolve(%s:%s) = %s, want %s", tt.msg.Channel, tt.msg.ChatID, got, tt.want)
+		}
+	}
+
+	if profile, ok := r.Match(RouteKey{Channel: "cron", ChatID: "job1"}); ok || profile != DefaultProfile {
+		t.Errorf("Match(cron) = %s, %v; want default, false", profile, ok)
+	}
+}
@@ -48,6 +48,7 @@ type metadataWrapper struct {
 type SkillsLoader struct {
 	workspace       string
 	workspaceSkills string
+	enabled         map[string]bool // nil enables all skills
 }
 
 // NewSkillsLoader creates a new skills loader.
@@ -58,7 +59,19 @@ func NewSkillsLoader(workspace string) *SkillsLoader {
 	}
 }
 
-// ListSkills returns all discovered skills (workspace overrides builtin).
+// Restrict limits the loader to the named skills. No names enables all.
+func (s *SkillsLoader) Restrict(names []string) {
+	s.enabled = nil
+	if len(names) == 0 {
+		return
+	}
+	s.enabled = make(map[string]bool, len(names))
+	for _, name := range names {
+		s.enabled[name] = true
+	}
+}
+
+// ListSkills returns all enabled skills (workspace overrides builtin).
 func (s *SkillsLoader) ListSkills() []SkillInfo {
 	seen := make(map[string]bool)
 	var skills []SkillInfo
@@ -66,7 +79,7 @@ func (s *SkillsLoader) ListSkills() []SkillInfo {
 	// Workspace skills (highest priority)
 	if entries, err := os.ReadDir(s.workspaceSkills); err == nil {
 		for _, e := range entries {
-			if !e.IsDir() {
+			if !e.IsDir() || !s.isEnabled(e.Name()) {
 				continue
 			}
 			skillFile := filepath.Join(s.workspaceSkills, e.Name(), "SKILL.md")
@@ -85,7 +98,7 @@ func (s *SkillsLoader) ListSkills() []SkillInfo {
 	entries, err := fs.ReadDir(builtinSkillsFS, "builtin_skills")
 	if err == nil {
 		for _, e := range entries {
-			if !e.IsDir() || seen[e.Name()] {
+			if !e.IsDir() || seen[e.Name()] || !s.isEnabled(e.Name()) {
 				continue
 			}
 			embedPath := "builtin_skills/" + e.Name() + "/SKILL.md"
@@ -102,6 +115,10 @@ func (s *SkillsLoader) ListSkills() []SkillInfo {
 	return skills
 }
 
+func (s *SkillsLoader) isEnabled(name string) bool {
+	return s.enabled == nil || s.enabled[name]
+}
+
 // LoadSkill reads a skill's SKILL.md content by name.
 func (s *SkillsLoader) LoadSkill(name string) string {
 	// Check workspace first
@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/joebot/nagobot/internal/tool"
+)
+
+// SpawnPolicy limits the subagents the spawn tool may start. The model can
+// ask for less than it allows, never more.
+type SpawnPolicy struct {
+	Profiles      map[string][]string  // tool sets by name, added to the built-in ones
+	Models        map[string]ModelRole // roles the model may pick; zero fields inherit the subagent role
+	MaxIterations int                  // per subagent; default 15
+	Timeout       time.Duration        // longest run; 0 is unlimited
+	MaxGroupSize  int                  // subagents per group; default 8
+	GroupTimeout  time.Duration        // deadline of a group, default and maximum; default 30 minutes
+}
+
+// spawnProfiles are the tool profiles offered unless the policy replaces
+// them. "default" is used when the model names none.
+var spawnProfiles = map[string][]string{
+	"default":  {"read_file", "write_file", "edit_file", "list_dir", "exec"},
+	"research": {"read_file", "list_dir", "web_search", "web_fetch"},
+	"coder":    {"read_file", "write_file", "edit_file", "list_dir", "exec", "web_fetch"},
+}
+
+// noSubagentTools are never given to a subagent: they would message the
+// user or start further subagents.
+var noSubagentTools = []string{"message", "spawn", "spawn_group", "subagents"}
+
+// setPolicy applies p to the manager. Model roles inherit from the
+// subagent role, so it must be set first.
+func (m *SubagentManager) setPolicy(p SpawnPolicy) {
+	m.profiles = maps.Clone(spawnProfiles)
+	maps.Copy(m.profiles, p.Profiles)
+	m.models = make(map[string]ModelRole, len(p.Models))
+	for name, role := range p.Models {
+		m.models[name] = role.inherit(m.role)
+	}
+	m.maxIterations = p.MaxIterations
+	if m.maxIterations <= 0 {
+		m.maxIterations = 15
+	}
+	m.timeout = p.Timeout
+	m.maxGroupSize = p.MaxGroupSize
+	if m.maxGroupSize <= 0 {
+		m.maxGroupSize = 8
+	}
+	m.groupTimeout = p.GroupTimeout
+	if m.groupTimeout <= 0 {
+		m.groupTimeout = 30 * time.Minute
+	}
+}
+
+// ProfileNames returns the tool profiles a subagent can be spawned with.
+func (m *SubagentManager) ProfileNames() []string {
+	return slices.Sorted(maps.Keys(m.profiles))
+}
+
+// ModelNames returns the model roles a subagent can be spawned with.
+func (m *SubagentManager) ModelNames() []string {
+	return slices.Sorted(maps.Keys(m.models))
+}
+
+// prepare applies the policy to a spawn request. It returns the task to
+// run, and notes on what was capped.
+func (m *SubagentManager) prepare(req tool.SpawnRequest) (*subagentTask, []string, error) {
+	t := &subagentTask{
+		task:          req.Task,
+		label:         req.Label,
+		channel:       req.Channel,
+		chatID:        req.ChatID,
+		chat:          req.Channel + ":" + req.ChatID,
+		profile:       req.Profile,
+		model:         req.Model,
+		role:          m.role,
+		maxIterations: m.maxIterations,
+		timeout:       m.timeout,
+		workdir:       m.workspace,
+	}
+	if t.profile == "" {
+		t.profile = "default"
+	}
+	var ok bool
+	if t.tools, ok = m.profiles[t.profile]; !ok {
+		return nil, nil, fmt.Errorf("unknown profile %q (available: %s)", t.profile, strings.Join(m.ProfileNames(), ", "))
+	}
+	if req.Model != "" {
+		if t.role, ok = m.models[req.Model]; !ok {
+			return nil, nil, fmt.Errorf("unknown model %q (available: %s)", req.Model, strings.Join(m.ModelNames(), ", "))
+		}
+	}
+
+	var notes []string
+	if n := req.MaxIterations; n > t.maxIterations {
+		notes = append(notes, fmt.Sprintf("Iterations capped at %d.", t.maxIterations))
+	} else if n > 0 {
+		t.maxIterations = n
+	}
+	if d := req.Timeout; m.timeout > 0 && d > m.timeout {
+		notes = append(notes, fmt.Sprintf("Run time capped at %s.", m.timeout))
+	} else if d > 0 {
+		t.timeout = d
+	}
+
+	if req.Workdir != "" {
+		dir := req.Workdir
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(m.workspace, dir)
+		}
+		dir = filepath.Clean(dir)
+		if rel, err := filepath.Rel(filepath.Clean(m.workspace), dir); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, nil, fmt.Errorf("workdir %s is outside the workspace", req.Workdir)
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return nil, nil, fmt.Errorf("workdir %s is not a directory", req.Workdir)
+		}
+		t.workdir = dir
+	}
+	return t, notes, nil
+}
@@ -2,80 +2,195 @@ package agent
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/joebot/nagobot/internal/bus"
-	"github.com/joebot/nagobot/internal/llm"
+	"github.com/joebot/nagobot/internal/session"
 	"github.com/joebot/nagobot/internal/tool"
+	"github.com/joebot/nagobot/internal/usage"
 )
 
 // SubagentManager manages background subagent execution.
 // Subagents are lightweight agent instances that run in goroutines
 // with isolated tool sets (no message/spawn tools to prevent recursion).
 type SubagentManager struct {
-	provider            llm.Provider
+	role                ModelRole
 	workspace           string
-	model               string
 	bus                 *bus.MessageBus
+	publish             func(*bus.OutboundMessage) // notices to the user, through the loop's message hooks
 	execTimeout         int
 	restrictToWorkspace bool
+	agent               string               // profile whose loop receives the results
+	allowedTools        []string             // tool patterns; empty allows all
+	approvals           *tool.ApprovalPolicy // nobody can confirm, so gated calls are declined
+	hooks               *tool.Hooks          // shared with the loop's registry
+	budgets             *Budgets             // daily limits of the origin session
+	source              *tool.Registry       // the loop's tools, shared where a profile allows
+	dir                 string               // runs are saved here; empty keeps them in memory
+	groupGrace          time.Duration        // wait for members past a group's deadline
+
+	// Set from a SpawnPolicy by setPolicy.
+	profiles      map[string][]string
+	models        map[string]ModelRole
+	maxIterations int
+	timeout       time.Duration
+	maxGroupSize  int
+	groupTimeout  time.Duration
 
 	mu    sync.Mutex
-	tasks map[string]context.CancelFunc
+	tasks map[string]*subagentTask
+}
+
+// subagentTask is a running subagent. Its progress fields are guarded by
+// mu, since they are read while the subagent runs.
+type subagentTask struct {
+	id, label, task string
+	channel, chatID string // origin chat
+	chat            string // origin chat, "channel:chatID"
+	session         string // charged for usage and budgets
+	started         time.Time
+	since           time.Time     // when this process started running it
+	prior           time.Duration // run time before a restart
+	cancel          context.CancelFunc
+	group           *subagentGroup // nil unless spawned as part of a group
+
+	profile       string
+	tools         []string // tool patterns of the profile
+	model         string   // name of the model role; empty is the subagent role
+	role          ModelRole
+	maxIterations int
+	timeout       time.Duration // 0 is unlimited
+	workdir       string
+
+	mu         sync.Mutex
+	iterations int
+	lastTool   string
+	steps      []string         // what was done so far
+	messages   []map[string]any // the LLM conversation after the last full step
+	inbox      []string         // messages not yet passed to the subagent
+	cancelled  bool
+	status     string // "running" until the result is known
+	result     string
+	finished   time.Time
+}
+
+// progress records a step of the subagent.
+func (t *subagentTask) progress(toolName, step string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if toolName != "" {
+		t.lastTool = toolName
+	}
+	t.steps = append(t.steps, step)
 }
 
 // NewSubagentManager creates a new subagent manager.
 func NewSubagentManager(
-	provider llm.Provider,
+	role ModelRole,
 	workspace string,
-	model string,
 	msgBus *bus.MessageBus,
 	execTimeout int,
 	restrictToWorkspace bool,
 ) *SubagentManager {
 	return &SubagentManager{
-		provider:            provider,
+		role:                role,
 		workspace:           workspace,
-		model:               model,
 		bus:                 msgBus,
+		publish:             msgBus.PublishOutbound,
 		execTimeout:         execTimeout,
 		restrictToWorkspace: restrictToWorkspace,
-		tasks:               make(map[string]context.CancelFunc),
+		profiles:            spawnProfiles,
+		maxIterations:       15,
+		maxGroupSize:        8,
+		groupTimeout:        30 * time.Minute,
+		groupGrace:          30 * time.Second,
+		tasks:               make(map[string]*subagentTask),
 	}
 }
 
-// Spawn starts a subagent in the background to execute a task.
-// Returns a status message immediately.
-func (m *SubagentManager) Spawn(
-	ctx context.Context,
-	task string,
-	label string,
-	originChannel string,
-	originChatID string,
-) string {
-	taskID := fmt.Sprintf("%x", time.Now().UnixNano()%0xFFFFFFFF)[:8]
-	if label == "" {
-		label = task
-		if len(label) > 30 {
-			label = label[:30] + "..."
-		}
+// Spawn starts a subagent in the background to execute a task, within
+// the limits of the spawn policy. Returns a status message immediately.
+func (m *SubagentManager) Spawn(ctx context.Context, req tool.SpawnRequest) (string, error) {
+	t, notes, err := m.prepare(req)
+	if err != nil {
+		return "", err
+	}
+	t.id = newTaskID()
+	if t.label == "" {
+		t.label = shortLabel(t.task)
 	}
+	t.session = usage.TagsFrom(ctx).Session
+	// The subagent outlives the turn that spawned it, but keeps its usage
+	// tags.
+	m.start(context.WithoutCancel(ctx), t)
+
+	slog.Info("Spawned subagent", "id", t.id, "label", t.label, "profile", t.profile, "model", t.role.Model)
+	limits := fmt.Sprintf("up to %d iterations", t.maxIterations)
+	if t.timeout > 0 {
+		limits += fmt.Sprintf(" and %s", t.timeout)
+	}
+	status := fmt.Sprintf("Subagent [%s] started (id: %s, profile %s, %s). I'll notify you when it completes.", t.label, t.id, t.profile, limits)
+	if len(notes) > 0 {
+		status += " " + strings.Join(notes, " ")
+	}
+	return status, nil
+}
 
-	subCtx, cancel := context.WithCancel(ctx)
+// newTaskID returns a random id for a subagent or group.
+func newTaskID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// shortLabel derives a display label from a task.
+func shortLabel(task string) string {
+	if len(task) > 30 {
+		return task[:30] + "..."
+	}
+	return task
+}
+
+// start runs t in the background, stopping it once its time is up or its
+// group's deadline has passed.
+func (m *SubagentManager) start(ctx context.Context, t *subagentTask) {
+	var deadline time.Time
+	if t.timeout > 0 {
+		deadline = time.Now().Add(t.timeout - t.prior)
+	}
+	if g := t.group; g != nil && !g.deadline.IsZero() && (deadline.IsZero() || g.deadline.Before(deadline)) {
+		deadline = g.deadline
+	}
+	var subCtx context.Context
+	var cancel context.CancelFunc
+	if !deadline.IsZero() {
+		subCtx, cancel = context.WithDeadline(ctx, deadline)
+	} else {
+		subCtx, cancel = context.WithCancel(ctx)
+	}
+	t.since = time.Now()
+	if t.started.IsZero() {
+		t.started = t.since
+	}
+	t.cancel = cancel
+	t.status = "running"
 
 	m.mu.Lock()
-	m.tasks[taskID] = cancel
+	m.tasks[t.id] = t
 	m.mu.Unlock()
+	m.save(t)
 
-	go m.run(subCtx, taskID, task, label, originChannel, originChatID)
-
-	slog.Info("Spawned subagent", "id", taskID, "label", label)
-	return fmt.Sprintf("Subagent [%s] started (id: %s). I'll notify you when it completes.", label, taskID)
+	go m.run(subCtx, t)
 }
 
 // RunningCount returns the number of active subagents.
@@ -85,49 +200,208 @@ func (m *SubagentManager) RunningCount() int {
 	return len(m.tasks)
 }
 
-func (m *SubagentManager) run(
-	ctx context.Context,
-	taskID, task, label, originChannel, originChatID string,
-) {
-	defer func() {
-		m.mu.Lock()
-		delete(m.tasks, taskID)
-		m.mu.Unlock()
-	}()
+// find returns the running subagent id spawned from chat.
+func (m *SubagentManager) find(chat, id string) (*subagentTask, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if t := m.tasks[id]; t != nil && t.chat == chat {
+		return t, nil
+	}
+	return nil, fmt.Errorf("no running subagent with id %s", id)
+}
+
+// List describes the running subagents spawned from chat, oldest first.
+func (m *SubagentManager) List(chat string) string {
+	m.mu.Lock()
+	var tasks []*subagentTask
+	for _, t := range m.tasks {
+		if t.chat == chat {
+			tasks = append(tasks, t)
+		}
+	}
+	m.mu.Unlock()
+	if len(tasks) == 0 {
+		return "No subagents are running."
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].started.Before(tasks[j].started) })
+
+	var sb strings.Builder
+	sb.WriteString("Running subagents:\n")
+	for _, t := range tasks {
+		t.mu.Lock()
+		lastTool := t.lastTool
+		if lastTool == "" {
+			lastTool = "none"
+		}
+		group := ""
+		if t.group != nil {
+			group = fmt.Sprintf(" in group %s [%s],", t.group.id, t.group.label)
+		}
+		fmt.Fprintf(&sb, "- %s [%s]%s running %s, %d iterations, last tool: %s\n",
+			t.id, t.label, group, time.Since(t.started).Round(time.Second), t.iterations, lastTool)
+		t.mu.Unlock()
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
 
-	slog.Info("Subagent starting", "id", taskID, "label", label)
+// Transcript describes what the subagent id spawned from chat has done so
+// far.
+func (m *SubagentManager) Transcript(chat, id string) (string, error) {
+	t, err := m.find(chat, id)
+	if err != nil {
+		return "", err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return fmt.Sprintf("Subagent %s [%s], %d iterations\nTask: %s\n\n%s",
+		t.id, t.label, t.iterations, t.task, stepsText(t.steps)), nil
+}
 
-	result, status := m.executeTask(ctx, taskID, task)
+// Cancel stops the subagent id spawned from chat, or every running member
+// of the group id. It reports the partial result like a finished one.
+func (m *SubagentManager) Cancel(chat, id string) error {
+	tasks := m.groupMembers(chat, id)
+	if len(tasks) == 0 {
+		t, err := m.find(chat, id)
+		if err != nil {
+			return err
+		}
+		tasks = append(tasks, t)
+	}
+	for _, t := range tasks {
+		t.mu.Lock()
+		t.cancelled = true
+		t.mu.Unlock()
+		t.cancel()
+		slog.Info("Cancelled subagent", "id", t.id)
+	}
+	return nil
+}
+
+// Send passes a message to the subagent id spawned from chat, which reads
+// it before its next LLM call.
+func (m *SubagentManager) Send(chat, id, message string) error {
+	t, err := m.find(chat, id)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.inbox = append(t.inbox, message)
+	t.mu.Unlock()
+	return nil
+}
 
-	m.announceResult(taskID, label, task, result, originChannel, originChatID, status)
+// stepsText joins the steps of a subagent, keeping the most recent ones if
+// they are long.
+func stepsText(steps []string) string {
+	if len(steps) == 0 {
+		return "No steps yet."
+	}
+	text := strings.Join(steps, "\n")
+	if len(text) > 4000 {
+		text = "...\n" + text[len(text)-4000:]
+	}
+	return text
+}
+
+func (m *SubagentManager) run(ctx context.Context, t *subagentTask) {
+	slog.Info("Subagent starting", "id", t.id, "label", t.label)
+	ctx = usage.WithPurpose(ctx, usage.PurposeSubagent)
+
+	result, status := m.executeTask(ctx, tool.ExecContext{
+		Channel:    t.channel,
+		ChatID:     t.chatID,
+		SessionKey: t.chat,
+		Workspace:  m.workspace,
+	}, t)
+
+	t.mu.Lock()
+	switch {
+	case t.cancelled:
+		status = "cancelled"
+		result = fmt.Sprintf("Cancelled after %d iterations. Progress so far:\n%s", t.iterations, stepsText(t.steps))
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		status = "timeout"
+		result = fmt.Sprintf("Timed out after %s and %d iterations. Progress so far:\n%s", (t.prior + time.Since(t.since)).Round(time.Second), t.iterations, stepsText(t.steps))
+	}
+	t.status, t.result, t.finished = status, result, time.Now()
+	t.mu.Unlock()
+	m.save(t)
+
+	// The subagent is no longer listed once its result arrives.
+	m.mu.Lock()
+	delete(m.tasks, t.id)
+	m.mu.Unlock()
+	t.cancel()
+	if t.group != nil {
+		m.finishMember(t)
+		return
+	}
+	m.announceResult(t.id, t.label, t.task, result, t.channel, t.chatID, status)
 }
 
-func (m *SubagentManager) executeTask(ctx context.Context, taskID, task string) (string, string) {
+func (m *SubagentManager) executeTask(ctx context.Context, ec tool.ExecContext, t *subagentTask) (string, string) {
 	// Build isolated tool registry (no message, no spawn)
 	tools := tool.NewRegistry()
+	tools.Restrict(m.allowedTools)
+	tools.SetApprovals(m.approvals)
+	if m.hooks != nil {
+		tools.SetHooks(m.hooks)
+	}
 	allowedDir := ""
 	if m.restrictToWorkspace {
 		allowedDir = m.workspace
 	}
-	tools.Register(&tool.ReadFileTool{AllowedDir: allowedDir, EmbedFS: builtinSkillsFS})
-	tools.Register(&tool.WriteFileTool{AllowedDir: allowedDir})
-	tools.Register(&tool.EditFileTool{AllowedDir: allowedDir})
-	tools.Register(&tool.ListDirTool{AllowedDir: allowedDir})
-	tools.Register(tool.NewShellTool(m.workspace, m.execTimeout, m.restrictToWorkspace))
-
-	systemPrompt := m.buildPrompt()
-	messages := []map[string]any{
-		{"role": "system", "content": systemPrompt},
-		{"role": "user", "content": task},
-	}
-
-	maxIterations := 15
-	for i := 0; i < maxIterations; i++ {
-		resp, err := chatWithRetry(ctx, m.provider, llm.ChatRequest{
-			Messages: messages,
-			Tools:    tools.Definitions(),
-			Model:    m.model,
-		})
+	tools.Register(&tool.ReadFileTool{AllowedDir: allowedDir, Workdir: t.workdir, EmbedFS: builtinSkillsFS})
+	tools.Register(&tool.WriteFileTool{AllowedDir: allowedDir, Workdir: t.workdir})
+	tools.Register(&tool.EditFileTool{AllowedDir: allowedDir, Workdir: t.workdir})
+	tools.Register(&tool.ListDirTool{AllowedDir: allowedDir, Workdir: t.workdir})
+	tools.Register(tool.NewShellTool(t.workdir, m.execTimeout, m.restrictToWorkspace))
+	// Web, MCP and other tools of the loop are shared, then the profile
+	// picks the subagent's tools.
+	if m.source != nil {
+		for _, name := range m.source.Names() {
+			if tools.Get(name) == nil && !slices.Contains(noSubagentTools, name) {
+				tools.Register(m.source.Get(name))
+			}
+		}
+	}
+	tools.Restrict(t.tools)
+
+	names := tools.Names()
+	slices.Sort(names)
+	// A subagent resumed after a restart goes on from its saved messages.
+	t.mu.Lock()
+	messages := t.messages
+	t.mu.Unlock()
+	if messages == nil {
+		messages = []map[string]any{
+			{"role": "system", "content": m.buildPrompt(t, names)},
+			{"role": "user", "content": t.task},
+		}
+	}
+
+	// Subagent calls count against the daily budgets of the session that
+	// spawned them.
+	tags := usage.TagsFrom(ctx)
+	for t.iterations < t.maxIterations {
+		if m.budgets != nil {
+			sess, ch := m.budgets.today(tags.Session, tags.Channel)
+			if reason := m.budgets.dailyExceeded(tags.Channel, sess, ch); reason != "" {
+				return fmt.Sprintf("Stopped before finishing because %s.", reason), "error"
+			}
+		}
+		if ctx.Err() != nil {
+			return fmt.Sprintf("Error: %s", ctx.Err()), "error"
+		}
+		t.mu.Lock()
+		for _, note := range t.inbox {
+			messages = append(messages, map[string]any{"role": "user", "content": "[Message from the main agent] " + note})
+		}
+		t.inbox = nil
+		t.iterations++
+		t.mu.Unlock()
+		resp, err := chatWithRetry(ctx, t.role.Provider, t.role.request(messages, tools.Definitions()))
 		if err != nil {
 			return fmt.Sprintf("Error: %s", err), "error"
 		}
@@ -140,30 +414,18 @@ func (m *SubagentManager) executeTask(ctx context.Context, taskID, task string)
 		}
 
 		// Build assistant message with tool calls
-		toolCallDicts := make([]map[string]any, len(resp.ToolCalls))
-		for j, tc := range resp.ToolCalls {
-			argsJSON, _ := json.Marshal(tc.Arguments)
-			toolCallDicts[j] = map[string]any{
-				"id":   tc.ID,
-				"type": "function",
-				"function": map[string]any{
-					"name":      tc.Name,
-					"arguments": string(argsJSON),
-				},
-			}
-		}
-
-		msg := map[string]any{"role": "assistant", "content": resp.Content}
-		if len(toolCallDicts) > 0 {
-			msg["tool_calls"] = toolCallDicts
-		}
+		msg := map[string]any{"role": "assistant", "content": resp.Content, "tool_calls": toolCallDicts(resp.ToolCalls)}
 		messages = append(messages, msg)
+		if resp.Content != "" {
+			t.progress("", "- "+truncate(resp.Content, 300))
+		}
 
 		// Execute tools
 		for _, tc := range resp.ToolCalls {
 			argsJSON, _ := json.Marshal(tc.Arguments)
-			slog.Debug("Subagent tool call", "id", taskID, "tool", tc.Name, "args", truncate(string(argsJSON), 200))
-			result := tools.Execute(ctx, tc.Name, tc.Arguments)
+			slog.Debug("Subagent tool call", "id", t.id, "tool", tc.Name, "args", truncate(string(argsJSON), 200))
+			result := m.executeTool(ctx, ec, tools, tags, tc.Name, tc.Arguments)
+			t.progress(tc.Name, toolStep(tc.Name, string(argsJSON), result.Content))
 			messages = append(messages, map[string]any{
 				"role":         "tool",
 				"tool_call_id": tc.ID,
@@ -171,19 +433,31 @@ func (m *SubagentManager) executeTask(ctx context.Context, taskID, task string)
 				"content":      result.Content,
 			})
 		}
+		t.mu.Lock()
+		t.messages = messages
+		t.mu.Unlock()
+		m.save(t)
 	}
 
 	return "Task completed (max iterations reached).", "ok"
 }
 
+// executeTool runs a subagent's tool call unless it would go over a daily
+// budget.
+func (m *SubagentManager) executeTool(ctx context.Context, ec tool.ExecContext, tools *tool.Registry, tags usage.Tags, name string, params map[string]any) tool.ToolResult {
+	if m.budgets != nil {
+		sess, ch := m.budgets.today(tags.Session, tags.Channel)
+		if reason := m.budgets.dailyToolExceeded(tags.Channel, name, sess, ch); reason != "" {
+			return tool.ToolResult{Content: fmt.Sprintf("Error: %s was not run because %s.", name, reason)}
+		}
+		m.budgets.useTool(tags.Session, tags.Channel, name)
+	}
+	return tools.Execute(ctx, ec, name, params)
+}
+
 func (m *SubagentManager) announceResult(
 	taskID, label, task, result, originChannel, originChatID, status string,
 ) {
-	statusText := "completed successfully"
-	if status != "ok" {
-		statusText = "failed"
-	}
-
 	content := fmt.Sprintf(`[Subagent '%s' %s]
 
 Task: %s
@@ -192,7 +466,7 @@ Result:
 %s
 
 Summarize this naturally for the user. Keep it brief (1-2 sentences). Do not mention technical details like "subagent" or task IDs.`,
-		label, statusText, task, result)
+		label, statusText(status), task, result)
 
 	// Inject as system message to trigger main agent
 	m.bus.PublishInbound(&bus.InboundMessage{
@@ -200,14 +474,35 @@ Summarize this naturally for the user. Keep it brief (1-2 sentences). Do not men
 		SenderID: "subagent",
 		ChatID:   fmt.Sprintf("%s:%s", originChannel, originChatID),
 		Content:  content,
+		Metadata: map[string]any{"agent": m.agent},
 	})
 
 	slog.Info("Subagent announced result", "id", taskID, "status", status)
 }
 
-func (m *SubagentManager) buildPrompt() string {
+// statusText describes how a subagent ended.
+func statusText(status string) string {
+	switch status {
+	case "cancelled":
+		return "was cancelled"
+	case "timeout":
+		return "timed out"
+	case "interrupted":
+		return "was interrupted by a restart"
+	case "error":
+		return "failed"
+	}
+	return "completed successfully"
+}
+
+func (m *SubagentManager) buildPrompt(t *subagentTask, tools []string) string {
 	now := time.Now().Format("2006-01-02 15:04 (Monday)")
 	tz := time.Now().Format("MST")
+	goal := ""
+	if t.group != nil {
+		goal = fmt.Sprintf("\n## Shared Goal\nYou are one of %d subagents working in parallel toward this goal; the others handle the rest of it:\n%s\n",
+			len(t.group.members), t.group.goal)
+	}
 
 	return fmt.Sprintf(`# Subagent
 
@@ -215,7 +510,7 @@ func (m *SubagentManager) buildPrompt() string {
 %s (%s)
 
 You are a subagent spawned by the main agent to complete a specific task.
-
+%s
 ## Rules
 1. Stay focused — complete only the assigned task, nothing else
 2. Your final response will be reported back to the main agent
@@ -223,8 +518,7 @@ You are a subagent spawned by the main agent to complete a specific task.
 4. Be concise but informative in your findings
 
 ## What You Can Do
-- Read and write files in the workspace
-- Execute shell commands
+- Use these tools: %s
 - Complete the task thoroughly
 
 ## What You Cannot Do
@@ -234,44 +528,70 @@ You are a subagent spawned by the main agent to complete a specific task.
 
 ## Workspace
 %s
+Working directory: %s
 Skills: %s/skills/ (read SKILL.md files as needed)
 
 When you have completed the task, provide a clear summary of your findings or actions.`,
-		now, tz, m.workspace, m.workspace)
+		now, tz, goal, strings.Join(tools, ", "), m.workspace, t.workdir, m.workspace)
 }
 
-// processSystemMessage is called by the main loop to handle subagent completion announcements.
-// It runs the LLM on the announce content in the context of the origin session
-// and returns a user-facing response.
-func ProcessSystemMessage(
-	ctx context.Context,
-	provider llm.Provider,
-	model string,
-	contextBuilder *ContextBuilder,
-	tools *tool.Registry,
-	chatID string,
-	content string,
-	maxIterations int,
-) (originChannel, originChatID, response string) {
-	// Parse origin from chat_id (format: "channel:chat_id")
-	originChannel = "cli"
-	originChatID = chatID
-	if i := strings.Index(chatID, ":"); i >= 0 {
-		originChannel = chatID[:i]
-		originChatID = chatID[i+1:]
-	}
-
-	messages := contextBuilder.BuildMessages(nil, content, originChannel, originChatID)
+// processSystemMessage handles msg, a subagent announcement, in sess, the
+// active session of the chat that spawned the subagent, which the caller
+// has locked. The session's model answers after its history, within the
+// session's budget, with tools defaulting to that chat; the announcement
+// and answer are saved to the session so later turns know what the
+// subagent found.
+func (l *Loop) processSystemMessage(ctx context.Context, sess *session.Session, msg *bus.InboundMessage, channel, chatID string) (*bus.OutboundMessage, error) {
+	content := msg.Content
+	ctx, budget := l.budgets.startTurn(ctx, sess.Key, channel)
+	defer budget.finish()
+
+	ec := tool.ExecContext{
+		Channel:    channel,
+		ChatID:     chatID,
+		SessionKey: sess.Key,
+		Workspace:  l.workspace,
+	}
+
+	messages := l.context.BuildMessages(sess.GetHistory(l.memoryWindow, l.toolHistory), content, nil, channel, chatID)
 
 	var finalContent string
-	for i := 0; i < maxIterations; i++ {
-		resp, err := chatWithRetry(ctx, provider, llm.ChatRequest{
-			Messages: messages,
-			Tools:    tools.Definitions(),
-			Model:    model,
-		})
+	var transcript []session.Message
+	var toolsUsed []string
+	// A newer message of the chat, or a shutdown, cuts the turn short: the
+	// announcement and the steps so far stay in the history, and nothing
+	// is sent.
+	interrupted := func() (*bus.OutboundMessage, error) {
+		slog.Info("Subagent result interrupted", "session", sess.Key, "steps", len(toolsUsed))
+		recordInterrupted(sess, content, nil, completeToolCalls(transcript), nil, toolsUsed)
+		l.sessions.Save(sess)
+		return nil, ctx.Err()
+	}
+	for i := 0; i < l.maxIterations; i++ {
+		if ctx.Err() != nil {
+			return interrupted()
+		}
+		// Over budget, the result is kept for later turns unsummarized.
+		if reason := budget.exceeded(); reason != "" {
+			slog.Info("Subagent result not summarized: over budget", "session", sess.Key, "reason", reason)
+			finalContent = fmt.Sprintf("A background task has finished, but I can't go through its result now because %s. It is kept in our conversation.", reason)
+			break
+		}
+		role := l.sessionRole(sess)
+		req := role.request(messages, l.tools.Definitions())
+		req.ThinkingBudget = l.thinkingBudget
+		req.ReasoningEffort = l.reasoningEffort
+		resp, err := l.chat(ctx, msg, role.Provider, sess.ShowReasoning, req)
+		if ctx.Err() != nil {
+			return interrupted()
+		}
 		if err != nil {
-			return originChannel, originChatID, fmt.Sprintf("Error processing subagent result: %s", err)
+			// Keep the result in the history even if it was not summarized.
+			slog.Error("processing subagent result", "session", sess.Key, "err", err)
+			sess.AddMessage("user", content)
+			sess.AddSteps(transcript)
+			l.sessions.Save(sess)
+			return &bus.OutboundMessage{Channel: channel, ChatID: chatID, Content: userErrorMessage(err)}, nil
 		}
 
 		if !resp.HasToolCalls() {
@@ -279,37 +599,42 @@ func ProcessSystemMessage(
 			break
 		}
 
-		toolCallDicts := make([]map[string]any, len(resp.ToolCalls))
-		for j, tc := range resp.ToolCalls {
-			argsJSON, _ := json.Marshal(tc.Arguments)
-			toolCallDicts[j] = map[string]any{
-				"id":   tc.ID,
-				"type": "function",
-				"function": map[string]any{
-					"name":      tc.Name,
-					"arguments": string(argsJSON),
-				},
-			}
-		}
-		msg := map[string]any{"role": "assistant", "content": resp.Content}
-		if len(toolCallDicts) > 0 {
-			msg["tool_calls"] = toolCallDicts
-		}
-		messages = append(messages, msg)
+		messages = l.context.AddAssistantMessage(messages, resp.Content, toolCallDicts(resp.ToolCalls), resp.ReasoningContent, resp.ThinkingBlocks)
+		transcript = append(transcript, session.NewToolCallMessage(resp.Content, sessionToolCalls(resp.ToolCalls)))
 
 		for _, tc := range resp.ToolCalls {
-			result := tools.Execute(ctx, tc.Name, tc.Arguments)
-			messages = append(messages, map[string]any{
-				"role":         "tool",
-				"tool_call_id": tc.ID,
-				"name":         tc.Name,
-				"content":      result.Content,
-			})
+			if ctx.Err() != nil {
+				break
+			}
+			var result tool.ToolResult
+			if reason := budget.toolExceeded(tc.Name); reason != "" {
+				result.Content = fmt.Sprintf("Error: %s was not run because %s. Answer with what you have.", tc.Name, reason)
+			} else {
+				budget.useTool(tc.Name)
+				result = l.tools.Execute(ctx, ec, tc.Name, tc.Arguments)
+			}
+			toolsUsed = append(toolsUsed, tc.Name)
+			messages = l.context.AddToolResult(messages, tc.ID, tc.Name, result.Content)
+			transcript = append(transcript, session.NewToolResultMessage(tc.ID, tc.Name, truncate(result.Content, l.toolResultChars), result.Media))
 		}
 	}
+	if ctx.Err() != nil {
+		return interrupted()
+	}
 
 	if finalContent == "" {
 		finalContent = "Background task completed."
 	}
-	return originChannel, originChatID, finalContent
+
+	// The announcement stands in for the user message of the exchange.
+	sess.AddMessage("user", content)
+	sess.AddSteps(transcript)
+	sess.AddMessage("assistant", finalContent, toolsUsed...)
+	l.sessions.Save(sess)
+
+	reply := finalContent
+	if note := budget.warning(); note != "" {
+		reply += "\n\n" + note
+	}
+	return &bus.OutboundMessage{Channel: channel, ChatID: chatID, Content: reply}, nil
 }
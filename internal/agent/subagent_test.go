@@ -0,0 +1,446 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/joebot/nagobot/internal/bus"
+	"github.com/joebot/nagobot/internal/llm"
+	"github.com/joebot/nagobot/internal/session"
+	"github.com/joebot/nagobot/internal/tool"
+	"github.com/joebot/nagobot/internal/usage"
+)
+
+// hangProvider asks for one tool call, then blocks until the request is
+// cancelled.
+type hangProvider struct{ calls atomic.Int32 }
+
+func (p *hangProvider) Chat(ctx context.Context, _ llm.ChatRequest) (*llm.ChatResponse, error) {
+	if p.calls.Add(1) == 1 {
+		return &llm.ChatResponse{ToolCalls: []llm.ToolCallRequest{{ID: "c1", Name: "list_dir", Arguments: map[string]any{"path": "."}}}}, nil
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (p *hangProvider) ChatStream(ctx context.Context, req llm.ChatRequest, _ llm.StreamHandler) (*llm.ChatResponse, error) {
+	return p.Chat(ctx, req)
+}
+
+func (p *hangProvider) DefaultModel() string { return "hang" }
+
+func TestSubagentControl(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	b := bus.NewMessageBus()
+	p := &hangProvider{}
+	loop := NewLoop(LoopConfig{Bus: b, Provider: p, Workspace: t.TempDir()})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	started, err := loop.subagents.Spawn(ctx, tool.SpawnRequest{Task: "look around", Label: "explore", Channel: "cli", ChatID: "sub"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := regexp.MustCompile(`id: (\w+)`).FindStringSubmatch(started)[1]
+	// The spawning turn ends; the subagent carries on.
+	cancel()
+	for p.calls.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	list, _ := loop.ProcessDirect(context.Background(), "/tasks", "cli:sub")
+	if !strings.Contains(list, id+" [explore]") || !strings.Contains(list, "2 iterations, last tool: list_dir") {
+		t.Errorf("/tasks = %q", list)
+	}
+	if other := loop.subagents.List("cli:other"); other != "No subagents are running." {
+		t.Errorf("other chat sees %q", other)
+	}
+	if _, err := loop.subagents.Transcript("cli:other", id); err == nil {
+		t.Error("other chat can read the transcript")
+	}
+	if transcript, _ := loop.ProcessDirect(context.Background(), "/tasks show "+id, "cli:sub"); !strings.Contains(transcript, "- list_dir") {
+		t.Errorf("transcript = %q", transcript)
+	}
+
+	loop.ProcessDirect(context.Background(), "/tasks cancel "+id, "cli:sub")
+	select {
+	case in := <-b.Inbound:
+		if in.ChatID != "cli:sub" || !strings.Contains(in.Content, "'explore' was cancelled") || !strings.Contains(in.Content, "list_dir") {
+			t.Errorf("announcement = %+v", in)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no announcement after cancel")
+	}
+	if n := loop.subagents.RunningCount(); n != 0 {
+		t.Errorf("%d subagents still running", n)
+	}
+}
+
+func TestSpawnPolicy(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	workspace := t.TempDir()
+	os.Mkdir(filepath.Join(workspace, "repo"), 0o755)
+	p := &scriptProvider{}
+	loop := NewLoop(LoopConfig{
+		Bus:       bus.NewMessageBus(),
+		Provider:  p,
+		Workspace: workspace,
+		Spawn: SpawnPolicy{
+			Profiles:      map[string][]string{"reader": {"read_file"}},
+			Models:        map[string]ModelRole{"fast": {Model: "fast-model"}},
+			MaxIterations: 5,
+			Timeout:       time.Minute,
+		},
+	})
+	m := loop.subagents
+
+	task, notes, err := m.prepare(tool.SpawnRequest{Task: "t", Profile: "reader", Model: "fast", MaxIterations: 50, Timeout: time.Hour, Workdir: "repo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.maxIterations != 5 || task.timeout != time.Minute || task.role.Model != "fast-model" || task.workdir != filepath.Join(workspace, "repo") {
+		t.Errorf("task = %+v", task)
+	}
+	if len(notes) != 2 {
+		t.Errorf("notes = %q, want both caps reported", notes)
+	}
+	if task, _, _ := m.prepare(tool.SpawnRequest{Task: "t", MaxIterations: 3}); task.maxIterations != 3 || task.profile != "default" {
+		t.Errorf("smaller request: %+v", task)
+	}
+	for _, req := range []tool.SpawnRequest{
+		{Task: "t", Profile: "admin"},
+		{Task: "t", Model: "huge"},
+		{Task: "t", Workdir: "../elsewhere"},
+		{Task: "t", Workdir: "missing"},
+	} {
+		if _, _, err := m.prepare(req); err == nil {
+			t.Errorf("%+v was allowed", req)
+		}
+	}
+
+	// The profile picks the subagent's tools from the loop's.
+	task, _, _ = m.prepare(tool.SpawnRequest{Task: "find out", Profile: "research", Channel: "cli", ChatID: "x"})
+	m.executeTask(context.Background(), tool.ExecContext{}, task)
+	var names []string
+	for _, def := range p.requests[0].Tools {
+		names = append(names, def["function"].(map[string]any)["name"].(string))
+	}
+	slices.Sort(names)
+	if want := []string{"list_dir", "read_file", "web_fetch"}; !slices.Equal(names, want) {
+		t.Errorf("research tools = %q, want %q", names, want)
+	}
+}
+
+func TestSubagentResume(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	workspace := t.TempDir()
+	b1 := bus.NewMessageBus()
+	p1 := &hangProvider{}
+	first := NewLoop(LoopConfig{Bus: b1, Provider: p1, Workspace: workspace, SubagentsDir: dir})
+	started, _ := first.subagents.Spawn(context.Background(), tool.SpawnRequest{Task: "dig", Label: "dig", Channel: "cli", ChatID: "r"})
+	id := regexp.MustCompile(`id: (\w+)`).FindStringSubmatch(started)[1]
+	for p1.calls.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Keep the record as a crash would leave it, then stop the subagent.
+	crashed, err := LoadSubagentRun(dir, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crashed.Status != "running" || crashed.Iterations != 1 || len(crashed.Messages) != 4 {
+		t.Fatalf("saved run = %+v", crashed)
+	}
+	first.subagents.Cancel("cli:r", id)
+	<-b1.Inbound
+	saveSubagentRun(dir, crashed)
+	gone := *crashed
+	gone.ID, gone.Profile = "gone", "retired"
+	saveSubagentRun(dir, &gone)
+
+	b2 := bus.NewMessageBus()
+	p2 := &scriptProvider{responses: []*llm.ChatResponse{{Content: "found it"}}}
+	second := NewLoop(LoopConfig{Bus: b2, Provider: p2, Workspace: workspace, SubagentsDir: dir})
+	second.AddHooks(Hooks{AfterMessage: func(_ context.Context, msg *bus.OutboundMessage) error {
+		msg.Content = "[hooked] " + msg.Content
+		return nil
+	}})
+	second.subagents.resume()
+
+	// The notice goes through the message hooks like any reply.
+	if out := <-b2.Outbound; !strings.HasPrefix(out.Content, "[hooked] ") || !strings.Contains(out.Content, "[dig]") {
+		t.Errorf("resume notice = %q", out.Content)
+	}
+	var announced []string
+	for range 2 {
+		select {
+		case in := <-b2.Inbound:
+			announced = append(announced, in.Content)
+		case <-time.After(5 * time.Second):
+			t.Fatal("missing announcement")
+		}
+	}
+	joined := strings.Join(announced, "\n")
+	if !strings.Contains(joined, "'dig' was interrupted by a restart") || !strings.Contains(joined, "'dig' completed successfully") {
+		t.Errorf("announcements = %q", announced)
+	}
+	if n := len(p2.requests[0].Messages); n != 4 {
+		t.Errorf("resumed with %d messages, want the 4 saved", n)
+	}
+	if run, _ := LoadSubagentRun(dir, id); run.Status != "ok" || run.Iterations != 2 || run.Result != "found it" {
+		t.Errorf("finished run = %+v", run)
+	}
+	if runs, _ := LoadSubagentRuns(dir); len(runs) != 2 {
+		t.Errorf("history has %d runs, want 2", len(runs))
+	}
+}
+
+func TestSubagentGroup(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	b := bus.NewMessageBus()
+	release := make(chan struct{})
+	defer close(release)
+	loop := NewLoop(LoopConfig{Bus: b, Provider: gateProvider{release}, Workspace: t.TempDir(), SubagentsDir: dir,
+		Spawn: SpawnPolicy{MaxGroupSize: 2}})
+	m := loop.subagents
+
+	if _, err := m.SpawnGroup(context.Background(), tool.SpawnGroupRequest{Goal: "g", Members: make([]tool.SpawnRequest, 3)}); err == nil {
+		t.Error("group larger than the policy allows was spawned")
+	}
+
+	started, err := m.SpawnGroup(context.Background(), tool.SpawnGroupRequest{
+		Goal: "compare the options", Label: "survey", Channel: "cli", ChatID: "g", Timeout: 200 * time.Millisecond,
+		Members: []tool.SpawnRequest{
+			{Task: "fast", Label: "quick one", Channel: "cli", ChatID: "g"},
+			{Task: "slow", Label: "slow one", Channel: "cli", ChatID: "g"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := regexp.MustCompile(`id: (\w+)`).FindStringSubmatch(started)[1]
+
+	// One announcement once the slow member runs out of time.
+	select {
+	case in := <-b.Inbound:
+		for _, want := range []string{"[Subagent group 'survey' finished: 1 completed successfully, 1 timed out]",
+			"Goal: compare the options", "1. quick one (completed successfully)", "2. slow one (timed out)"} {
+			if !strings.Contains(in.Content, want) {
+				t.Errorf("announcement lacks %q:\n%s", want, in.Content)
+			}
+		}
+		if in.ChatID != "cli:g" {
+			t.Errorf("announced to %q", in.ChatID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no group announcement")
+	}
+	select {
+	case in := <-b.Inbound:
+		t.Errorf("second announcement: %s", in.Content)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	runs, _ := LoadSubagentRuns(dir)
+	if len(runs) != 2 || runs[0].Group != group || runs[1].Group != group {
+		t.Errorf("runs = %+v", runs)
+	}
+	groups, _ := loadSubagentGroups(dir)
+	if len(groups) != 1 || groups[0].Status != "done" || len(groups[0].Members) != 2 || groups[0].Deadline.IsZero() {
+		t.Errorf("groups = %+v", groups)
+	}
+}
+
+// stuckProvider blocks until release is closed, ignoring cancellation.
+type stuckProvider struct{ release chan struct{} }
+
+func (p stuckProvider) Chat(context.Context, llm.ChatRequest) (*llm.ChatResponse, error) {
+	<-p.release
+	return &llm.ChatResponse{Content: "done"}, nil
+}
+
+func (p stuckProvider) ChatStream(ctx context.Context, req llm.ChatRequest, _ llm.StreamHandler) (*llm.ChatResponse, error) {
+	return p.Chat(ctx, req)
+}
+
+func (p stuckProvider) DefaultModel() string { return "stuck" }
+
+func TestSubagentGroupDeadline(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	b := bus.NewMessageBus()
+	release := make(chan struct{})
+	defer close(release)
+	loop := NewLoop(LoopConfig{Bus: b, Provider: stuckProvider{release}, Workspace: t.TempDir(),
+		Spawn: SpawnPolicy{GroupTimeout: 100 * time.Millisecond}})
+	m := loop.subagents
+	m.groupGrace = 50 * time.Millisecond
+
+	// No deadline is asked for, so the configured one applies, and a
+	// member that ignores it is reported once the grace period is over.
+	started, err := m.SpawnGroup(context.Background(), tool.SpawnGroupRequest{
+		Goal: "g", Label: "stuck", Channel: "cli", ChatID: "g",
+		Members: []tool.SpawnRequest{{Task: "hang", Channel: "cli", ChatID: "g"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(started, "deadline of 100ms") {
+		t.Errorf("started = %q", started)
+	}
+	select {
+	case in := <-b.Inbound:
+		if !strings.Contains(in.Content, "finished: 1 timed out") || !strings.Contains(in.Content, "Still running at the group's deadline") {
+			t.Errorf("announcement:\n%s", in.Content)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no announcement after the deadline")
+	}
+}
+
+func TestSubagentResultInHistory(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	p := &scriptProvider{responses: []*llm.ChatResponse{
+		{ToolCalls: []llm.ToolCallRequest{{ID: "c1", Name: "list_dir", Arguments: map[string]any{"path": "."}}}},
+		{Content: "The answer is 42."},
+	}}
+	loop := NewLoop(LoopConfig{Bus: bus.NewMessageBus(), Provider: p, Workspace: t.TempDir()})
+	loop.ProcessDirect(context.Background(), "/session switch research", "cli:h")
+
+	out, err := loop.processMessage(context.Background(), &bus.InboundMessage{
+		Channel: "system", SenderID: "subagent", ChatID: "cli:h",
+		Content: "[Subagent 'count' completed successfully]\n\nResult:\nFound 42 files.",
+	})
+	if err != nil || out.Channel != "cli" || out.ChatID != "h" || out.Content != "The answer is 42." {
+		t.Fatalf("reply = %+v, %v", out, err)
+	}
+
+	// The next turn of the chat's active conversation sees the result.
+	loop.ProcessDirect(context.Background(), "great, now delete them", "cli:h")
+	var history []string
+	for _, m := range p.requests[len(p.requests)-1].Messages {
+		history = append(history, llm.ContentText(m["content"]))
+	}
+	text := strings.Join(history, "\n")
+	for _, want := range []string{"Found 42 files.", "The answer is 42.", "great, now delete them"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("history lacks %q:\n%s", want, text)
+		}
+	}
+	if sess := loop.sessions.GetOrCreate(loop.sessions.Active("cli:h")); session.ConversationName(sess.Key) != "research" {
+		t.Errorf("saved to %s, want the active conversation", sess.Key)
+	}
+}
+
+func TestSubagentResultFollowsSession(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	b := bus.NewMessageBus()
+	primary := &scriptProvider{responses: []*llm.ChatResponse{{Content: "Summarized."}}}
+	utility := &scriptProvider{}
+	budgets := &Budgets{}
+	loop := NewLoop(LoopConfig{Bus: b, Provider: primary, Utility: ModelRole{Provider: utility}, Workspace: t.TempDir(), Budgets: budgets})
+	announce := func() *bus.InboundMessage {
+		return &bus.InboundMessage{Channel: "system", SenderID: "subagent", ChatID: "cli:s", Content: "[Subagent 'x' completed successfully]"}
+	}
+
+	// The session's model answers, not the utility one.
+	out, err := loop.processMessage(context.Background(), announce())
+	if err != nil || out.Content != "Summarized." || len(primary.requests) != 1 || len(utility.requests) != 0 {
+		t.Fatalf("reply = %+v, %v; primary %d, utility %d requests", out, err, len(primary.requests), len(utility.requests))
+	}
+
+	// Over budget, the result is kept without calling the model.
+	budgets.Turn = usage.Limits{Time: time.Nanosecond}
+	out, _ = loop.processMessage(context.Background(), announce())
+	if !strings.Contains(out.Content, "budget is used up") || len(primary.requests) != 1 {
+		t.Errorf("over budget: reply = %q, %d requests", out.Content, len(primary.requests))
+	}
+	budgets.Turn = usage.Limits{}
+
+	// A running turn, here of another process, comes first: the
+	// announcement is held until a turn of the chat ends without one.
+	key := loop.sessions.Active("cli:s")
+	loop.sessions.SaveCheckpoint(&session.Checkpoint{Key: key, Channel: "cli", ChatID: "s", Status: session.CheckpointRunning, Content: "work"})
+	if out, err := loop.processMessage(context.Background(), announce()); out != nil || err != nil {
+		t.Errorf("with a running turn: reply = %+v, %v", out, err)
+	}
+	if len(primary.requests) != 1 || len(b.Inbound) != 0 {
+		t.Errorf("held announcement: %d requests, %d queued", len(primary.requests), len(b.Inbound))
+	}
+	loop.ProcessDirect(context.Background(), "/usage", "cli:s")
+	if len(b.Inbound) != 0 {
+		t.Error("announcement released while the turn still runs")
+	}
+	loop.ProcessDirect(context.Background(), "next", "cli:s")
+	select {
+	case in := <-b.Inbound:
+		if in.Channel != "system" || in.ChatID != "cli:s" {
+			t.Errorf("released %+v", in)
+		}
+	default:
+		t.Fatal("announcement was not released after the next turn")
+	}
+}
+
+// failProvider fails every request with err.
+type failProvider struct{ err error }
+
+func (p failProvider) Chat(context.Context, llm.ChatRequest) (*llm.ChatResponse, error) {
+	return nil, p.err
+}
+
+func (p failProvider) ChatStream(ctx context.Context, req llm.ChatRequest, _ llm.StreamHandler) (*llm.ChatResponse, error) {
+	return p.Chat(ctx, req)
+}
+
+func (p failProvider) DefaultModel() string { return "fail" }
+
+func TestSubagentResultInterrupted(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	p := &hangProvider{}
+	loop := NewLoop(LoopConfig{Bus: bus.NewMessageBus(), Provider: p, Workspace: t.TempDir()})
+	announce := &bus.InboundMessage{Channel: "system", SenderID: "subagent", ChatID: "cli:i", Content: "[Subagent 'x' completed successfully]"}
+
+	// A newer message cuts the turn short: nothing is sent, and the
+	// announcement and its step are kept.
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for p.calls.Load() < 2 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	out, err := loop.processMessage(ctx, announce)
+	if out != nil || !errors.Is(err, context.Canceled) {
+		t.Fatalf("interrupted: reply = %+v, %v", out, err)
+	}
+	history := loop.sessions.GetOrCreate(loop.sessions.Active("cli:i")).GetHistory(50, session.ToolDetailFull)
+	var text []string
+	for _, m := range history {
+		text = append(text, llm.ContentText(m["content"]))
+	}
+	joined := strings.Join(text, "\n")
+	for _, want := range []string{"[Subagent 'x' completed successfully]", "[Interrupted by a newer message"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("history lacks %q:\n%s", want, joined)
+		}
+	}
+	if len(history) != 4 {
+		t.Errorf("history has %d messages, want the announcement, call, result and note", len(history))
+	}
+
+	// A failure is reported like one of a turn, without the raw error.
+	loop = NewLoop(LoopConfig{Bus: bus.NewMessageBus(), Provider: failProvider{&llm.APIError{Kind: llm.ErrAuth, Provider: "test", StatusCode: 401, Message: "bad key"}}, Workspace: t.TempDir()})
+	out, err = loop.processMessage(context.Background(), announce)
+	if err != nil || out.ChatID != "i" || out.Content != userErrorMessage(llm.ErrAuth) {
+		t.Errorf("failure: reply = %+v, %v", out, err)
+	}
+}
@@ -0,0 +1,363 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joebot/nagobot/internal/bus"
+	"github.com/joebot/nagobot/internal/tool"
+	"github.com/joebot/nagobot/internal/usage"
+)
+
+// subagentGroup is a set of subagents working in parallel toward a shared
+// goal. Their results are announced together once the last one has
+// finished.
+type subagentGroup struct {
+	id, label, goal string
+	channel, chatID string // origin chat
+	started         time.Time
+	deadline        time.Time // members still running then are stopped
+	members         []*subagentTask
+
+	mu        sync.Mutex
+	pending   int         // members still running
+	announced bool        // the result was delivered
+	timer     *time.Timer // announces the group if a member outlives the deadline
+}
+
+// subagentGroupRun is the saved record of a group, kept in the groups
+// directory next to the runs of its members.
+type subagentGroupRun struct {
+	ID       string    `json:"id"`
+	Label    string    `json:"label"`
+	Goal     string    `json:"goal"`
+	Agent    string    `json:"agent"`
+	Channel  string    `json:"channel"`
+	ChatID   string    `json:"chat_id"`
+	Members  []string  `json:"members"`
+	Status   string    `json:"status"` // running until the result is announced, then done
+	Started  time.Time `json:"started"`
+	Deadline time.Time `json:"deadline"`
+	Finished time.Time `json:"finished"`
+}
+
+// SpawnGroup starts the subagents of a group in the background. It
+// returns a status message immediately; the combined result is announced
+// once every member has finished or run out of time.
+func (m *SubagentManager) SpawnGroup(ctx context.Context, req tool.SpawnGroupRequest) (string, error) {
+	if len(req.Members) == 0 {
+		return "", fmt.Errorf("a group needs at least one task")
+	}
+	if len(req.Members) > m.maxGroupSize {
+		return "", fmt.Errorf("a group can have at most %d subagents, not %d", m.maxGroupSize, len(req.Members))
+	}
+	g := &subagentGroup{
+		id:      newTaskID(),
+		label:   req.Label,
+		goal:    req.Goal,
+		channel: req.Channel,
+		chatID:  req.ChatID,
+		started: time.Now(),
+	}
+	if g.label == "" {
+		g.label = shortLabel(g.goal)
+	}
+	// A group always has a deadline, so one stuck member cannot hold back
+	// the result of the others.
+	var notes []string
+	timeout := m.groupTimeout
+	if d := req.Timeout; d > m.groupTimeout {
+		notes = append(notes, fmt.Sprintf("Group deadline capped at %s.", m.groupTimeout))
+	} else if d > 0 {
+		timeout = d
+	}
+	g.deadline = g.started.Add(timeout)
+
+	// Every member is checked before any starts.
+	session := usage.TagsFrom(ctx).Session
+	for i, r := range req.Members {
+		t, n, err := m.prepare(r)
+		if err != nil {
+			return "", fmt.Errorf("task %d: %w", i+1, err)
+		}
+		for _, note := range n {
+			if !slices.Contains(notes, note) {
+				notes = append(notes, note)
+			}
+		}
+		t.id = newTaskID()
+		if t.label == "" {
+			t.label = shortLabel(t.task)
+		}
+		t.session = session
+		t.group = g
+		g.members = append(g.members, t)
+	}
+	g.pending = len(g.members)
+	m.saveGroup(g, "running")
+
+	ctx = context.WithoutCancel(ctx)
+	for _, t := range g.members {
+		m.start(ctx, t)
+	}
+	m.watchGroup(g)
+
+	slog.Info("Spawned subagent group", "id", g.id, "label", g.label, "members", len(g.members))
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Group [%s] started (id: %s) with %d subagents:\n", g.label, g.id, len(g.members))
+	for _, t := range g.members {
+		fmt.Fprintf(&sb, "- %s [%s], profile %s\n", t.id, t.label, t.profile)
+	}
+	fmt.Fprintf(&sb, "They run up to %d iterations each, with a deadline of %s for the group. I'll report their results together once all have finished.",
+		g.members[0].maxIterations, timeout)
+	if len(notes) > 0 {
+		sb.WriteString(" " + strings.Join(notes, " "))
+	}
+	return sb.String(), nil
+}
+
+// groupMembers returns the running members of the group id spawned from
+// chat.
+func (m *SubagentManager) groupMembers(chat, id string) []*subagentTask {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var tasks []*subagentTask
+	for _, t := range m.tasks {
+		if t.group != nil && t.group.id == id && t.chat == chat {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks
+}
+
+// watchGroup arranges for g to be announced shortly after its deadline,
+// should a member still be running then. Members stop at the deadline by
+// themselves, so this only matters for one stuck in a tool that ignores
+// cancellation.
+func (m *SubagentManager) watchGroup(g *subagentGroup) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.timer = time.AfterFunc(time.Until(g.deadline)+m.groupGrace, func() { m.expireGroup(g) })
+}
+
+// expireGroup stops the members of g that outlived its deadline, reports
+// them as timed out and announces the group.
+func (m *SubagentManager) expireGroup(g *subagentGroup) {
+	g.mu.Lock()
+	if g.announced {
+		g.mu.Unlock()
+		return
+	}
+	g.announced = true
+	g.mu.Unlock()
+	for _, t := range g.members {
+		t.mu.Lock()
+		if t.status == "running" {
+			t.status = "timeout"
+			t.result = fmt.Sprintf("Still running at the group's deadline after %d iterations. Progress so far:\n%s", t.iterations, stepsText(t.steps))
+		}
+		t.mu.Unlock()
+		if t.cancel != nil {
+			t.cancel()
+		}
+	}
+	slog.Warn("Subagent group passed its deadline", "id", g.id, "label", g.label)
+	m.announceGroup(g)
+}
+
+// finishMember records that a member of a group has ended, and announces
+// the group once it was the last one.
+func (m *SubagentManager) finishMember(t *subagentTask) {
+	g := t.group
+	g.mu.Lock()
+	g.pending--
+	done := g.pending == 0 && !g.announced
+	if done {
+		g.announced = true
+		if g.timer != nil {
+			g.timer.Stop()
+		}
+	}
+	g.mu.Unlock()
+	slog.Info("Subagent group member finished", "group", g.id, "id", t.id, "status", t.status)
+	if done {
+		m.announceGroup(g)
+	}
+}
+
+// announceGroup delivers the results of every member of g to the origin
+// session as one system message.
+func (m *SubagentManager) announceGroup(g *subagentGroup) {
+	var counts []string
+	tally := map[string]int{}
+	var sb strings.Builder
+	for i, t := range g.members {
+		t.mu.Lock()
+		status, result := t.status, t.result
+		t.mu.Unlock()
+		text := statusText(status)
+		if tally[text] == 0 {
+			counts = append(counts, text)
+		}
+		tally[text]++
+		fmt.Fprintf(&sb, "\n\n## %d. %s (%s)\n\nTask: %s\n\nResult:\n%s", i+1, t.label, text, t.task, result)
+	}
+	for i, text := range counts {
+		counts[i] = fmt.Sprintf("%d %s", tally[text], text)
+	}
+
+	content := fmt.Sprintf(`[Subagent group '%s' finished: %s]
+
+Goal: %s%s
+
+Combine these results into one coherent summary for the user, saying what is left undone if some did not complete. Do not mention technical details like "subagent", groups or task IDs.`,
+		g.label, strings.Join(counts, ", "), g.goal, sb.String())
+
+	m.saveGroup(g, "done")
+	m.bus.PublishInbound(&bus.InboundMessage{
+		Channel:  "system",
+		SenderID: "subagent",
+		ChatID:   fmt.Sprintf("%s:%s", g.channel, g.chatID),
+		Content:  content,
+		Metadata: map[string]any{"agent": m.agent},
+	})
+	slog.Info("Subagent group announced result", "id", g.id, "members", len(g.members))
+}
+
+// saveGroup writes the record of g. A failure is logged, like one of a
+// member's run.
+func (m *SubagentManager) saveGroup(g *subagentGroup, status string) {
+	if m.dir == "" {
+		return
+	}
+	run := &subagentGroupRun{
+		ID:       g.id,
+		Label:    g.label,
+		Goal:     g.goal,
+		Agent:    m.agent,
+		Channel:  g.channel,
+		ChatID:   g.chatID,
+		Status:   status,
+		Started:  g.started,
+		Deadline: g.deadline,
+	}
+	for _, t := range g.members {
+		run.Members = append(run.Members, t.id)
+	}
+	if status == "done" {
+		run.Finished = time.Now()
+	}
+	if err := writeRecord(filepath.Join(m.dir, "groups"), g.id, run); err != nil {
+		slog.Warn("Failed to save subagent group", "id", g.id, "err", err)
+	}
+}
+
+// loadSubagentGroups reads the group records saved in dir.
+func loadSubagentGroups(dir string) ([]*subagentGroupRun, error) {
+	dir = filepath.Join(dir, "groups")
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var groups []*subagentGroupRun
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		var g subagentGroupRun
+		if err == nil {
+			err = json.Unmarshal(data, &g)
+		}
+		if err != nil {
+			slog.Warn("Skipping unreadable subagent group", "file", e.Name(), "err", err)
+			continue
+		}
+		groups = append(groups, &g)
+	}
+	return groups, nil
+}
+
+// resumeGroups restarts the groups of this agent that were running when
+// the process stopped. Members that already finished keep their result;
+// one that cannot be resumed counts as interrupted.
+func (m *SubagentManager) resumeGroups(runs []*SubagentRun) {
+	groups, err := loadSubagentGroups(m.dir)
+	if err != nil {
+		slog.Warn("Failed to load subagent groups", "err", err)
+		return
+	}
+	byID := make(map[string]*SubagentRun, len(runs))
+	for _, run := range runs {
+		byID[run.ID] = run
+	}
+	for _, gr := range groups {
+		if gr.Agent != m.agent || gr.Status != "running" {
+			continue
+		}
+		g := &subagentGroup{
+			id:       gr.ID,
+			label:    gr.Label,
+			goal:     gr.Goal,
+			channel:  gr.Channel,
+			chatID:   gr.ChatID,
+			started:  gr.Started,
+			deadline: gr.Deadline,
+		}
+		if g.deadline.IsZero() {
+			g.deadline = g.started.Add(m.groupTimeout)
+		}
+		var restart []*subagentTask
+		for _, id := range gr.Members {
+			run := byID[id]
+			if run == nil {
+				slog.Warn("Subagent group member has no saved run", "group", g.id, "id", id)
+				continue
+			}
+			if run.Status == "running" {
+				t, err := m.restore(run)
+				if err == nil {
+					t.group = g
+					g.members = append(g.members, t)
+					restart = append(restart, t)
+					continue
+				}
+				m.interrupt(run, err)
+			}
+			g.members = append(g.members, &subagentTask{
+				id:     run.ID,
+				label:  run.Label,
+				task:   run.Task,
+				status: run.Status,
+				result: run.Result,
+			})
+		}
+		g.pending = len(restart)
+		if len(restart) == 0 {
+			m.announceGroup(g)
+			continue
+		}
+
+		slog.Info("Resuming subagent group", "id", g.id, "label", g.label, "members", len(restart))
+		for _, t := range restart {
+			m.start(usage.WithSession(context.Background(), t.session, t.channel), t)
+		}
+		m.watchGroup(g)
+		m.publish(&bus.OutboundMessage{
+			Channel: g.channel,
+			ChatID:  g.chatID,
+			Content: fmt.Sprintf("I was restarted while the background group [%s] was running; %d of its %d tasks carry on.", g.label, len(restart), len(g.members)),
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joebot/nagobot/internal/bus"
+	"github.com/joebot/nagobot/internal/usage"
+)
+
+// SubagentRun is the saved record of a subagent. It is written after every
+// step, so a subagent can be resumed after a restart, and kept once the
+// subagent finishes as the history of its run.
+type SubagentRun struct {
+	ID      string `json:"id"`
+	Label   string `json:"label"`
+	Task    string `json:"task"`
+	Agent   string `json:"agent"`   // profile whose loop spawned it
+	Session string `json:"session"` // charged for usage and budgets
+	Channel string `json:"channel"` // origin chat
+	ChatID  string `json:"chat_id"`
+	Group   string `json:"group,omitempty"` // id of its group, if any
+
+	Profile       string        `json:"profile"`
+	Model         string        `json:"model,omitempty"` // model role; empty is the subagent model
+	MaxIterations int           `json:"max_iterations"`
+	Timeout       time.Duration `json:"timeout,omitempty"`
+	Workdir       string        `json:"workdir"`
+
+	Status     string           `json:"status"` // running, ok, error, cancelled, timeout or interrupted
+	Result     string           `json:"result,omitempty"`
+	Iterations int              `json:"iterations"`
+	Steps      []string         `json:"steps,omitempty"`
+	Messages   []map[string]any `json:"messages,omitempty"` // the LLM conversation after the last full step
+	Started    time.Time        `json:"started"`
+	Elapsed    time.Duration    `json:"elapsed"` // run time, across restarts
+	Finished   time.Time        `json:"finished"`
+}
+
+// LoadSubagentRuns reads the subagent runs saved in dir, newest first.
+func LoadSubagentRuns(dir string) ([]*SubagentRun, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var runs []*SubagentRun
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		run, err := LoadSubagentRun(dir, strings.TrimSuffix(e.Name(), ".json"))
+		if err != nil {
+			slog.Warn("Skipping unreadable subagent run", "file", e.Name(), "err", err)
+			continue
+		}
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Started.After(runs[j].Started) })
+	return runs, nil
+}
+
+// LoadSubagentRun reads the run of subagent id saved in dir.
+func LoadSubagentRun(dir, id string) (*SubagentRun, error) {
+	data, err := os.ReadFile(filepath.Join(dir, filepath.Base(id)+".json"))
+	if err != nil {
+		return nil, err
+	}
+	var run SubagentRun
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("decode subagent run %s: %w", id, err)
+	}
+	return &run, nil
+}
+
+func saveSubagentRun(dir string, run *SubagentRun) error {
+	return writeRecord(dir, run.ID, run)
+}
+
+// writeRecord saves v as dir/id.json.
+func writeRecord(dir, id string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode subagent record: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create subagent dir: %w", err)
+	}
+	// Write then rename, so a crash never leaves a torn record.
+	path := filepath.Join(dir, id+".json")
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return fmt.Errorf("write subagent record: %w", err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// record returns the saved form of t. The caller holds t.mu.
+func (t *subagentTask) record(agent string) *SubagentRun {
+	run := &SubagentRun{
+		ID:            t.id,
+		Label:         t.label,
+		Task:          t.task,
+		Agent:         agent,
+		Session:       t.session,
+		Channel:       t.channel,
+		ChatID:        t.chatID,
+		Profile:       t.profile,
+		Model:         t.model,
+		MaxIterations: t.maxIterations,
+		Timeout:       t.timeout,
+		Workdir:       t.workdir,
+		Status:        t.status,
+		Result:        t.result,
+		Iterations:    t.iterations,
+		Steps:         t.steps,
+		Messages:      t.messages,
+		Started:       t.started,
+		Elapsed:       t.prior + time.Since(t.since),
+		Finished:      t.finished,
+	}
+	if t.group != nil {
+		run.Group = t.group.id
+	}
+	return run
+}
+
+// save writes the run of t. A failure is logged: the subagent goes on, it
+// just cannot be resumed after a restart.
+func (m *SubagentManager) save(t *subagentTask) {
+	if m.dir == "" {
+		return
+	}
+	t.mu.Lock()
+	run := t.record(m.agent)
+	t.mu.Unlock()
+	if err := saveSubagentRun(m.dir, run); err != nil {
+		slog.Warn("Failed to save subagent run", "id", t.id, "err", err)
+	}
+}
+
+// resume restarts the subagents of this agent that were running when the
+// process stopped. One that cannot be resumed is reported to its chat as
+// interrupted.
+func (m *SubagentManager) resume() {
+	if m.dir == "" {
+		return
+	}
+	runs, err := LoadSubagentRuns(m.dir)
+	if err != nil {
+		slog.Warn("Failed to load subagent runs", "err", err)
+		return
+	}
+	for _, run := range runs {
+		// Members of a group are resumed with it.
+		if run.Agent != m.agent || run.Status != "running" || run.Group != "" {
+			continue
+		}
+		t, err := m.restore(run)
+		if err != nil {
+			m.interrupt(run, err)
+			m.announceResult(run.ID, run.Label, run.Task, run.Result, run.Channel, run.ChatID, run.Status)
+			continue
+		}
+
+		slog.Info("Resuming subagent", "id", t.id, "label", t.label, "iterations", t.iterations)
+		ctx := usage.WithSession(context.Background(), t.session, t.channel)
+		m.start(ctx, t)
+		m.publish(&bus.OutboundMessage{
+			Channel: t.channel,
+			ChatID:  t.chatID,
+			Content: fmt.Sprintf("I was restarted while the background task [%s] was running; it carries on from step %d.", t.label, t.iterations),
+		})
+	}
+	m.resumeGroups(runs)
+}
+
+// interrupt records that run could not be resumed after a restart.
+func (m *SubagentManager) interrupt(run *SubagentRun, reason error) {
+	slog.Info("Subagent interrupted by restart", "id", run.ID, "err", reason)
+	run.Status = "interrupted"
+	run.Result = fmt.Sprintf("Interrupted by a restart after %d iterations, and not resumed because %s. Progress so far:\n%s",
+		run.Iterations, reason, stepsText(run.Steps))
+	run.Finished = time.Now()
+	if err := saveSubagentRun(m.dir, run); err != nil {
+		slog.Warn("Failed to save subagent run", "id", run.ID, "err", err)
+	}
+}
+
+// restore rebuilds the task of a run saved before a restart, under the
+// current spawn policy.
+func (m *SubagentManager) restore(run *SubagentRun) (*subagentTask, error) {
+	t := &subagentTask{
+		id:            run.ID,
+		label:         run.Label,
+		task:          run.Task,
+		channel:       run.Channel,
+		chatID:        run.ChatID,
+		chat:          run.Channel + ":" + run.ChatID,
+		session:       run.Session,
+		started:       run.Started,
+		prior:         run.Elapsed,
+		profile:       run.Profile,
+		model:         run.Model,
+		role:          m.role,
+		maxIterations: run.MaxIterations,
+		timeout:       run.Timeout,
+		workdir:       run.Workdir,
+		iterations:    run.Iterations,
+		steps:         run.Steps,
+		messages:      run.Messages,
+	}
+	var ok bool
+	if t.tools, ok = m.profiles[t.profile]; !ok {
+		return nil, fmt.Errorf("its profile %q is no longer configured", t.profile)
+	}
+	if t.model != "" {
+		if t.role, ok = m.models[t.model]; !ok {
+			return nil, fmt.Errorf("its model %q is no longer configured", t.model)
+		}
+	}
+	if t.timeout > 0 && t.prior >= t.timeout {
+		return nil, fmt.Errorf("its time was up")
+	}
+	return t, nil
+}
@@ -1,6 +1,9 @@
 package bus
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 // InboundMessage is a message received from a chat channel.
 type InboundMessage struct {
@@ -12,8 +15,22 @@ type InboundMessage struct {
 	Media        []string
 	Metadata     map[string]any
 	ProgressFunc func(status string) // optional callback for progress updates
+	StreamFunc   func(text string)   // optional callback receiving the answer text streamed so far
+	ApproveFunc  ApproveFunc         // optional; asks the sender to confirm a tool call
 }
 
+// ApprovalRequest describes a tool call waiting for the user's confirmation.
+type ApprovalRequest struct {
+	Tool      string
+	Arguments string // JSON-encoded
+	Reason    string // why the policy wants confirmation
+	Timeout   time.Duration
+}
+
+// ApproveFunc asks the user to approve or decline a tool call. It blocks
+// until the user answers or ctx is done, in which case it returns ctx.Err().
+type ApproveFunc func(ctx context.Context, req ApprovalRequest) (bool, error)
+
 // SessionKey returns the unique key for session identification.
 func (m *InboundMessage) SessionKey() string {
 	return m.Channel + ":" + m.ChatID
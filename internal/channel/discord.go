@@ -11,6 +11,7 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/bwmarrin/discordgo"
 
@@ -33,6 +34,15 @@ type Discord struct {
 
 	progressMu   sync.Mutex
 	progressMsgs map[string]string // channelID → progress message ID
+
+	approvalMu sync.Mutex
+	approvals  map[string]pendingApproval // approval ID → waiting request
+}
+
+// pendingApproval is a tool call waiting for its requester to press a button.
+type pendingApproval struct {
+	senderID string
+	reply    chan bool
 }
 
 // NewDiscord creates a new Discord channel.
@@ -44,6 +54,7 @@ func NewDiscord(cfg config.DiscordConfig, b *bus.MessageBus, cmds []command.Comm
 		transcriber:  t,
 		typingCancel: make(map[string]context.CancelFunc),
 		progressMsgs: make(map[string]string),
+		approvals:    make(map[string]pendingApproval),
 	}
 }
 
@@ -251,7 +262,7 @@ func (d *Discord) onMessageCreate(s *discordgo.Session, m *discordgo.MessageCrea
 		}
 	}
 
-	if content == "" {
+	if content == "" && len(m.Attachments) == 0 {
 		content = "[empty message]"
 	}
 
@@ -279,6 +290,8 @@ func (d *Discord) onMessageCreate(s *discordgo.Session, m *discordgo.MessageCrea
 		Media:        media,
 		Metadata:     metadata,
 		ProgressFunc: d.makeProgressFunc(m.ChannelID),
+		StreamFunc:   d.makeStreamFunc(m.ChannelID),
+		ApproveFunc:  d.makeApproveFunc(m.ChannelID, m.Author.ID),
 	})
 }
 
@@ -368,6 +381,35 @@ func (d *Discord) makeProgressFunc(channelID string) func(string) {
 	}
 }
 
+// streamEditInterval throttles progress-message edits while an answer is
+// streamed, keeping well clear of Discord's per-channel edit rate limit.
+const streamEditInterval = 1500 * time.Millisecond
+
+// makeStreamFunc creates a StreamFunc callback that renders the partial answer
+// into the channel's progress message. Edits are throttled; the final answer
+// replaces the progress message through Send.
+func (d *Discord) makeStreamFunc(channelID string) func(string) {
+	var last time.Time
+	return func(text string) {
+		if time.Since(last) < streamEditInterval {
+			return
+		}
+		last = time.Now()
+		if strings.TrimSpace(text) == "" {
+			return
+		}
+		if len(text) > 1900 {
+			// Show the tail, cut on a rune boundary.
+			cut := len(text) - 1900
+			for cut < len(text) && !utf8.RuneStart(text[cut]) {
+				cut++
+			}
+			text = "…" + text[cut:]
+		}
+		d.updateProgress(channelID, text)
+	}
+}
+
 // registerSlashCommands registers application commands with Discord.
 func (d *Discord) registerSlashCommands() {
 	appID := d.session.State.User.ID
@@ -375,6 +417,7 @@ func (d *Discord) registerSlashCommands() {
 		acmd := &discordgo.ApplicationCommand{
 			Name:        cmd.Name,
 			Description: cmd.Description,
+			Options:     commandOptions(cmd.Options),
 		}
 		_, err := d.session.ApplicationCommandCreate(appID, "", acmd)
 		if err != nil {
@@ -387,17 +430,15 @@ func (d *Discord) registerSlashCommands() {
 
 // onInteractionCreate handles Discord slash command interactions.
 func (d *Discord) onInteractionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type == discordgo.InteractionMessageComponent {
+		d.onApprovalButton(s, i)
+		return
+	}
 	if i.Type != discordgo.InteractionApplicationCommand {
 		return
 	}
 
-	// Resolve user ID from guild member or DM user.
-	userID := ""
-	if i.Member != nil && i.Member.User != nil {
-		userID = i.Member.User.ID
-	} else if i.User != nil {
-		userID = i.User.ID
-	}
+	userID := interactionUserID(i)
 	if userID == "" {
 		return
 	}
@@ -412,15 +453,15 @@ func (d *Discord) onInteractionCreate(s *discordgo.Session, i *discordgo.Interac
 		return
 	}
 
-	cmdName := i.ApplicationCommandData().Name
-	slog.Info("Slash command received", "command", "/"+cmdName, "user", userID, "channel", i.ChannelID)
+	content := d.commandText(i.ApplicationCommandData())
+	slog.Info("Slash command received", "command", content, "user", userID, "channel", i.ChannelID)
 
 	// Acknowledge with an ephemeral response; the actual reply comes
 	// through the normal Send() flow as a regular channel message.
 	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: fmt.Sprintf("/%s ✓", cmdName),
+			Content: content + " ✓",
 			Flags:   discordgo.MessageFlagsEphemeral,
 		},
 	})
@@ -431,12 +472,199 @@ func (d *Discord) onInteractionCreate(s *discordgo.Session, i *discordgo.Interac
 		Channel:  "discord",
 		SenderID: userID,
 		ChatID:   i.ChannelID,
-		Content:  "/" + cmdName,
+		Content:  content,
 		Timestamp: time.Now(),
 		Metadata: map[string]any{
 			"guild_id": i.GuildID,
 		},
 		ProgressFunc: d.makeProgressFunc(i.ChannelID),
+		ApproveFunc:  d.makeApproveFunc(i.ChannelID, userID),
+	})
+}
+
+// commandOptions converts command options to Discord application command
+// options.
+func commandOptions(opts []command.Option) []*discordgo.ApplicationCommandOption {
+	var out []*discordgo.ApplicationCommandOption
+	for _, o := range opts {
+		ao := &discordgo.ApplicationCommandOption{
+			Type:        discordgo.ApplicationCommandOptionString,
+			Name:        o.Name,
+			Description: o.Description,
+			Required:    o.Required,
+		}
+		switch o.Type {
+		case command.OptionInteger:
+			ao.Type = discordgo.ApplicationCommandOptionInteger
+		case command.OptionBoolean:
+			ao.Type = discordgo.ApplicationCommandOptionBoolean
+		}
+		for _, c := range o.Choices {
+			ao.Choices = append(ao.Choices, &discordgo.ApplicationCommandOptionChoice{Name: c, Value: c})
+		}
+		out = append(out, ao)
+	}
+	return out
+}
+
+// commandText renders an application command as the text form the agent
+// parses, with option values in the command's positional order.
+func (d *Discord) commandText(data discordgo.ApplicationCommandInteractionData) string {
+	text := "/" + data.Name
+	values := make(map[string]string, len(data.Options))
+	for _, o := range data.Options {
+		values[o.Name] = fmt.Sprint(o.Value)
+	}
+	for _, cmd := range d.commands {
+		if cmd.Name != data.Name {
+			continue
+		}
+		for _, o := range cmd.Options {
+			v, ok := values[o.Name]
+			if !ok {
+				break
+			}
+			text += " " + v
+		}
+	}
+	return text
+}
+
+// interactionUserID resolves the user from a guild member or DM user.
+func interactionUserID(i *discordgo.InteractionCreate) string {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User.ID
+	}
+	if i.User != nil {
+		return i.User.ID
+	}
+	return ""
+}
+
+// makeApproveFunc creates an ApproveFunc that posts the tool call with
+// Approve/Decline buttons and waits for senderID to press one.
+func (d *Discord) makeApproveFunc(channelID, senderID string) bus.ApproveFunc {
+	return func(ctx context.Context, req bus.ApprovalRequest) (bool, error) {
+		if d.session == nil {
+			return false, fmt.Errorf("discord session not started")
+		}
+		id := fmt.Sprintf("%x", time.Now().UnixNano())
+		reply := make(chan bool, 1)
+		d.approvalMu.Lock()
+		d.approvals[id] = pendingApproval{senderID: senderID, reply: reply}
+		d.approvalMu.Unlock()
+		defer func() {
+			d.approvalMu.Lock()
+			delete(d.approvals, id)
+			d.approvalMu.Unlock()
+		}()
+
+		content := approvalText(req, senderID)
+		msg, err := d.session.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+			Content: content,
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+					discordgo.Button{Label: "Approve", Style: discordgo.SuccessButton, CustomID: "approval:yes:" + id},
+					discordgo.Button{Label: "Decline", Style: discordgo.DangerButton, CustomID: "approval:no:" + id},
+				}},
+			},
+		})
+		if err != nil {
+			return false, fmt.Errorf("send approval request: %w", err)
+		}
+
+		select {
+		case ok := <-reply:
+			return ok, nil
+		case <-ctx.Done():
+			// Nobody answered: take the buttons away.
+			content += "\n⌛ Not answered in time; the call was not run."
+			if _, err := d.session.ChannelMessageEditComplex(&discordgo.MessageEdit{
+				ID:         msg.ID,
+				Channel:    channelID,
+				Content:    &content,
+				Components: &[]discordgo.MessageComponent{},
+			}); err != nil {
+				slog.Debug("approval edit failed", "channel", channelID, "err", err)
+			}
+			return false, ctx.Err()
+		}
+	}
+}
+
+// approvalText renders an approval request for a Discord message.
+func approvalText(req bus.ApprovalRequest, senderID string) string {
+	args := req.Arguments
+	if len(args) > 1500 {
+		// Cut on a rune boundary.
+		cut := 1500
+		for cut > 0 && !utf8.RuneStart(args[cut]) {
+			cut--
+		}
+		args = args[:cut] + "…"
+	}
+	// A fence inside the arguments would close the code block early.
+	args = strings.ReplaceAll(args, "```", "`\u200b`\u200b`")
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "⚠️ <@%s>, allow **%s**?", senderID, req.Tool)
+	if req.Reason != "" {
+		sb.WriteString("\n" + req.Reason)
+	}
+	fmt.Fprintf(&sb, "\n```json\n%s\n```", args)
+	if req.Timeout > 0 {
+		fmt.Fprintf(&sb, "\nDeclined automatically in %s.", req.Timeout)
+	}
+	return sb.String()
+}
+
+// onApprovalButton records the answer to an approval request. Only the user
+// whose message triggered the call may answer.
+func (d *Discord) onApprovalButton(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	parts := strings.SplitN(i.MessageComponentData().CustomID, ":", 3)
+	if len(parts) != 3 || parts[0] != "approval" {
+		return
+	}
+	approved := parts[1] == "yes"
+	userID := interactionUserID(i)
+
+	d.approvalMu.Lock()
+	pending, ok := d.approvals[parts[2]]
+	if ok && pending.senderID == userID {
+		delete(d.approvals, parts[2])
+	}
+	d.approvalMu.Unlock()
+
+	content := ""
+	if i.Message != nil {
+		content = i.Message.Content
+	}
+	switch {
+	case !ok:
+		content += "\n⌛ This request is no longer pending."
+	case pending.senderID != userID:
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: "Only the user who asked can answer this.",
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		return
+	case approved:
+		pending.reply <- true
+		content += fmt.Sprintf("\n✅ Approved by <@%s>.", userID)
+	default:
+		pending.reply <- false
+		content += fmt.Sprintf("\n🚫 Declined by <@%s>.", userID)
+	}
+	slog.Info("Approval answered", "user", userID, "approved", approved, "pending", ok)
+
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:    content,
+			Components: []discordgo.MessageComponent{},
+		},
 	})
 }
 
@@ -14,6 +14,8 @@ import (
 	"github.com/charmbracelet/lipgloss"
 
 	"github.com/joebot/nagobot/internal/agent"
+	"github.com/joebot/nagobot/internal/bus"
+	"github.com/joebot/nagobot/internal/command"
 )
 
 // --- message types ---
@@ -23,6 +25,24 @@ type llmResponseMsg struct {
 	err     error
 }
 
+// streamMsg carries the partial answer text while a response is streaming.
+type streamMsg struct {
+	text string
+}
+
+// approvalMsg asks the user to confirm a tool call. The answer goes to
+// reply; done is closed when the request expires.
+type approvalMsg struct {
+	req   bus.ApprovalRequest
+	reply chan bool
+	done  <-chan struct{}
+}
+
+// approvalDoneMsg reports that an approval request expired unanswered.
+type approvalDoneMsg struct {
+	reply chan bool
+}
+
 // --- chat config ---
 
 // ChatConfig holds display metadata for the chat TUI.
@@ -34,7 +54,7 @@ type ChatConfig struct {
 // --- chat entry ---
 
 type chatEntry struct {
-	role    string // "user", "assistant", "error"
+	role    string // "user", "assistant", "error", "approval"
 	content string
 }
 
@@ -48,6 +68,10 @@ type chatModel struct {
 	history    []chatEntry
 	waiting    bool
 	cancelFunc context.CancelFunc
+	streamCh   chan string
+	streaming  string // partial answer while waiting
+	approvalCh chan approvalMsg
+	approval   *approvalMsg // tool call waiting for y/n
 
 	loop *agent.Loop
 	ctx  context.Context
@@ -115,6 +139,11 @@ func (m chatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		switch msg.Type {
 		case tea.KeyCtrlC, tea.KeyCtrlD:
 			return m, tea.Quit
+		}
+		if m.approval != nil {
+			return m.answerApproval(msg)
+		}
+		switch msg.Type {
 		case tea.KeyEnter:
 			if m.waiting {
 				return m, nil
@@ -126,15 +155,29 @@ func (m chatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if isExitCmd(input) {
 				return m, tea.Quit
 			}
+			if err := m.checkCommand(input); err != nil {
+				m.history = append(m.history, chatEntry{role: "user", content: input}, chatEntry{role: "error", content: err.Error()})
+				m.input.SetValue("")
+				m.viewport.SetContent(m.renderHistory())
+				m.viewport.GotoBottom()
+				return m, nil
+			}
 			m.history = append(m.history, chatEntry{role: "user", content: input})
 			m.input.SetValue("")
 			m.input.Blur()
 			m.waiting = true
 			msgCtx, cancel := context.WithCancel(m.ctx)
 			m.cancelFunc = cancel
+			m.streamCh = make(chan string, 1)
+			m.approvalCh = make(chan approvalMsg)
+			m.streaming = ""
 			m.viewport.SetContent(m.renderHistory())
 			m.viewport.GotoBottom()
-			return m, m.sendMessageWithCtx(msgCtx, input)
+			return m, tea.Batch(
+				m.sendMessageWithCtx(msgCtx, input, m.streamCh, m.approvalCh),
+				waitForStream(m.streamCh),
+				waitForApproval(m.approvalCh),
+			)
 		case tea.KeyEsc:
 			if m.waiting && m.cancelFunc != nil {
 				m.cancelFunc()
@@ -147,9 +190,41 @@ func (m chatModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, cmd
 		}
 
+	case streamMsg:
+		if !m.waiting {
+			return m, nil
+		}
+		m.streaming = msg.text
+		m.viewport.SetContent(m.renderHistory())
+		m.viewport.GotoBottom()
+		return m, waitForStream(m.streamCh)
+
+	case approvalMsg:
+		if !m.waiting {
+			return m, nil
+		}
+		m.approval = &msg
+		m.viewport.SetContent(m.renderHistory())
+		m.viewport.GotoBottom()
+		return m, waitForApprovalDone(msg)
+
+	case approvalDoneMsg:
+		if m.approval == nil || m.approval.reply != msg.reply {
+			return m, nil
+		}
+		m.history = append(m.history, chatEntry{role: "approval", content: "Not answered in time: " + m.approval.req.Tool})
+		m.approval = nil
+		m.viewport.SetContent(m.renderHistory())
+		m.viewport.GotoBottom()
+		return m, waitForApproval(m.approvalCh)
+
 	case llmResponseMsg:
 		m.waiting = false
 		m.cancelFunc = nil
+		m.streamCh = nil
+		m.approvalCh = nil
+		m.approval = nil
+		m.streaming = ""
 		focusCmd := m.input.Focus()
 		if msg.err != nil {
 			if errors.Is(msg.err, context.Canceled) {
@@ -192,7 +267,11 @@ func (m chatModel) View() string {
 	divider := DimStyle.Render(strings.Repeat("─", m.width))
 
 	var inputLine string
-	if m.waiting {
+	if m.approval != nil {
+		inputLine = " " + BoldStyle.Render(fmt.Sprintf("Allow %s? (y/n)", m.approval.req.Tool))
+	} else if m.waiting && m.streaming != "" {
+		inputLine = fmt.Sprintf(" %s Responding... (Esc to stop)", m.spinner.View())
+	} else if m.waiting {
 		inputLine = fmt.Sprintf(" %s Thinking... (Esc to stop)", m.spinner.View())
 	} else {
 		inputLine = " " + m.input.View()
@@ -225,13 +304,31 @@ func (m chatModel) renderHistory() string {
 		case "assistant":
 			sb.WriteString("  " + BotLabel.Render("nagobot") + "\n")
 			for _, line := range strings.Split(entry.content, "\n") {
-				sb.WriteString("  " + line + "\n")
+				sb.WriteString("  " + renderAnswerLine(line) + "\n")
 			}
 		case "error":
 			sb.WriteString("  " + ErrStyle.Render("Error: "+entry.content) + "\n")
+		case "approval":
+			sb.WriteString("  " + DimStyle.Render(entry.content) + "\n")
 		}
 	}
 
+	if m.waiting && m.streaming != "" {
+		sb.WriteString("\n  " + BotLabel.Render("nagobot") + "\n")
+		for _, line := range strings.Split(m.streaming, "\n") {
+			sb.WriteString("  " + renderAnswerLine(line) + "\n")
+		}
+	}
+
+	if m.approval != nil {
+		req := m.approval.req
+		sb.WriteString("\n  " + BoldStyle.Render("Approval needed: "+req.Tool) + "\n")
+		if req.Reason != "" {
+			sb.WriteString("  " + req.Reason + "\n")
+		}
+		sb.WriteString("  " + DimStyle.Render(req.Arguments) + "\n")
+	}
+
 	return sb.String()
 }
 
@@ -250,6 +347,9 @@ func (m chatModel) renderWelcome() string {
 
 func (m chatModel) renderStatusBar() string {
 	left := DimStyle.Render(" " + m.workspace)
+	if hint := m.commandHint(); hint != "" {
+		left = DimStyle.Render(" " + hint)
+	}
 	right := DimStyle.Render(m.model + " ")
 
 	gap := m.width - lipgloss.Width(left) - lipgloss.Width(right)
@@ -260,13 +360,135 @@ func (m chatModel) renderStatusBar() string {
 	return left + strings.Repeat(" ", gap) + right
 }
 
-func (m chatModel) sendMessageWithCtx(ctx context.Context, input string) tea.Cmd {
+// checkCommand parses a slash command's arguments so mistakes are reported
+// without a round trip. Unknown commands are left to the agent.
+func (m chatModel) checkCommand(input string) error {
+	name, rest, ok := command.Split(input)
+	if !ok {
+		return nil
+	}
+	cmd, ok := command.Find(m.loop.Commands(), name)
+	if !ok {
+		return nil
+	}
+	_, err := cmd.Parse(rest)
+	return err
+}
+
+// commandHint returns the usage of the slash command being typed.
+func (m chatModel) commandHint() string {
+	if m.waiting {
+		return ""
+	}
+	name, _, ok := command.Split(m.input.Value())
+	if !ok {
+		return ""
+	}
+	for _, cmd := range m.loop.Commands() {
+		if strings.HasPrefix(cmd.Name, name) {
+			return cmd.Usage() + " — " + cmd.Description
+		}
+	}
+	return ""
+}
+
+// renderAnswerLine dims quoted lines, which carry the model's reasoning
+// when /reasoning is on.
+func renderAnswerLine(line string) string {
+	if strings.HasPrefix(line, "> ") {
+		return DimStyle.Render(line)
+	}
+	return line
+}
+
+// answerApproval handles a key press while a tool call waits for approval:
+// y approves, n or Esc declines.
+func (m chatModel) answerApproval(key tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var ok bool
+	switch {
+	case key.String() == "y" || key.String() == "Y":
+		ok = true
+	case key.String() == "n" || key.String() == "N" || key.Type == tea.KeyEsc:
+	default:
+		return m, nil
+	}
+	m.approval.reply <- ok
+	decision := "Declined: "
+	if ok {
+		decision = "Approved: "
+	}
+	m.history = append(m.history, chatEntry{role: "approval", content: decision + m.approval.req.Tool})
+	m.approval = nil
+	m.viewport.SetContent(m.renderHistory())
+	m.viewport.GotoBottom()
+	return m, waitForApproval(m.approvalCh)
+}
+
+func (m chatModel) sendMessageWithCtx(ctx context.Context, input string, stream chan string, approvals chan approvalMsg) tea.Cmd {
 	return func() tea.Msg {
-		resp, err := m.loop.ProcessDirect(ctx, input, "cli:default")
+		defer close(stream)
+		defer close(approvals)
+		approve := func(ctx context.Context, req bus.ApprovalRequest) (bool, error) {
+			reply := make(chan bool, 1)
+			select {
+			case approvals <- approvalMsg{req: req, reply: reply, done: ctx.Done()}:
+			case <-ctx.Done():
+				return false, ctx.Err()
+			}
+			select {
+			case ok := <-reply:
+				return ok, nil
+			case <-ctx.Done():
+				return false, ctx.Err()
+			}
+		}
+		resp, err := m.loop.ProcessDirectInteractive(ctx, input, "cli:default", func(text string) {
+			// Keep only the latest snapshot; the reader may lag behind.
+			select {
+			case <-stream:
+			default:
+			}
+			select {
+			case stream <- text:
+			default:
+			}
+		}, approve)
 		return llmResponseMsg{content: resp, err: err}
 	}
 }
 
+// waitForStream waits for the next partial answer. It yields no message once
+// the stream channel is closed.
+func waitForStream(stream <-chan string) tea.Cmd {
+	return func() tea.Msg {
+		text, ok := <-stream
+		if !ok {
+			return nil
+		}
+		return streamMsg{text: text}
+	}
+}
+
+// waitForApproval waits for the next approval request. It yields no message
+// once the channel is closed.
+func waitForApproval(approvals <-chan approvalMsg) tea.Cmd {
+	return func() tea.Msg {
+		req, ok := <-approvals
+		if !ok {
+			return nil
+		}
+		return req
+	}
+}
+
+// waitForApprovalDone reports when an approval request expires.
+func waitForApprovalDone(req approvalMsg) tea.Cmd {
+	return func() tea.Msg {
+		<-req.done
+		return approvalDoneMsg{reply: req.reply}
+	}
+}
+
 func isExitCmd(s string) bool {
 	s = strings.ToLower(s)
 	return s == "exit" || s == "quit" || s == "/exit" || s == "/quit" || s == ":q"
@@ -3,6 +3,7 @@ package cli
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/joebot/nagobot/internal/config"
 )
@@ -21,8 +22,44 @@ func RunStatus(cfg *config.Config) {
 	fmt.Printf("  %-12s %s  %s\n", "Workspace", StatusBadge(fileExists(wsPath)), DimStyle.Render(wsPath))
 
 	fmt.Printf("  %-12s %s\n", "Model", cfg.Agents.Defaults.Model)
+	for _, role := range []struct {
+		name string
+		r    *config.ModelRole
+	}{{"Utility", cfg.Agents.Defaults.Utility}, {"Subagent", cfg.Agents.Defaults.Subagent}} {
+		if role.r == nil || (role.r.Model == "" && role.r.Provider == "") {
+			continue
+		}
+		model := role.r.Model
+		if role.r.Provider != "" {
+			model = strings.TrimSuffix(role.r.Provider+"/"+model, "/")
+		}
+		fmt.Printf("  %-12s %s\n", role.name, model)
+	}
 	fmt.Println()
 
+	if names := cfg.ProfileNames(); len(names) > 1 {
+		fmt.Println("  " + BoldStyle.Render("Agents"))
+		for _, name := range names[1:] {
+			p, _ := cfg.Profile(name)
+			fmt.Printf("    %s  %-10s %s  %s\n", StatusBadge(fileExists(p.Workspace)), name, p.Model, DimStyle.Render(p.Workspace))
+		}
+		for _, r := range cfg.Agents.Routes {
+			var match []string
+			for _, f := range []struct{ key, value string }{
+				{"channel", r.Channel}, {"guild", r.Guild}, {"chat", r.ChatID}, {"sender", r.Sender},
+			} {
+				if f.value != "" {
+					match = append(match, f.key+"="+f.value)
+				}
+			}
+			if len(match) == 0 {
+				match = []string{"*"}
+			}
+			fmt.Printf("    %s\n", DimStyle.Render(strings.Join(match, " ")+" → "+r.Profile))
+		}
+		fmt.Println()
+	}
+
 	fmt.Println("  " + BoldStyle.Render("Providers"))
 	providers := []struct {
 		name   string
@@ -37,6 +74,16 @@ func RunStatus(cfg *config.Config) {
 	for _, p := range providers {
 		fmt.Printf("    %s  %s\n", StatusBadge(p.config.APIKey != ""), p.name)
 	}
+	if chain := cfg.Providers.Failover.Chain; len(chain) > 0 {
+		steps := make([]string, len(chain))
+		for i, t := range chain {
+			steps[i] = t.Provider
+			if t.Model != "" {
+				steps[i] += "/" + t.Model
+			}
+		}
+		fmt.Printf("    %s\n", DimStyle.Render("failover: "+strings.Join(steps, " → ")))
+	}
 	fmt.Println()
 
 	fmt.Println("  " + BoldStyle.Render("Channels"))
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joebot/nagobot/internal/agent"
+)
+
+// RunSubagents prints the last n subagent runs saved in dir, newest first,
+// or the run with the given id in detail.
+func RunSubagents(dir, id string, n int) error {
+	if id != "" {
+		run, err := agent.LoadSubagentRun(dir, id)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no subagent run %s", id)
+		}
+		if err != nil {
+			return err
+		}
+		printSubagentRun(run)
+		return nil
+	}
+
+	runs, err := agent.LoadSubagentRuns(dir)
+	if err != nil {
+		return err
+	}
+	fmt.Println()
+	fmt.Println(TitleStyle.Render(fmt.Sprintf("  %s nagobot Subagents", Logo)))
+	fmt.Println()
+	if len(runs) == 0 {
+		fmt.Println("  " + DimStyle.Render("No subagent runs recorded in "+dir))
+		fmt.Println()
+		return nil
+	}
+	if n > 0 && len(runs) > n {
+		runs = runs[:n]
+	}
+	fmt.Println("    " + DimStyle.Render(fmt.Sprintf("%-8s  %-11s  %-16s  %8s  %5s  %-24s  %s", "id", "status", "started", "time", "steps", "origin", "label")))
+	for _, r := range runs {
+		fmt.Printf("    %-8s  %-11s  %-16s  %8s  %5d  %-24s  %s\n", r.ID, r.Status,
+			r.Started.Format("2006-01-02 15:04"), r.Elapsed.Round(time.Second),
+			r.Iterations, r.Channel+":"+r.ChatID, r.Label)
+	}
+	fmt.Println()
+	fmt.Println("  " + DimStyle.Render("nagobot subagents <id> shows a run in detail"))
+	fmt.Println()
+	return nil
+}
+
+func printSubagentRun(r *agent.SubagentRun) {
+	field := func(name, value string) {
+		fmt.Printf("  %s %s\n", BoldStyle.Render(fmt.Sprintf("%-10s", name)), value)
+	}
+	fmt.Println()
+	fmt.Println(TitleStyle.Render(fmt.Sprintf("  %s Subagent %s", Logo, r.ID)) + DimStyle.Render("  "+r.Label))
+	fmt.Println()
+	field("Status", r.Status)
+	field("Origin", fmt.Sprintf("%s:%s (agent %s)", r.Channel, r.ChatID, r.Agent))
+	if r.Group != "" {
+		field("Group", r.Group)
+	}
+	field("Profile", r.Profile)
+	if r.Model != "" {
+		field("Model", r.Model)
+	}
+	field("Started", r.Started.Format("2006-01-02 15:04:05"))
+	field("Time", r.Elapsed.Round(time.Second).String())
+	field("Steps", fmt.Sprintf("%d of %d", r.Iterations, r.MaxIterations))
+	field("Workdir", r.Workdir)
+	fmt.Println()
+	fmt.Println("  " + BoldStyle.Render("Task"))
+	fmt.Println(indent(r.Task))
+	if len(r.Steps) > 0 {
+		fmt.Println()
+		fmt.Println("  " + BoldStyle.Render("Transcript"))
+		fmt.Println(indent(strings.Join(r.Steps, "\n")))
+	}
+	if r.Result != "" {
+		fmt.Println()
+		fmt.Println("  " + BoldStyle.Render("Result"))
+		fmt.Println(indent(r.Result))
+	}
+	fmt.Println()
+}
+
+// indent indents every line of s for printing under a heading.
+func indent(s string) string {
+	return "    " + strings.ReplaceAll(s, "\n", "\n    ")
+}
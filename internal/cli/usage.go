@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/joebot/nagobot/internal/usage"
+)
+
+// defaultUsagePeriods is how many periods RunUsage shows when n <= 0.
+var defaultUsagePeriods = map[string]int{
+	usage.PeriodDay:   7,
+	usage.PeriodWeek:  8,
+	usage.PeriodMonth: 6,
+}
+
+// RunUsage prints token usage and cost for the last n days, weeks or months,
+// followed by breakdowns by model and purpose over the same range.
+func RunUsage(ledger *usage.Ledger, period string, n int) error {
+	key, err := usage.PeriodKey(period)
+	if err != nil {
+		return err
+	}
+	if n <= 0 {
+		n = defaultUsagePeriods[period]
+	}
+	since := usage.PeriodStart(period, time.Now(), n-1)
+	records, err := ledger.Load(since)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println(TitleStyle.Render(fmt.Sprintf("  %s nagobot Usage", Logo)) +
+		DimStyle.Render(fmt.Sprintf("  since %s", since.Format("2006-01-02"))))
+	fmt.Println()
+
+	if len(records) == 0 {
+		fmt.Println("  " + DimStyle.Render("No usage recorded in "+ledger.Path()))
+		fmt.Println()
+		return nil
+	}
+
+	printUsageTable("By "+period, usage.GroupBy(records, key))
+	printUsageTable("By model", usage.GroupBy(records, func(r usage.Record) string { return r.Model }))
+	printUsageTable("By purpose", usage.GroupBy(records, func(r usage.Record) string { return r.Purpose }))
+
+	total := usage.Sum(records, nil)
+	fmt.Printf("  %s  %s\n", BoldStyle.Render("Total"), total)
+	fmt.Println()
+	return nil
+}
+
+func printUsageTable(title string, groups []usage.Group) {
+	fmt.Println("  " + BoldStyle.Render(title))
+	fmt.Println("    " + DimStyle.Render(fmt.Sprintf("%-36s %7s %9s %9s %10s", "", "calls", "input", "output", "cost")))
+	for _, g := range groups {
+		fmt.Printf("    %-36s %7d %9s %9s %10s\n", g.Key, g.Calls,
+			usage.FormatTokens(g.PromptTokens), usage.FormatTokens(g.CompletionTokens),
+			fmt.Sprintf("$%.4f", g.Cost))
+	}
+	fmt.Println()
+}
@@ -1,7 +1,146 @@
 package command
 
-// Command defines a slash command's name and description.
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Command defines a slash command's name, description and options.
 type Command struct {
 	Name        string
 	Description string
+	Options     []Option // in positional order; required options come first
+}
+
+// OptionType is the type of an option's value.
+type OptionType int
+
+const (
+	OptionString OptionType = iota
+	OptionInteger
+	OptionBoolean
+)
+
+// Option is an argument of a slash command. In text, options are given
+// positionally; the last string option takes the rest of the line.
+type Option struct {
+	Name        string
+	Description string
+	Type        OptionType
+	Required    bool
+	Choices     []string // allowed values; empty allows any
+}
+
+// Args holds the option values of a parsed command by name.
+type Args map[string]string
+
+// String returns the value of the named option, or "".
+func (a Args) String(name string) string {
+	return a[name]
+}
+
+// Int returns the value of the named integer option, or 0.
+func (a Args) Int(name string) int {
+	n, _ := strconv.Atoi(a[name])
+	return n
+}
+
+// Bool returns the value of the named boolean option.
+func (a Args) Bool(name string) bool {
+	b, _ := strconv.ParseBool(a[name])
+	return b
+}
+
+// Usage returns the command's syntax, e.g. "/session <list|switch> [name]".
+func (c Command) Usage() string {
+	var sb strings.Builder
+	sb.WriteString("/" + c.Name)
+	for _, o := range c.Options {
+		label := o.Name
+		if len(o.Choices) > 0 {
+			label = strings.Join(o.Choices, "|")
+		}
+		if o.Required {
+			sb.WriteString(" <" + label + ">")
+		} else {
+			sb.WriteString(" [" + label + "]")
+		}
+	}
+	return sb.String()
+}
+
+// Split separates a slash command line into the lowercased command name and
+// the rest of the line. ok is false if text is not a slash command.
+func Split(text string) (name, rest string, ok bool) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "/") {
+		return "", "", false
+	}
+	name, rest, _ = strings.Cut(text[1:], " ")
+	return strings.ToLower(name), strings.TrimSpace(rest), name != ""
+}
+
+// Find returns the command with the given name.
+func Find(cmds []Command, name string) (Command, bool) {
+	for _, c := range cmds {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Command{}, false
+}
+
+// Parse reads the option values of c from the text after the command name,
+// checking required options, types and choices.
+func (c Command) Parse(rest string) (Args, error) {
+	args := make(Args)
+	fields := strings.Fields(rest)
+	for i, o := range c.Options {
+		if len(fields) == 0 {
+			if o.Required {
+				return nil, fmt.Errorf("missing %s; usage: %s", o.Name, c.Usage())
+			}
+			break
+		}
+		value := fields[0]
+		fields = fields[1:]
+		if o.Type == OptionString && i == len(c.Options)-1 && len(fields) > 0 {
+			value += " " + strings.Join(fields, " ")
+			fields = nil
+		}
+		value, err := o.normalize(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w; usage: %s", err, c.Usage())
+		}
+		args[o.Name] = value
+	}
+	if len(fields) > 0 {
+		return nil, fmt.Errorf("too many arguments; usage: %s", c.Usage())
+	}
+	return args, nil
+}
+
+// normalize checks value against the option's type and choices, and
+// returns it with a choice's canonical spelling.
+func (o Option) normalize(value string) (string, error) {
+	switch o.Type {
+	case OptionInteger:
+		if _, err := strconv.Atoi(value); err != nil {
+			return "", fmt.Errorf("%s must be a number, got %q", o.Name, value)
+		}
+	case OptionBoolean:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return "", fmt.Errorf("%s must be true or false, got %q", o.Name, value)
+		}
+	}
+	if len(o.Choices) == 0 {
+		return value, nil
+	}
+	for _, c := range o.Choices {
+		if strings.EqualFold(c, value) {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("%s must be one of %s, got %q", o.Name, strings.Join(o.Choices, ", "), value)
 }
@@ -0,0 +1,42 @@
+package command
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	cmd := Command{Name: "session", Options: []Option{
+		{Name: "action", Required: true, Choices: []string{"list", "switch", "rename"}},
+		{Name: "name"},
+	}}
+
+	name, rest, ok := Split("  /Session Rename my notes ")
+	if !ok || name != "session" || rest != "Rename my notes" {
+		t.Fatalf("Split = %q, %q, %v", name, rest, ok)
+	}
+	args, err := cmd.Parse(rest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args.String("action") != "rename" || args.String("name") != "my notes" {
+		t.Errorf("args = %v", args)
+	}
+
+	for _, bad := range []string{"", "delete x"} {
+		if _, err := cmd.Parse(bad); err == nil {
+			t.Errorf("Parse(%q) succeeded", bad)
+		}
+	}
+
+	count := Command{Name: "n", Options: []Option{{Name: "count", Type: OptionInteger}}}
+	if _, err := count.Parse("three"); err == nil {
+		t.Error("non-numeric integer accepted")
+	}
+	if _, err := count.Parse("3 4"); err == nil {
+		t.Error("extra argument accepted")
+	}
+	if args, _ := count.Parse("3"); args.Int("count") != 3 {
+		t.Errorf("count = %d", args.Int("count"))
+	}
+	if got := cmd.Usage(); got != "/session <list|switch|rename> [name]" {
+		t.Errorf("Usage = %q", got)
+	}
+}
@@ -1,6 +1,10 @@
 package config
 
-import "path/filepath"
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
 
 // Config is the root configuration for nagobot.
 type Config struct {
@@ -10,6 +14,62 @@ type Config struct {
 	Tools     ToolsConfig     `json:"tools"`
 	Services  ServicesConfig  `json:"services"`
 	MCP       MCPConfig       `json:"mcp"`
+	Usage     UsageConfig     `json:"usage"`
+	Hooks     []HookConfig    `json:"hooks,omitempty"`
+}
+
+// HookConfig declares an external command run as a hook. The command
+// receives the event as JSON on stdin and may print JSON on stdout to
+// change or block it.
+type HookConfig struct {
+	// Event is beforeMessage, afterMessage, beforeLLM, afterLLM,
+	// beforeTool or afterTool.
+	Event          string            `json:"event"`
+	Command        string            `json:"command"`
+	Args           []string          `json:"args,omitempty"`
+	Env            map[string]string `json:"env,omitempty"`
+	Tool           string            `json:"tool,omitempty"`           // tool name or glob for tool events; empty matches all
+	TimeoutSeconds int               `json:"timeoutSeconds,omitempty"` // default 10
+	// Profiles limits the hook to these agent profiles; empty applies it
+	// to all.
+	Profiles []string `json:"profiles,omitempty"`
+}
+
+// UsageConfig holds token usage accounting settings.
+type UsageConfig struct {
+	// Prices maps a model name (or name prefix) to its price. Calls to
+	// models without a price are recorded with zero cost.
+	Prices map[string]ModelPrice `json:"prices,omitempty"`
+	// Budgets limit what turns, sessions and channels may spend.
+	Budgets BudgetsConfig `json:"budgets"`
+}
+
+// BudgetsConfig holds spending limits. Cost is estimated from the prices.
+type BudgetsConfig struct {
+	Turn     BudgetLimits            `json:"turn"`               // each turn
+	Session  BudgetLimits            `json:"session"`            // each session per day
+	Channels map[string]BudgetLimits `json:"channels,omitempty"` // each channel per day
+	// WarnAt is the share of a limit (0-1) at which replies carry a
+	// notice; default 0.8.
+	WarnAt float64 `json:"warnAt,omitempty"`
+}
+
+// BudgetLimits caps spending. Zero fields are unlimited.
+type BudgetLimits struct {
+	Tokens    int            `json:"tokens,omitempty"`
+	Cost      float64        `json:"cost,omitempty"`    // USD
+	Seconds   int            `json:"seconds,omitempty"` // wall-clock time of turns
+	ToolCalls int            `json:"toolCalls,omitempty"`
+	Tools     map[string]int `json:"tools,omitempty"` // calls per tool name
+}
+
+// ModelPrice is a model's price in USD per million tokens. Cache prices
+// apply to prompt-cache reads and writes and default to the input price.
+type ModelPrice struct {
+	Input      float64 `json:"input"`
+	Output     float64 `json:"output"`
+	CacheRead  float64 `json:"cacheRead,omitempty"`
+	CacheWrite float64 `json:"cacheWrite,omitempty"`
 }
 
 // MCPConfig holds MCP (Model Context Protocol) settings.
@@ -27,6 +87,10 @@ type MCPServerConfig struct {
 	// HTTP transport
 	URL     string            `json:"url,omitempty"`
 	Headers map[string]string `json:"headers,omitempty"`
+	// SendMeta passes the channel, chat ID, sender and session key of each
+	// call to the server as _meta. Off by default: only servers trusted
+	// with who is talking should see it.
+	SendMeta bool `json:"sendMeta,omitempty"`
 }
 
 // WorkspacePath returns the expanded workspace path.
@@ -37,6 +101,123 @@ func (c *Config) WorkspacePath() string {
 // AgentsConfig holds agent settings.
 type AgentsConfig struct {
 	Defaults AgentDefaults `json:"defaults"`
+	// Profiles are named agents served alongside the default one; Routes
+	// decide which profile handles a message. The first matching route
+	// wins and unmatched messages go to the "default" profile.
+	Profiles map[string]AgentProfile `json:"profiles,omitempty"`
+	Routes   []AgentRoute            `json:"routes,omitempty"`
+}
+
+// AgentProfile is a named agent. Its workspace holds its own bootstrap
+// files (SOUL.md, AGENTS.md, ...), memory and skills. Unset fields fall
+// back to agents.defaults.
+type AgentProfile struct {
+	Workspace string `json:"workspace,omitempty"`
+	// Provider names the provider for Model when it differs from the
+	// default one; empty shares the default provider.
+	Provider          string       `json:"provider,omitempty"`
+	Model             string       `json:"model,omitempty"`
+	MaxTokens         int          `json:"maxTokens,omitempty"`
+	Temperature       float64      `json:"temperature,omitempty"`
+	MaxToolIterations int          `json:"maxToolIterations,omitempty"`
+	MemoryWindow      int          `json:"memoryWindow,omitempty"`
+	ContextLimit      int          `json:"contextLimit,omitempty"`
+	ThinkingBudget    int          `json:"thinkingBudget,omitempty"`
+	ReasoningEffort   string       `json:"reasoningEffort,omitempty"`
+	ToolHistory       string       `json:"toolHistory,omitempty"`
+	ToolResultChars   int          `json:"toolResultChars,omitempty"`
+	Utility           *ModelRole   `json:"utility,omitempty"`
+	Subagent          *ModelRole   `json:"subagent,omitempty"`
+	Spawn             *SpawnConfig `json:"spawn,omitempty"`
+
+	// Tools lists the tools the agent may use, by name or pattern such as
+	// "mcp__github__*". Skills and MCPServers select skills and
+	// mcp.servers. Empty lists enable everything.
+	Tools      []string `json:"tools,omitempty"`
+	Skills     []string `json:"skills,omitempty"`
+	MCPServers []string `json:"mcpServers,omitempty"`
+}
+
+// AgentRoute maps messages to a profile. Empty fields match anything.
+type AgentRoute struct {
+	Profile string `json:"profile"`
+	// Channel is "discord", "cli", "cron", "heartbeat" or another channel
+	// name such as "webhook".
+	Channel string `json:"channel,omitempty"`
+	Guild   string `json:"guild,omitempty"`  // Discord server ID
+	ChatID  string `json:"chatId,omitempty"` // Discord channel ID or cron job ID
+	Sender  string `json:"sender,omitempty"`
+}
+
+// DefaultProfile is the name of the profile built from agents.defaults.
+const DefaultProfile = "default"
+
+// ProfileNames returns the default profile followed by the configured
+// profiles in name order.
+func (c *Config) ProfileNames() []string {
+	names := []string{DefaultProfile}
+	for name := range c.Agents.Profiles {
+		if name != DefaultProfile {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// Profile returns the named profile with unset fields filled from
+// agents.defaults, and whether it exists. A "default" entry in profiles
+// overrides the defaults.
+func (c *Config) Profile(name string) (AgentProfile, bool) {
+	d := c.Agents.Defaults
+	p, ok := c.Agents.Profiles[name]
+	if !ok && name != DefaultProfile {
+		return AgentProfile{}, false
+	}
+	if p.Workspace == "" {
+		p.Workspace = d.Workspace
+	}
+	p.Workspace = expandHome(p.Workspace)
+	if p.Model == "" {
+		p.Model = d.Model
+	}
+	if p.MaxTokens == 0 {
+		p.MaxTokens = d.MaxTokens
+	}
+	if p.Temperature == 0 {
+		p.Temperature = d.Temperature
+	}
+	if p.MaxToolIterations == 0 {
+		p.MaxToolIterations = d.MaxToolIterations
+	}
+	if p.MemoryWindow == 0 {
+		p.MemoryWindow = d.MemoryWindow
+	}
+	if p.ContextLimit == 0 {
+		p.ContextLimit = d.ContextLimit
+	}
+	if p.ThinkingBudget == 0 {
+		p.ThinkingBudget = d.ThinkingBudget
+	}
+	if p.ReasoningEffort == "" {
+		p.ReasoningEffort = d.ReasoningEffort
+	}
+	if p.ToolHistory == "" {
+		p.ToolHistory = d.ToolHistory
+	}
+	if p.ToolResultChars == 0 {
+		p.ToolResultChars = d.ToolResultChars
+	}
+	if p.Utility == nil {
+		p.Utility = d.Utility
+	}
+	if p.Subagent == nil {
+		p.Subagent = d.Subagent
+	}
+	if p.Spawn == nil {
+		p.Spawn = d.Spawn
+	}
+	return p, true
 }
 
 // AgentDefaults holds default agent parameters.
@@ -48,6 +229,60 @@ type AgentDefaults struct {
 	MaxToolIterations int     `json:"maxToolIterations"`
 	MemoryWindow      int     `json:"memoryWindow"`
 	ContextLimit      int     `json:"contextLimit"`
+	// MaxConcurrentSessions caps how many sessions are processed at once
+	// (default 4). Messages for one session are always handled in order.
+	MaxConcurrentSessions int `json:"maxConcurrentSessions,omitempty"`
+	// FollowUp is what happens to a message that arrives while its session
+	// is busy: "interrupt" (default), "queue" or "coalesce". Channels can
+	// override it.
+	FollowUp string `json:"followUp,omitempty"`
+	// ThinkingBudget enables extended thinking with the given number of
+	// reasoning tokens per call. ReasoningEffort ("low", "medium", "high")
+	// is the alternative for models that take an effort level.
+	ThinkingBudget  int    `json:"thinkingBudget,omitempty"`
+	ReasoningEffort string `json:"reasoningEffort,omitempty"`
+	// ToolHistory is how much of earlier turns' tool activity is replayed
+	// to the model: "full" (default) calls and results, "calls" calls with
+	// short result previews, or "none". ToolResultChars caps each stored
+	// result (default 2000).
+	ToolHistory     string `json:"toolHistory,omitempty"`
+	ToolResultChars int    `json:"toolResultChars,omitempty"`
+
+	// Utility is the model for context compression, memory consolidation
+	// and subagent result summaries; Subagent is the model for background
+	// subagents. Unset fields fall back to the main model settings above.
+	Utility  *ModelRole `json:"utility,omitempty"`
+	Subagent *ModelRole `json:"subagent,omitempty"`
+
+	// Spawn limits the subagents the spawn tool may start.
+	Spawn *SpawnConfig `json:"spawn,omitempty"`
+}
+
+// SpawnConfig limits what the model may ask for when it spawns a
+// subagent: it can choose less, never more.
+type SpawnConfig struct {
+	// Profiles are tool sets a subagent can be given, as tool names or
+	// patterns such as "mcp__github__*". They add to or replace the
+	// built-in "default", "research" and "coder" profiles.
+	Profiles map[string][]string `json:"profiles,omitempty"`
+	// Models are model roles the model may pick by name. Unset fields
+	// fall back to the subagent model.
+	Models              map[string]ModelRole `json:"models,omitempty"`
+	MaxIterations       int                  `json:"maxIterations,omitempty"`       // per subagent (default 15)
+	TimeoutSeconds      int                  `json:"timeoutSeconds,omitempty"`      // longest run; 0 is unlimited
+	MaxGroupSize        int                  `json:"maxGroupSize,omitempty"`        // subagents per spawn_group (default 8)
+	GroupTimeoutSeconds int                  `json:"groupTimeoutSeconds,omitempty"` // deadline of a spawn_group (default 1800)
+}
+
+// ModelRole configures the model used for one kind of LLM call.
+type ModelRole struct {
+	// Provider names the provider to call (e.g. "deepseek"); empty shares
+	// the main provider, including its failover chain.
+	Provider  string `json:"provider,omitempty"`
+	Model     string `json:"model,omitempty"`
+	MaxTokens int    `json:"maxTokens,omitempty"`
+	// Temperature is unset (inherited) when absent, so 0 can be set.
+	Temperature *float64 `json:"temperature,omitempty"`
 }
 
 // ChannelsConfig holds all channel configurations.
@@ -85,6 +320,7 @@ type DiscordConfig struct {
 	Token     string   `json:"token"`
 	AllowFrom []string `json:"allowFrom"`
 	Intents   int      `json:"intents"`
+	FollowUp  string   `json:"followUp,omitempty"` // overrides agents.defaults.followUp
 }
 
 // ProvidersConfig holds LLM provider settings.
@@ -94,6 +330,23 @@ type ProvidersConfig struct {
 	OpenRouter ProviderConfig `json:"openrouter"`
 	DeepSeek   ProviderConfig `json:"deepseek"`
 	Gemini     ProviderConfig `json:"gemini"`
+	Failover   FailoverConfig `json:"failover"`
+}
+
+// FailoverConfig defines an ordered provider chain. When the chain is set,
+// calls go to the first healthy entry and fail over to the next one on rate
+// limits, overloads, auth failures and transport errors.
+type FailoverConfig struct {
+	Chain            []FailoverTarget `json:"chain"`
+	FailureThreshold int              `json:"failureThreshold"` // consecutive failures before a provider is skipped
+	CooldownSeconds  int              `json:"cooldownSeconds"`  // how long a failing provider is skipped
+}
+
+// FailoverTarget is one provider/model entry in a failover chain.
+// An empty model on the first entry means agents.defaults.model.
+type FailoverTarget struct {
+	Provider string `json:"provider"` // anthropic, openai, openrouter, deepseek, gemini
+	Model    string `json:"model,omitempty"`
 }
 
 // ProviderConfig holds a single LLM provider's credentials.
@@ -108,6 +361,7 @@ type ToolsConfig struct {
 	Web                 WebToolsConfig `json:"web"`
 	Exec                ExecToolConfig `json:"exec"`
 	RestrictToWorkspace bool           `json:"restrictToWorkspace"`
+	Approval            ApprovalConfig `json:"approval"`
 }
 
 // WebToolsConfig holds web tool settings.
@@ -125,6 +379,20 @@ type ExecToolConfig struct {
 	Timeout int `json:"timeout"`
 }
 
+// ApprovalConfig lists tool calls that wait for the user's confirmation.
+type ApprovalConfig struct {
+	Rules          []ApprovalRule `json:"rules,omitempty"`
+	TimeoutSeconds int            `json:"timeoutSeconds,omitempty"` // unanswered requests are declined; default 120
+}
+
+// ApprovalRule marks matching tool calls as needing approval.
+type ApprovalRule struct {
+	Tool   string `json:"tool"`             // tool name or glob, e.g. "exec", "mcp__github__*"
+	Param  string `json:"param,omitempty"`  // argument to match; empty matches all arguments as JSON
+	Match  string `json:"match,omitempty"`  // regular expression; empty matches every call
+	Reason string `json:"reason,omitempty"` // shown when asking
+}
+
 // DefaultConfig returns a Config with sensible defaults.
 func DefaultConfig() *Config {
 	return &Config{
@@ -156,6 +424,24 @@ type ProviderMatch struct {
 	Config *ProviderConfig
 }
 
+// ProviderByName returns the named provider's config, or nil if the name is
+// not a known provider.
+func (c *Config) ProviderByName(name string) *ProviderConfig {
+	switch strings.ToLower(name) {
+	case "anthropic":
+		return &c.Providers.Anthropic
+	case "openai":
+		return &c.Providers.OpenAI
+	case "openrouter":
+		return &c.Providers.OpenRouter
+	case "deepseek":
+		return &c.Providers.DeepSeek
+	case "gemini":
+		return &c.Providers.Gemini
+	}
+	return nil
+}
+
 // GetProvider returns the first provider config with an API key set,
 // matching by model keyword if possible. Returns name and config.
 func (c *Config) GetProvider() *ProviderMatch {
@@ -56,3 +56,33 @@ func TestValidateRejectsInvalid(t *testing.T) {
 	}
 	t.Log(err)
 }
+
+func TestProfileInheritsDefaults(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = "/srv/main"
+	cfg.Agents.Profiles = map[string]config.AgentProfile{
+		"ops": {Workspace: "/srv/ops", Model: "deepseek-chat", Tools: []string{"exec"}},
+	}
+
+	ops, ok := cfg.Profile("ops")
+	if !ok {
+		t.Fatal("profile ops not found")
+	}
+	if ops.Workspace != "/srv/ops" || ops.Model != "deepseek-chat" {
+		t.Errorf("ops overrides lost: %+v", ops)
+	}
+	if ops.MaxTokens != cfg.Agents.Defaults.MaxTokens || ops.MemoryWindow != cfg.Agents.Defaults.MemoryWindow {
+		t.Errorf("ops did not inherit defaults: %+v", ops)
+	}
+
+	def, ok := cfg.Profile(config.DefaultProfile)
+	if !ok || def.Workspace != "/srv/main" || def.Model != cfg.Agents.Defaults.Model {
+		t.Errorf("default profile = %+v, %v", def, ok)
+	}
+	if _, ok := cfg.Profile("missing"); ok {
+		t.Error("unknown profile reported as found")
+	}
+	if got := cfg.ProfileNames(); len(got) != 2 || got[0] != "default" || got[1] != "ops" {
+		t.Errorf("ProfileNames = %v", got)
+	}
+}
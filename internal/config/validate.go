@@ -2,7 +2,9 @@ package config
 
 import (
 	"fmt"
+	"path"
 	"reflect"
+	"regexp"
 	"sort"
 	"strings"
 )
@@ -32,21 +34,138 @@ func (c *Config) validate() []string {
 	if d.ContextLimit < 0 {
 		errs = append(errs, "agents.defaults.contextLimit must be non-negative")
 	}
+	if d.MaxConcurrentSessions < 0 {
+		errs = append(errs, "agents.defaults.maxConcurrentSessions must be non-negative")
+	}
+	errs = append(errs, validateFollowUp("agents.defaults.followUp", d.FollowUp)...)
 	if d.Temperature < 0 || d.Temperature > 2 {
 		errs = append(errs, "agents.defaults.temperature must be between 0 and 2")
 	}
+	if d.ThinkingBudget != 0 && d.ThinkingBudget < 1024 {
+		errs = append(errs, "agents.defaults.thinkingBudget must be 0 (off) or at least 1024")
+	}
+	switch d.ReasoningEffort {
+	case "", "low", "medium", "high":
+	default:
+		errs = append(errs, fmt.Sprintf("agents.defaults.reasoningEffort: unknown level %q (want low, medium or high)", d.ReasoningEffort))
+	}
+	errs = append(errs, validateToolHistory("agents.defaults", d.ToolHistory, d.ToolResultChars)...)
+	errs = append(errs, c.validateModelRole("agents.defaults.utility", d.Utility)...)
+	errs = append(errs, c.validateModelRole("agents.defaults.subagent", d.Subagent)...)
+	errs = append(errs, c.validateSpawn("agents.defaults.spawn", d.Spawn)...)
+
+	// agents.profiles and agents.routes
+	for _, name := range c.ProfileNames() {
+		if p, ok := c.Agents.Profiles[name]; ok {
+			errs = append(errs, c.validateProfile("agents.profiles."+name, p)...)
+		}
+	}
+	for i, r := range c.Agents.Routes {
+		if _, ok := c.Profile(r.Profile); !ok {
+			errs = append(errs, fmt.Sprintf("agents.routes[%d]: unknown profile %q", i, r.Profile))
+		}
+	}
+
+	// providers.failover
+	fo := c.Providers.Failover
+	for i, t := range fo.Chain {
+		pc := c.ProviderByName(t.Provider)
+		switch {
+		case pc == nil:
+			errs = append(errs, fmt.Sprintf("providers.failover.chain[%d]: unknown provider %q", i, t.Provider))
+		case pc.APIKey == "":
+			errs = append(errs, fmt.Sprintf("providers.failover.chain[%d]: provider %q has no apiKey", i, t.Provider))
+		}
+	}
+	if fo.FailureThreshold < 0 {
+		errs = append(errs, "providers.failover.failureThreshold must be non-negative")
+	}
+	if fo.CooldownSeconds < 0 {
+		errs = append(errs, "providers.failover.cooldownSeconds must be non-negative")
+	}
 
 	// channels.discord
 	dc := c.Channels.Discord
 	if dc.Enabled && dc.Token == "" {
 		errs = append(errs, "channels.discord.token is required when discord is enabled")
 	}
+	errs = append(errs, validateFollowUp("channels.discord.followUp", dc.FollowUp)...)
 
 	// tools.exec
 	if c.Tools.Exec.Timeout < 0 {
 		errs = append(errs, "tools.exec.timeout must be non-negative")
 	}
 
+	// tools.approval
+	ac := c.Tools.Approval
+	for i, r := range ac.Rules {
+		if _, err := path.Match(r.Tool, ""); r.Tool == "" || err != nil {
+			errs = append(errs, fmt.Sprintf("tools.approval.rules[%d].tool must be a tool name or pattern", i))
+		}
+		if _, err := regexp.Compile(r.Match); err != nil {
+			errs = append(errs, fmt.Sprintf("tools.approval.rules[%d].match: %v", i, err))
+		}
+	}
+	if ac.TimeoutSeconds < 0 {
+		errs = append(errs, "tools.approval.timeoutSeconds must be non-negative")
+	}
+
+	// hooks
+	for i, h := range c.Hooks {
+		p := fmt.Sprintf("hooks[%d]", i)
+		switch h.Event {
+		case "beforeMessage", "afterMessage", "beforeLLM", "afterLLM":
+			if h.Tool != "" {
+				errs = append(errs, p+".tool only applies to beforeTool and afterTool")
+			}
+		case "beforeTool", "afterTool":
+			if _, err := path.Match(h.Tool, ""); err != nil {
+				errs = append(errs, fmt.Sprintf("%s.tool: %v", p, err))
+			}
+		default:
+			errs = append(errs, fmt.Sprintf("%s.event: unknown event %q (want beforeMessage, afterMessage, beforeLLM, afterLLM, beforeTool or afterTool)", p, h.Event))
+		}
+		if h.Command == "" {
+			errs = append(errs, p+".command is required")
+		}
+		if h.TimeoutSeconds < 0 {
+			errs = append(errs, p+".timeoutSeconds must be non-negative")
+		}
+		for _, name := range h.Profiles {
+			if _, ok := c.Profile(name); !ok {
+				errs = append(errs, fmt.Sprintf("%s.profiles: unknown profile %q", p, name))
+			}
+		}
+	}
+
+	// usage.prices
+	models := make([]string, 0, len(c.Usage.Prices))
+	for model := range c.Usage.Prices {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	for _, model := range models {
+		if price := c.Usage.Prices[model]; price.Input < 0 || price.Output < 0 || price.CacheRead < 0 || price.CacheWrite < 0 {
+			errs = append(errs, fmt.Sprintf("usage.prices.%s: prices must be non-negative", model))
+		}
+	}
+
+	// usage.budgets
+	b := c.Usage.Budgets
+	errs = append(errs, validateBudget("usage.budgets.turn", b.Turn)...)
+	errs = append(errs, validateBudget("usage.budgets.session", b.Session)...)
+	channels := make([]string, 0, len(b.Channels))
+	for ch := range b.Channels {
+		channels = append(channels, ch)
+	}
+	sort.Strings(channels)
+	for _, ch := range channels {
+		errs = append(errs, validateBudget("usage.budgets.channels."+ch, b.Channels[ch])...)
+	}
+	if b.WarnAt < 0 || b.WarnAt > 1 {
+		errs = append(errs, "usage.budgets.warnAt must be between 0 and 1")
+	}
+
 	// services.heartbeat
 	hb := c.Services.Heartbeat
 	if hb.Enabled && hb.IntervalS <= 0 {
@@ -56,6 +175,139 @@ func (c *Config) validate() []string {
 	return errs
 }
 
+func validateBudget(path string, b BudgetLimits) []string {
+	var errs []string
+	if b.Tokens < 0 || b.Cost < 0 || b.Seconds < 0 || b.ToolCalls < 0 {
+		errs = append(errs, path+": limits must be non-negative")
+	}
+	for name, n := range b.Tools {
+		if n < 0 {
+			errs = append(errs, fmt.Sprintf("%s.tools.%s must be non-negative", path, name))
+		}
+	}
+	return errs
+}
+
+func (c *Config) validateModelRole(path string, r *ModelRole) []string {
+	if r == nil {
+		return nil
+	}
+	var errs []string
+	if r.Provider != "" {
+		switch pc := c.ProviderByName(r.Provider); {
+		case pc == nil:
+			errs = append(errs, fmt.Sprintf("%s.provider: unknown provider %q", path, r.Provider))
+		case pc.APIKey == "":
+			errs = append(errs, fmt.Sprintf("%s.provider: provider %q has no apiKey", path, r.Provider))
+		}
+	}
+	if r.MaxTokens < 0 {
+		errs = append(errs, path+".maxTokens must be non-negative")
+	}
+	if t := r.Temperature; t != nil && (*t < 0 || *t > 2) {
+		errs = append(errs, path+".temperature must be between 0 and 2")
+	}
+	return errs
+}
+
+func (c *Config) validateProfile(path string, p AgentProfile) []string {
+	errs := c.validateModelRole(path, &ModelRole{
+		Provider: p.Provider, Model: p.Model, MaxTokens: p.MaxTokens, Temperature: &p.Temperature,
+	})
+	if p.MaxToolIterations < 0 {
+		errs = append(errs, path+".maxToolIterations must be non-negative")
+	}
+	if p.MemoryWindow < 0 {
+		errs = append(errs, path+".memoryWindow must be non-negative")
+	}
+	if p.ContextLimit < 0 {
+		errs = append(errs, path+".contextLimit must be non-negative")
+	}
+	if p.ThinkingBudget != 0 && p.ThinkingBudget < 1024 {
+		errs = append(errs, path+".thinkingBudget must be 0 (off) or at least 1024")
+	}
+	switch p.ReasoningEffort {
+	case "", "low", "medium", "high":
+	default:
+		errs = append(errs, fmt.Sprintf("%s.reasoningEffort: unknown level %q (want low, medium or high)", path, p.ReasoningEffort))
+	}
+	errs = append(errs, validateToolHistory(path, p.ToolHistory, p.ToolResultChars)...)
+	errs = append(errs, c.validateModelRole(path+".utility", p.Utility)...)
+	errs = append(errs, c.validateModelRole(path+".subagent", p.Subagent)...)
+	errs = append(errs, c.validateSpawn(path+".spawn", p.Spawn)...)
+	for _, server := range p.MCPServers {
+		if _, ok := c.MCP.Servers[server]; !ok {
+			errs = append(errs, fmt.Sprintf("%s.mcpServers: unknown server %q", path, server))
+		}
+	}
+	return errs
+}
+
+func (c *Config) validateSpawn(prefix string, s *SpawnConfig) []string {
+	if s == nil {
+		return nil
+	}
+	var errs []string
+	profiles := make([]string, 0, len(s.Profiles))
+	for name := range s.Profiles {
+		profiles = append(profiles, name)
+	}
+	sort.Strings(profiles)
+	for _, name := range profiles {
+		if len(s.Profiles[name]) == 0 {
+			errs = append(errs, fmt.Sprintf("%s.profiles.%s lists no tools", prefix, name))
+		}
+		for _, pattern := range s.Profiles[name] {
+			if _, err := path.Match(pattern, ""); pattern == "" || err != nil {
+				errs = append(errs, fmt.Sprintf("%s.profiles.%s: %q is not a tool name or pattern", prefix, name, pattern))
+			}
+		}
+	}
+	models := make([]string, 0, len(s.Models))
+	for name := range s.Models {
+		models = append(models, name)
+	}
+	sort.Strings(models)
+	for _, name := range models {
+		r := s.Models[name]
+		errs = append(errs, c.validateModelRole(prefix+".models."+name, &r)...)
+	}
+	if s.MaxIterations < 0 {
+		errs = append(errs, prefix+".maxIterations must be non-negative")
+	}
+	if s.TimeoutSeconds < 0 {
+		errs = append(errs, prefix+".timeoutSeconds must be non-negative")
+	}
+	if s.MaxGroupSize < 0 {
+		errs = append(errs, prefix+".maxGroupSize must be non-negative")
+	}
+	if s.GroupTimeoutSeconds < 0 {
+		errs = append(errs, prefix+".groupTimeoutSeconds must be non-negative")
+	}
+	return errs
+}
+
+func validateFollowUp(path, policy string) []string {
+	switch policy {
+	case "", "interrupt", "queue", "coalesce":
+		return nil
+	}
+	return []string{fmt.Sprintf("%s: unknown policy %q (want interrupt, queue or coalesce)", path, policy)}
+}
+
+func validateToolHistory(path, detail string, resultChars int) []string {
+	var errs []string
+	switch detail {
+	case "", "full", "calls", "none":
+	default:
+		errs = append(errs, fmt.Sprintf("%s.toolHistory: unknown level %q (want full, calls or none)", path, detail))
+	}
+	if resultChars < 0 {
+		errs = append(errs, path+".toolResultChars must be non-negative")
+	}
+	return errs
+}
+
 // CheckUnknownFields walks the raw config map and returns paths of any keys
 // that do not correspond to known Config struct fields.
 func CheckUnknownFields(raw map[string]any) []string {
@@ -41,6 +41,46 @@ func (p *AnthropicProvider) DefaultModel() string {
 }
 
 func (p *AnthropicProvider) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	resp, err := p.do(ctx, p.buildBody(req))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseAnthropicError(resp.StatusCode, resp.Header, respBody)
+	}
+
+	return p.parseResponse(respBody)
+}
+
+// ChatStream sends a streaming Messages API request and assembles the event
+// stream into a ChatResponse, reporting deltas to onEvent as they arrive.
+func (p *AnthropicProvider) ChatStream(ctx context.Context, req ChatRequest, onEvent StreamHandler) (*ChatResponse, error) {
+	body := p.buildBody(req)
+	body["stream"] = true
+
+	resp, err := p.do(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, parseAnthropicError(resp.StatusCode, resp.Header, respBody)
+	}
+
+	return p.parseStream(resp.Body, onEvent)
+}
+
+// buildBody converts a ChatRequest into a Messages API request body.
+func (p *AnthropicProvider) buildBody(req ChatRequest) map[string]any {
 	model := req.Model
 	if model == "" {
 		model = p.defaultModel
@@ -49,24 +89,99 @@ func (p *AnthropicProvider) Chat(ctx context.Context, req ChatRequest) (*ChatRes
 	if maxTokens == 0 {
 		maxTokens = 4096
 	}
+	// The thinking budget counts towards max_tokens and must leave room
+	// for the answer.
+	budget := req.thinkingBudget()
+	if budget > 0 && maxTokens <= budget {
+		maxTokens += budget
+	}
 
 	// Extract system prompt and convert messages
 	systemPrompt, messages := p.convertMessages(req.Messages)
 
+	// Prompt caching: the API caches the prefix up to each cache_control
+	// breakpoint, in the order tools → system → messages. Breakpoints go on
+	// the last tool, the system prompt and the last message, so every ReAct
+	// iteration reads the previous iteration's prefix from cache.
+	markCacheBreakpoint(messages)
 	body := map[string]any{
 		"model":      model,
 		"max_tokens": maxTokens,
 		"messages":   messages,
 	}
+	// Extended thinking does not accept a temperature.
+	if budget > 0 {
+		body["thinking"] = map[string]any{"type": "enabled", "budget_tokens": budget}
+	} else if req.Temperature != nil {
+		body["temperature"] = *req.Temperature
+	}
 	if systemPrompt != "" {
-		body["system"] = systemPrompt
+		body["system"] = []any{map[string]any{
+			"type":          "text",
+			"text":          systemPrompt,
+			"cache_control": ephemeralCache(),
+		}}
 	}
 
 	if len(req.Tools) > 0 {
-		body["tools"] = p.convertTools(req.Tools)
+		tools := p.convertTools(req.Tools)
+		if len(tools) > 0 {
+			tools[len(tools)-1]["cache_control"] = ephemeralCache()
+		}
+		body["tools"] = tools
 		body["tool_choice"] = map[string]any{"type": "auto"}
 	}
+	return body
+}
+
+func ephemeralCache() map[string]any {
+	return map[string]any{"type": "ephemeral"}
+}
+
+// markCacheBreakpoint puts a cache_control marker on the last content block
+// of the last message, converting string content to a text block. Blocks
+// are copied rather than modified since they may belong to the caller.
+func markCacheBreakpoint(messages []map[string]any) {
+	if len(messages) == 0 {
+		return
+	}
+	last := messages[len(messages)-1]
+	blocks := toContentBlocks(last["content"])
+	if len(blocks) == 0 {
+		return
+	}
+	block, ok := blocks[len(blocks)-1].(map[string]any)
+	if !ok {
+		return
+	}
+	if text, isText := block["text"].(string); block["type"] == "text" && (!isText || text == "") {
+		return // empty text blocks cannot be cached
+	}
+	marked := make(map[string]any, len(block)+1)
+	for k, v := range block {
+		marked[k] = v
+	}
+	marked["cache_control"] = ephemeralCache()
+	blocks = append(blocks[:len(blocks)-1:len(blocks)-1], marked)
+	last["content"] = blocks
+}
+
+// anthropicUsage converts Messages API token counts to ChatResponse.Usage.
+// input_tokens excludes cached tokens, so prompt_tokens adds them back to
+// match the other providers; cache reads and writes are reported separately.
+func anthropicUsage(input, output, cacheRead, cacheWrite int) map[string]int {
+	prompt := input + cacheRead + cacheWrite
+	return map[string]int{
+		"prompt_tokens":      prompt,
+		"completion_tokens":  output,
+		"total_tokens":       prompt + output,
+		"cache_read_tokens":  cacheRead,
+		"cache_write_tokens": cacheWrite,
+	}
+}
 
+// do posts a request body to the Messages API endpoint.
+func (p *AnthropicProvider) do(ctx context.Context, body map[string]any) (*http.Response, error) {
 	jsonBody, err := json.Marshal(body)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request: %w", err)
@@ -89,21 +204,7 @@ func (p *AnthropicProvider) Chat(ctx context.Context, req ChatRequest) (*ChatRes
 	if err != nil {
 		return nil, fmt.Errorf("http request: %w", err)
 	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("read response: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return &ChatResponse{
-			Content:      fmt.Sprintf("Error calling LLM (HTTP %d): %s", resp.StatusCode, string(respBody)),
-			FinishReason: "error",
-		}, nil
-	}
-
-	return p.parseResponse(respBody)
+	return resp, nil
 }
 
 // convertMessages extracts the system prompt and converts OpenAI message format
@@ -153,7 +254,7 @@ func (p *AnthropicProvider) convertMessages(msgs []map[string]any) (string, []ma
 		case "user":
 			result = append(result, map[string]any{
 				"role":    "user",
-				"content": msg["content"],
+				"content": p.convertUserContent(msg["content"]),
 			})
 		}
 	}
@@ -165,11 +266,46 @@ func (p *AnthropicProvider) convertMessages(msgs []map[string]any) (string, []ma
 	return system, result
 }
 
+// convertUserContent converts OpenAI content parts to Anthropic content
+// blocks: images become image blocks and files (PDFs) document blocks.
+// String content is returned unchanged.
+func (p *AnthropicProvider) convertUserContent(content any) any {
+	parts := contentParts(content)
+	if parts == nil {
+		return content
+	}
+	blocks := make([]any, 0, len(parts))
+	for _, part := range parts {
+		switch part["type"] {
+		case "image_url", "file":
+			typ := "image"
+			if part["type"] == "file" {
+				typ = "document"
+			}
+			mimeType, data, url := mediaSource(part)
+			source := map[string]any{"type": "base64", "media_type": mimeType, "data": data}
+			if url != "" {
+				source = map[string]any{"type": "url", "url": url}
+			}
+			blocks = append(blocks, map[string]any{"type": typ, "source": source})
+		default:
+			blocks = append(blocks, part)
+		}
+	}
+	return blocks
+}
+
 // convertAssistantMessage converts an OpenAI assistant message (with optional tool_calls)
 // to Anthropic format (content blocks).
 func (p *AnthropicProvider) convertAssistantMessage(msg map[string]any) map[string]any {
 	var contentBlocks []any
 
+	// Thinking blocks go first and are sent back unmodified: the API
+	// verifies their signatures when a tool-use turn continues.
+	for _, block := range contentParts(msg["thinking_blocks"]) {
+		contentBlocks = append(contentBlocks, block)
+	}
+
 	// Add text content if present
 	if content, _ := msg["content"].(string); content != "" {
 		contentBlocks = append(contentBlocks, map[string]any{
@@ -257,16 +393,21 @@ func (p *AnthropicProvider) convertTools(tools []map[string]any) []map[string]an
 func (p *AnthropicProvider) parseResponse(data []byte) (*ChatResponse, error) {
 	var raw struct {
 		Content []struct {
-			Type  string          `json:"type"`
-			Text  string          `json:"text"`
-			ID    string          `json:"id"`
-			Name  string          `json:"name"`
-			Input json.RawMessage `json:"input"`
+			Type      string          `json:"type"`
+			Text      string          `json:"text"`
+			Thinking  string          `json:"thinking"`
+			Signature string          `json:"signature"`
+			Data      string          `json:"data"`
+			ID        string          `json:"id"`
+			Name      string          `json:"name"`
+			Input     json.RawMessage `json:"input"`
 		} `json:"content"`
 		StopReason string `json:"stop_reason"`
 		Usage      struct {
-			InputTokens  int `json:"input_tokens"`
-			OutputTokens int `json:"output_tokens"`
+			InputTokens              int `json:"input_tokens"`
+			OutputTokens             int `json:"output_tokens"`
+			CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+			CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
 		} `json:"usage"`
 		Error *struct {
 			Type    string `json:"type"`
@@ -279,26 +420,25 @@ func (p *AnthropicProvider) parseResponse(data []byte) (*ChatResponse, error) {
 	}
 
 	if raw.Error != nil {
-		return &ChatResponse{
-			Content:      "Error calling LLM: " + raw.Error.Message,
-			FinishReason: "error",
-		}, nil
+		return nil, newAPIError("anthropic", 0, nil, raw.Error.Type, raw.Error.Message)
 	}
 
 	result := &ChatResponse{
 		FinishReason: raw.StopReason,
-		Usage: map[string]int{
-			"prompt_tokens":     raw.Usage.InputTokens,
-			"completion_tokens": raw.Usage.OutputTokens,
-			"total_tokens":      raw.Usage.InputTokens + raw.Usage.OutputTokens,
-		},
+		Usage: anthropicUsage(raw.Usage.InputTokens, raw.Usage.OutputTokens,
+			raw.Usage.CacheReadInputTokens, raw.Usage.CacheCreationInputTokens),
 	}
 
-	var textParts []string
+	var textParts, thinkingParts []string
 	for _, block := range raw.Content {
 		switch block.Type {
 		case "text":
 			textParts = append(textParts, block.Text)
+		case "thinking":
+			thinkingParts = append(thinkingParts, block.Thinking)
+			result.ThinkingBlocks = append(result.ThinkingBlocks, thinkingBlock(block.Thinking, block.Signature))
+		case "redacted_thinking":
+			result.ThinkingBlocks = append(result.ThinkingBlocks, redactedThinkingBlock(block.Data))
 		case "tool_use":
 			var args map[string]any
 			if err := json.Unmarshal(block.Input, &args); err != nil {
@@ -315,18 +455,209 @@ func (p *AnthropicProvider) parseResponse(data []byte) (*ChatResponse, error) {
 		}
 	}
 	result.Content = joinNonEmpty(textParts, "\n")
+	result.ReasoningContent = joinNonEmpty(thinkingParts, "\n")
 
 	// Map Anthropic stop_reason to OpenAI finish_reason
-	switch result.FinishReason {
-	case "end_turn":
-		result.FinishReason = "stop"
-	case "tool_use":
-		result.FinishReason = "tool_calls"
+	result.FinishReason = mapStopReason(result.FinishReason)
+
+	if err := checkFiltered("anthropic", result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// parseStream assembles a Messages API event stream into a ChatResponse.
+// Content blocks are tracked by index; tool_use input arrives as partial JSON
+// and is decoded once its block stops.
+func (p *AnthropicProvider) parseStream(r io.Reader, onEvent StreamHandler) (*ChatResponse, error) {
+	type block struct {
+		typ       string
+		id        string
+		name      string
+		text      []byte
+		input     []byte
+		signature string
+		data      string // redacted_thinking payload
+	}
+
+	result := &ChatResponse{}
+	blocks := make(map[int]*block)
+	var order []int
+	var inputTokens, outputTokens, cacheRead, cacheWrite int
+	var streamErr *APIError
+
+	err := readSSE(r, func(ev sseEvent) bool {
+		if ev.Data == "" {
+			return true
+		}
+		var raw struct {
+			Type    string `json:"type"`
+			Index   int    `json:"index"`
+			Message struct {
+				Usage struct {
+					InputTokens              int `json:"input_tokens"`
+					OutputTokens             int `json:"output_tokens"`
+					CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+					CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+				} `json:"usage"`
+			} `json:"message"`
+			ContentBlock struct {
+				Type     string `json:"type"`
+				ID       string `json:"id"`
+				Name     string `json:"name"`
+				Text     string `json:"text"`
+				Thinking string `json:"thinking"`
+				Data     string `json:"data"`
+			} `json:"content_block"`
+			Delta struct {
+				Type        string `json:"type"`
+				Text        string `json:"text"`
+				Thinking    string `json:"thinking"`
+				Signature   string `json:"signature"`
+				PartialJSON string `json:"partial_json"`
+				StopReason  string `json:"stop_reason"`
+			} `json:"delta"`
+			Usage struct {
+				OutputTokens int `json:"output_tokens"`
+			} `json:"usage"`
+			Error *struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(ev.Data), &raw); err != nil {
+			return true
+		}
+
+		switch raw.Type {
+		case "message_start":
+			inputTokens = raw.Message.Usage.InputTokens
+			outputTokens = raw.Message.Usage.OutputTokens
+			cacheRead = raw.Message.Usage.CacheReadInputTokens
+			cacheWrite = raw.Message.Usage.CacheCreationInputTokens
+		case "content_block_start":
+			b := &block{
+				typ:  raw.ContentBlock.Type,
+				id:   raw.ContentBlock.ID,
+				name: raw.ContentBlock.Name,
+				text: []byte(raw.ContentBlock.Text + raw.ContentBlock.Thinking),
+				data: raw.ContentBlock.Data,
+			}
+			blocks[raw.Index] = b
+			order = append(order, raw.Index)
+		case "content_block_delta":
+			b := blocks[raw.Index]
+			if b == nil {
+				return true
+			}
+			switch raw.Delta.Type {
+			case "text_delta":
+				b.text = append(b.text, raw.Delta.Text...)
+				emit(onEvent, StreamEvent{Type: StreamText, Delta: raw.Delta.Text})
+			case "thinking_delta":
+				b.text = append(b.text, raw.Delta.Thinking...)
+				emit(onEvent, StreamEvent{Type: StreamReasoning, Delta: raw.Delta.Thinking})
+			case "signature_delta":
+				b.signature += raw.Delta.Signature
+			case "input_json_delta":
+				b.input = append(b.input, raw.Delta.PartialJSON...)
+			}
+		case "content_block_stop":
+			b := blocks[raw.Index]
+			if b == nil || b.typ != "tool_use" {
+				return true
+			}
+			tc := ToolCallRequest{ID: b.id, Name: b.name, Arguments: decodeToolInput(b.name, b.input)}
+			emit(onEvent, StreamEvent{Type: StreamToolCall, ToolCall: &tc})
+		case "message_delta":
+			if raw.Delta.StopReason != "" {
+				result.FinishReason = raw.Delta.StopReason
+			}
+			if raw.Usage.OutputTokens > 0 {
+				outputTokens = raw.Usage.OutputTokens
+			}
+		case "message_stop":
+			return false
+		case "error":
+			if raw.Error != nil {
+				streamErr = newAPIError("anthropic", 0, nil, raw.Error.Type, raw.Error.Message)
+			}
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read stream: %w", err)
+	}
+	if streamErr != nil {
+		return nil, streamErr
 	}
 
+	var textParts, thinkingParts []string
+	for _, i := range order {
+		b := blocks[i]
+		switch b.typ {
+		case "text":
+			textParts = append(textParts, string(b.text))
+		case "thinking":
+			thinkingParts = append(thinkingParts, string(b.text))
+			result.ThinkingBlocks = append(result.ThinkingBlocks, thinkingBlock(string(b.text), b.signature))
+		case "redacted_thinking":
+			result.ThinkingBlocks = append(result.ThinkingBlocks, redactedThinkingBlock(b.data))
+		case "tool_use":
+			result.ToolCalls = append(result.ToolCalls, ToolCallRequest{
+				ID:        b.id,
+				Name:      b.name,
+				Arguments: decodeToolInput(b.name, b.input),
+			})
+		}
+	}
+	result.Content = joinNonEmpty(textParts, "\n")
+	result.ReasoningContent = joinNonEmpty(thinkingParts, "\n")
+	result.Usage = anthropicUsage(inputTokens, outputTokens, cacheRead, cacheWrite)
+	result.FinishReason = mapStopReason(result.FinishReason)
+
+	if err := checkFiltered("anthropic", result); err != nil {
+		return nil, err
+	}
 	return result, nil
 }
 
+func thinkingBlock(thinking, signature string) map[string]any {
+	return map[string]any{"type": "thinking", "thinking": thinking, "signature": signature}
+}
+
+func redactedThinkingBlock(data string) map[string]any {
+	return map[string]any{"type": "redacted_thinking", "data": data}
+}
+
+// decodeToolInput decodes accumulated tool_use input JSON. An empty input is
+// a call with no arguments.
+func decodeToolInput(name string, input []byte) map[string]any {
+	if len(input) == 0 {
+		return map[string]any{}
+	}
+	var args map[string]any
+	if err := json.Unmarshal(input, &args); err != nil {
+		slog.Warn("failed to parse tool call arguments", "tool", name, "input", string(input), "err", err)
+		return map[string]any{"raw": string(input)}
+	}
+	return args
+}
+
+// mapStopReason maps an Anthropic stop_reason to an OpenAI finish_reason.
+func mapStopReason(reason string) string {
+	switch reason {
+	case "end_turn":
+		return "stop"
+	case "tool_use":
+		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	}
+	return reason
+}
+
 // mergeConsecutiveRoles ensures messages alternate between user and assistant
 // by merging consecutive same-role messages.
 func mergeConsecutiveRoles(msgs []map[string]any) []map[string]any {
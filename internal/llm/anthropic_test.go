@@ -0,0 +1,150 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAnthropicPromptCaching(t *testing.T) {
+	var gotBody map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &gotBody)
+		w.Write([]byte(`{
+			"content": [{"type": "text", "text": "Done."}],
+			"stop_reason": "end_turn",
+			"usage": {"input_tokens": 50, "output_tokens": 10, "cache_read_input_tokens": 4000, "cache_creation_input_tokens": 300}
+		}`))
+	}))
+	defer srv.Close()
+
+	userBlocks := []any{map[string]any{"type": "text", "text": "look at this"}}
+	p := NewAnthropicProvider("key", srv.URL, "claude-test", nil)
+	resp, err := p.Chat(context.Background(), ChatRequest{
+		Messages: []map[string]any{
+			{"role": "system", "content": "You are nagobot."},
+			{"role": "user", "content": "hi"},
+			{"role": "assistant", "content": "", "tool_calls": []map[string]any{{
+				"id": "call_1", "type": "function",
+				"function": map[string]any{"name": "exec", "arguments": `{"command":"ls"}`},
+			}}},
+			{"role": "tool", "tool_call_id": "call_1", "name": "exec", "content": "a.txt"},
+			{"role": "user", "content": userBlocks},
+		},
+		Tools: []map[string]any{
+			{"type": "function", "function": map[string]any{"name": "read_file", "parameters": map[string]any{"type": "object"}}},
+			{"type": "function", "function": map[string]any{"name": "exec", "parameters": map[string]any{"type": "object"}}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cached := func(v any) bool {
+		m, _ := v.(map[string]any)
+		cc, _ := m["cache_control"].(map[string]any)
+		return cc["type"] == "ephemeral"
+	}
+
+	system, _ := gotBody["system"].([]any)
+	if len(system) != 1 || !cached(system[0]) {
+		t.Errorf("system = %v, want one cached text block", gotBody["system"])
+	}
+	tools, _ := gotBody["tools"].([]any)
+	if len(tools) != 2 || cached(tools[0]) || !cached(tools[1]) {
+		t.Errorf("tools = %v, want breakpoint on the last tool only", tools)
+	}
+	msgs, _ := gotBody["messages"].([]any)
+	last, _ := msgs[len(msgs)-1].(map[string]any)
+	blocks, _ := last["content"].([]any)
+	// The tool result and the follow-up user text merge into one message;
+	// only its final block carries the breakpoint.
+	if len(blocks) != 2 || cached(blocks[0]) || !cached(blocks[1]) {
+		t.Errorf("last message content = %v, want breakpoint on the final block", blocks)
+	}
+	if _, ok := userBlocks[0].(map[string]any)["cache_control"]; ok {
+		t.Error("caller's content block was modified")
+	}
+
+	want := map[string]int{
+		"prompt_tokens":      4350,
+		"completion_tokens":  10,
+		"total_tokens":       4360,
+		"cache_read_tokens":  4000,
+		"cache_write_tokens": 300,
+	}
+	for k, v := range want {
+		if resp.Usage[k] != v {
+			t.Errorf("Usage[%s] = %d, want %d", k, resp.Usage[k], v)
+		}
+	}
+}
+
+func TestAnthropicThinkingRoundTrip(t *testing.T) {
+	var gotBody map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &gotBody)
+		w.Write([]byte(`{
+			"content": [
+				{"type": "thinking", "thinking": "Need the file list.", "signature": "sig-1"},
+				{"type": "redacted_thinking", "data": "opaque"},
+				{"type": "tool_use", "id": "toolu_1", "name": "exec", "input": {"command": "ls"}}
+			],
+			"stop_reason": "tool_use",
+			"usage": {"input_tokens": 10, "output_tokens": 5}
+		}`))
+	}))
+	defer srv.Close()
+
+	p := NewAnthropicProvider("key", srv.URL, "claude-test", nil)
+	req := ChatRequest{
+		Messages:       []map[string]any{{"role": "user", "content": "list files"}},
+		MaxTokens:      4096,
+		ThinkingBudget: 8000,
+	}
+	resp, err := p.Chat(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ReasoningContent != "Need the file list." || len(resp.ThinkingBlocks) != 2 {
+		t.Fatalf("reasoning = %q, blocks = %v", resp.ReasoningContent, resp.ThinkingBlocks)
+	}
+	thinking, _ := gotBody["thinking"].(map[string]any)
+	if thinking["budget_tokens"] != float64(8000) || gotBody["max_tokens"] != float64(12096) {
+		t.Errorf("thinking = %v, max_tokens = %v", gotBody["thinking"], gotBody["max_tokens"])
+	}
+
+	// Continue the tool-use turn: the thinking blocks must lead the
+	// assistant message, signatures intact.
+	req.Messages = append(req.Messages,
+		map[string]any{
+			"role": "assistant", "content": "",
+			"tool_calls": []map[string]any{{
+				"id": "toolu_1", "type": "function",
+				"function": map[string]any{"name": "exec", "arguments": `{"command":"ls"}`},
+			}},
+			"thinking_blocks": resp.ThinkingBlocks,
+		},
+		map[string]any{"role": "tool", "tool_call_id": "toolu_1", "name": "exec", "content": "a.txt"},
+	)
+	if _, err := p.Chat(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	msgs, _ := gotBody["messages"].([]any)
+	assistant, _ := msgs[1].(map[string]any)
+	blocks, _ := assistant["content"].([]any)
+	if len(blocks) != 3 {
+		t.Fatalf("assistant content = %v", blocks)
+	}
+	first, _ := blocks[0].(map[string]any)
+	second, _ := blocks[1].(map[string]any)
+	third, _ := blocks[2].(map[string]any)
+	if first["type"] != "thinking" || first["signature"] != "sig-1" || second["type"] != "redacted_thinking" || third["type"] != "tool_use" {
+		t.Errorf("assistant content = %v, want thinking, redacted_thinking, tool_use", blocks)
+	}
+}
@@ -0,0 +1,145 @@
+package llm
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Pre-tokenization patterns of the tiktoken encodings. The originals end
+// with `\s+(?!\S)|\s+`; RE2 has no lookahead, so BPE.split emulates it.
+const (
+	cl100kPattern = `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`
+	o200kPattern  = `[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+		`|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+		`|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+`
+)
+
+// BPE is a byte-level BPE tokenizer using tiktoken merge ranks, as used by
+// OpenAI models. It runs fully offline from a .tiktoken rank file.
+type BPE struct {
+	name    string
+	ranks   map[string]int
+	pattern *regexp.Regexp
+}
+
+// NewBPE creates a tokenizer from merge ranks and a pre-tokenization regex.
+func NewBPE(name string, ranks map[string]int, pattern string) (*BPE, error) {
+	re, err := regexp.Compile(`^(?:` + pattern + `)`)
+	if err != nil {
+		return nil, fmt.Errorf("compile pattern: %w", err)
+	}
+	return &BPE{name: name, ranks: ranks, pattern: re}, nil
+}
+
+// LoadTiktoken reads a .tiktoken rank file: one base64-encoded token and
+// its rank per line.
+func LoadTiktoken(path string) (map[string]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		token, rank, ok := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		if !ok {
+			continue
+		}
+		b, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		r, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		ranks[string(b)] = r
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ranks, nil
+}
+
+func (t *BPE) Name() string { return t.name }
+
+// Count returns the number of tokens text encodes to.
+func (t *BPE) Count(text string) int {
+	n := 0
+	for _, piece := range t.split(text) {
+		n += t.countPiece(piece)
+	}
+	return n
+}
+
+// split pre-tokenizes text. A whitespace run followed by a non-space
+// character leaves its last character to the next piece, which is what
+// the `\s+(?!\S)` alternative of the original patterns does.
+func (t *BPE) split(text string) []string {
+	var pieces []string
+	for text != "" {
+		loc := t.pattern.FindStringIndex(text)
+		if loc == nil || loc[1] == 0 {
+			// Unmatched input (invalid UTF-8): take one byte.
+			loc = []int{0, 1}
+		}
+		piece := text[:loc[1]]
+		if loc[1] < len(text) && isSpaceRun(piece) {
+			if _, size := utf8.DecodeLastRuneInString(piece); size < len(piece) {
+				piece = piece[:len(piece)-size]
+			}
+		}
+		pieces = append(pieces, piece)
+		text = text[len(piece):]
+	}
+	return pieces
+}
+
+// isSpaceRun reports whether s is all whitespace and does not end a line.
+func isSpaceRun(s string) bool {
+	if strings.HasSuffix(s, "\n") || strings.HasSuffix(s, "\r") {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// countPiece applies byte-pair merges to one piece, always merging the
+// adjacent pair with the lowest rank first.
+func (t *BPE) countPiece(piece string) int {
+	if _, ok := t.ranks[piece]; ok {
+		return 1
+	}
+	// bounds[i] is the start offset of part i; the last entry is len(piece).
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	for len(bounds) > 2 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i+2 < len(bounds); i++ {
+			if r, ok := t.ranks[piece[bounds[i]:bounds[i+2]]]; ok && r < bestRank {
+				best, bestRank = i, r
+			}
+		}
+		if best < 0 {
+			break
+		}
+		bounds = append(bounds[:best+1], bounds[best+2:]...)
+	}
+	return len(bounds) - 1
+}
@@ -0,0 +1,209 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error kinds returned by providers. Match them with errors.Is; use errors.As
+// with *APIError for the status code and Retry-After hint.
+var (
+	ErrContextLength   = errors.New("context length exceeded")
+	ErrRateLimited     = errors.New("rate limited")
+	ErrAuth            = errors.New("authentication failed")
+	ErrOverloaded      = errors.New("provider overloaded")
+	ErrInvalidRequest  = errors.New("invalid request")
+	ErrContentFiltered = errors.New("content filtered")
+	ErrServer          = errors.New("provider server error")
+)
+
+// APIError is a failure reported by an LLM API, classified into one of the
+// Err* kinds above.
+type APIError struct {
+	Kind       error         // one of the Err* sentinels
+	Provider   string        // configured provider name, e.g. "openrouter", "anthropic", "gemini"
+	StatusCode int           // HTTP status, 0 for in-stream errors
+	Message    string        // provider's error message
+	RetryAfter time.Duration // server-requested delay, if any
+}
+
+func (e *APIError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s: %s (HTTP %d): %s", e.Provider, e.Kind, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.Provider, e.Kind, e.Message)
+}
+
+func (e *APIError) Unwrap() error { return e.Kind }
+
+// IsRetryable reports whether err is worth retrying against the same provider.
+// Transport errors (anything that is not an *APIError) are retryable.
+func IsRetryable(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return true
+	}
+	switch apiErr.Kind {
+	case ErrRateLimited, ErrOverloaded, ErrServer:
+		return true
+	}
+	return false
+}
+
+// RetryAfter returns the server-requested retry delay carried by err, or 0.
+func RetryAfter(err error) time.Duration {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.RetryAfter
+	}
+	return 0
+}
+
+// newAPIError builds an APIError from an HTTP failure. errType is the
+// provider's machine-readable error type or code, if any.
+func newAPIError(provider string, status int, header http.Header, errType, message string) *APIError {
+	return &APIError{
+		Kind:       classifyError(status, errType, message),
+		Provider:   provider,
+		StatusCode: status,
+		Message:    message,
+		RetryAfter: parseRetryAfter(header),
+	}
+}
+
+// classifyError maps a status code, provider error type and message to an
+// error kind. Context overflow is recognized by message since providers
+// report it as a generic bad request.
+func classifyError(status int, errType, message string) error {
+	t := strings.ToLower(errType)
+	m := strings.ToLower(message)
+
+	switch {
+	case isContextLengthMessage(t) || isContextLengthMessage(m) || status == http.StatusRequestEntityTooLarge:
+		return ErrContextLength
+	case strings.Contains(t, "content_filter"), strings.Contains(t, "content_policy"),
+		strings.Contains(m, "content management policy"):
+		return ErrContentFiltered
+	case t == "insufficient_quota", status == http.StatusUnauthorized, status == http.StatusForbidden,
+		strings.Contains(t, "authentication"), strings.Contains(t, "permission"),
+		t == "unauthenticated", t == "permission_denied":
+		return ErrAuth
+	case status == http.StatusTooManyRequests, strings.Contains(t, "rate_limit"), t == "resource_exhausted":
+		return ErrRateLimited
+	case status == 529, status == http.StatusServiceUnavailable, strings.Contains(t, "overloaded"), t == "unavailable":
+		return ErrOverloaded
+	case status >= 500:
+		return ErrServer
+	case status >= 400, strings.Contains(t, "invalid"):
+		return ErrInvalidRequest
+	}
+	return ErrServer
+}
+
+func isContextLengthMessage(s string) bool {
+	for _, marker := range []string{
+		"context_length_exceeded",
+		"context length",
+		"context window",
+		"maximum context",
+		"prompt is too long",
+		"too many tokens",
+		"input token count",
+		"exceeds the maximum number of tokens",
+		"request_too_large",
+	} {
+		if strings.Contains(s, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRetryAfter reads Retry-After (seconds or HTTP date) or the
+// non-standard retry-after-ms header.
+func parseRetryAfter(h http.Header) time.Duration {
+	if h == nil {
+		return 0
+	}
+	if ms := h.Get("retry-after-ms"); ms != "" {
+		if n, err := strconv.ParseFloat(ms, 64); err == nil && n > 0 {
+			return time.Duration(n * float64(time.Millisecond))
+		}
+	}
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if n, err := strconv.ParseFloat(v, 64); err == nil && n > 0 {
+		return time.Duration(n * float64(time.Second))
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// parseOpenAIError decodes an OpenAI-compatible error body:
+// {"error": {"message": ..., "type": ..., "code": ...}}.
+func parseOpenAIError(status int, header http.Header, body []byte) *APIError {
+	var raw struct {
+		Error struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+			Code    any    `json:"code"`
+		} `json:"error"`
+	}
+	message := strings.TrimSpace(string(body))
+	errType := ""
+	if json.Unmarshal(body, &raw) == nil && raw.Error.Message != "" {
+		message = raw.Error.Message
+		errType = raw.Error.Type
+		if code, ok := raw.Error.Code.(string); ok && code != "" {
+			errType = code
+		}
+	}
+	return newAPIError("openai", status, header, errType, message)
+}
+
+// parseAnthropicError decodes an Anthropic error body:
+// {"type": "error", "error": {"type": ..., "message": ...}}.
+func parseAnthropicError(status int, header http.Header, body []byte) *APIError {
+	var raw struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	message := strings.TrimSpace(string(body))
+	errType := ""
+	if json.Unmarshal(body, &raw) == nil && raw.Error.Message != "" {
+		message = raw.Error.Message
+		errType = raw.Error.Type
+	}
+	return newAPIError("anthropic", status, header, errType, message)
+}
+
+// parseGeminiError decodes a Google API error body:
+// {"error": {"code": ..., "message": ..., "status": ...}}.
+func parseGeminiError(status int, header http.Header, body []byte) *APIError {
+	var raw struct {
+		Error struct {
+			Message string `json:"message"`
+			Status  string `json:"status"`
+		} `json:"error"`
+	}
+	message := strings.TrimSpace(string(body))
+	errType := ""
+	if json.Unmarshal(body, &raw) == nil && raw.Error.Message != "" {
+		message = raw.Error.Message
+		errType = raw.Error.Status
+	}
+	return newAPIError("gemini", status, header, errType, message)
+}
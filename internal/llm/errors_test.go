@@ -0,0 +1,81 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseProviderErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		parse  func(int, http.Header, []byte) *APIError
+		status int
+		body   string
+		want   error
+	}{
+		{"openai context", parseOpenAIError, 400,
+			`{"error":{"message":"This model's maximum context length is 128000 tokens","type":"invalid_request_error","code":"context_length_exceeded"}}`,
+			ErrContextLength},
+		{"openai rate limit", parseOpenAIError, 429, `{"error":{"message":"slow down","type":"requests"}}`, ErrRateLimited},
+		{"openai quota", parseOpenAIError, 429, `{"error":{"message":"quota","type":"insufficient_quota","code":"insufficient_quota"}}`, ErrAuth},
+		{"openai auth", parseOpenAIError, 401, `{"error":{"message":"Incorrect API key"}}`, ErrAuth},
+		{"openai filter", parseOpenAIError, 400, `{"error":{"message":"flagged","code":"content_filter"}}`, ErrContentFiltered},
+		{"openai bad request", parseOpenAIError, 400, `{"error":{"message":"bad param","type":"invalid_request_error"}}`, ErrInvalidRequest},
+		{"anthropic too long", parseAnthropicError, 400,
+			`{"type":"error","error":{"type":"invalid_request_error","message":"prompt is too long: 210000 tokens > 200000 maximum"}}`,
+			ErrContextLength},
+		{"anthropic overloaded", parseAnthropicError, 529, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`, ErrOverloaded},
+		{"anthropic permission", parseAnthropicError, 403, `{"type":"error","error":{"type":"permission_error","message":"no"}}`, ErrAuth},
+		{"anthropic server", parseAnthropicError, 500, `{"type":"error","error":{"type":"api_error","message":"oops"}}`, ErrServer},
+		{"gemini exhausted", parseGeminiError, 429, `{"error":{"code":429,"message":"Quota exceeded","status":"RESOURCE_EXHAUSTED"}}`, ErrRateLimited},
+		{"gemini tokens", parseGeminiError, 400,
+			`{"error":{"code":400,"message":"The input token count (2000000) exceeds the maximum number of tokens allowed (1048576).","status":"INVALID_ARGUMENT"}}`,
+			ErrContextLength},
+		{"plain text body", parseOpenAIError, 502, `Bad Gateway`, ErrServer},
+	}
+
+	for _, tt := range tests {
+		err := tt.parse(tt.status, nil, []byte(tt.body))
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err.Kind, tt.want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	h := http.Header{}
+	h.Set("Retry-After", "7")
+	if got := parseRetryAfter(h); got != 7*time.Second {
+		t.Errorf("seconds: got %v", got)
+	}
+	h = http.Header{}
+	h.Set("retry-after-ms", "1500")
+	if got := parseRetryAfter(h); got != 1500*time.Millisecond {
+		t.Errorf("ms: got %v", got)
+	}
+	err := parseAnthropicError(429, http.Header{"Retry-After": []string{"3"}}, []byte(`{}`))
+	if RetryAfter(err) != 3*time.Second || IsRetryable(err) != true {
+		t.Errorf("RetryAfter = %v, retryable = %v", RetryAfter(err), IsRetryable(err))
+	}
+	if IsRetryable(parseOpenAIError(401, nil, nil)) {
+		t.Error("auth failures must not be retryable")
+	}
+}
+
+func TestOpenAICompatibleErrorNamesProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"message":"slow down"}}`))
+	}))
+	defer srv.Close()
+
+	_, err := NewOpenAIProvider("deepseek", "key", srv.URL, "deepseek-chat", nil).Chat(context.Background(), ChatRequest{})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Provider != "deepseek" {
+		t.Errorf("err = %#v, want it attributed to deepseek", err)
+	}
+}
@@ -0,0 +1,506 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// GeminiProvider implements the Provider interface using the Gemini
+// generateContent API.
+type GeminiProvider struct {
+	apiKey       string
+	apiBase      string
+	defaultModel string
+	extraHeaders map[string]string
+	client       *http.Client
+}
+
+// NewGeminiProvider creates a new Gemini provider.
+func NewGeminiProvider(apiKey, apiBase, defaultModel string, extraHeaders map[string]string) *GeminiProvider {
+	if apiBase == "" {
+		apiBase = "https://generativelanguage.googleapis.com/v1beta"
+	}
+	if defaultModel == "" {
+		defaultModel = "gemini-2.5-flash"
+	}
+	return &GeminiProvider{
+		apiKey:       apiKey,
+		apiBase:      strings.TrimRight(apiBase, "/"),
+		defaultModel: defaultModel,
+		extraHeaders: extraHeaders,
+		client:       &http.Client{},
+	}
+}
+
+func (p *GeminiProvider) DefaultModel() string {
+	return p.defaultModel
+}
+
+func (p *GeminiProvider) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	resp, err := p.do(ctx, p.modelName(req.Model)+":generateContent", p.buildBody(req))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseGeminiError(resp.StatusCode, resp.Header, respBody)
+	}
+
+	var raw geminiResponse
+	if err := json.Unmarshal(respBody, &raw); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+	if raw.Error != nil {
+		return nil, newAPIError("gemini", raw.Error.Code, nil, raw.Error.Status, raw.Error.Message)
+	}
+
+	acc := newGeminiAccumulator(nil)
+	acc.add(&raw)
+	return acc.result()
+}
+
+// ChatStream calls streamGenerateContent with SSE output. Each event is a
+// partial GenerateContentResponse; text parts are deltas and function calls
+// arrive whole.
+func (p *GeminiProvider) ChatStream(ctx context.Context, req ChatRequest, onEvent StreamHandler) (*ChatResponse, error) {
+	resp, err := p.do(ctx, p.modelName(req.Model)+":streamGenerateContent?alt=sse", p.buildBody(req))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, parseGeminiError(resp.StatusCode, resp.Header, respBody)
+	}
+
+	acc := newGeminiAccumulator(onEvent)
+	var streamErr *APIError
+	err = readSSE(resp.Body, func(ev sseEvent) bool {
+		if ev.Data == "" {
+			return true
+		}
+		var chunk geminiResponse
+		if err := json.Unmarshal([]byte(ev.Data), &chunk); err != nil {
+			return true
+		}
+		if chunk.Error != nil {
+			streamErr = newAPIError("gemini", chunk.Error.Code, nil, chunk.Error.Status, chunk.Error.Message)
+			return false
+		}
+		acc.add(&chunk)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read stream: %w", err)
+	}
+	if streamErr != nil {
+		return nil, streamErr
+	}
+	return acc.result()
+}
+
+// modelName strips routing prefixes such as "google/" from a model ID.
+func (p *GeminiProvider) modelName(model string) string {
+	if model == "" {
+		model = p.defaultModel
+	}
+	for _, prefix := range []string{"models/", "google/", "gemini/"} {
+		model = strings.TrimPrefix(model, prefix)
+	}
+	return model
+}
+
+// buildBody converts a ChatRequest into a generateContent request body.
+func (p *GeminiProvider) buildBody(req ChatRequest) map[string]any {
+	maxTokens := req.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = 4096
+	}
+	system, contents := p.convertMessages(req.Messages)
+
+	// Thinking tokens count towards maxOutputTokens.
+	budget := req.thinkingBudget()
+	if budget > 0 && maxTokens <= budget {
+		maxTokens += budget
+	}
+	genConfig := map[string]any{
+		"maxOutputTokens": maxTokens,
+	}
+	if req.Temperature != nil {
+		genConfig["temperature"] = *req.Temperature
+	}
+	if budget > 0 {
+		genConfig["thinkingConfig"] = map[string]any{
+			"thinkingBudget":  budget,
+			"includeThoughts": true,
+		}
+	}
+	body := map[string]any{
+		"contents":         contents,
+		"generationConfig": genConfig,
+	}
+	if system != "" {
+		body["systemInstruction"] = map[string]any{
+			"parts": []any{map[string]any{"text": system}},
+		}
+	}
+	if len(req.Tools) > 0 {
+		body["tools"] = []any{map[string]any{
+			"functionDeclarations": p.convertTools(req.Tools),
+		}}
+		body["toolConfig"] = map[string]any{
+			"functionCallingConfig": map[string]any{"mode": "AUTO"},
+		}
+	}
+	return body
+}
+
+// do posts a request body to the given model method, e.g.
+// "gemini-2.5-flash:generateContent".
+func (p *GeminiProvider) do(ctx context.Context, method string, body map[string]any) (*http.Response, error) {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	url := p.apiBase + "/models/" + method
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-goog-api-key", p.apiKey)
+	for k, v := range p.extraHeaders {
+		httpReq.Header.Set(k, v)
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("http request: %w", err)
+	}
+	return resp, nil
+}
+
+// convertMessages extracts the system prompt and converts OpenAI message format
+// to Gemini contents. Assistant messages become "model" turns, tool calls become
+// functionCall parts and tool results become functionResponse parts. Both carry
+// the tool call ID, so responses to calls of the same function stay apart, and
+// a call made while thinking carries its thought signature back.
+func (p *GeminiProvider) convertMessages(msgs []map[string]any) (string, []map[string]any) {
+	var system string
+	var result []map[string]any
+
+	for _, msg := range msgs {
+		role, _ := msg["role"].(string)
+
+		switch role {
+		case "system":
+			content, _ := msg["content"].(string)
+			if system != "" {
+				system += "\n\n"
+			}
+			system += content
+
+		case "assistant":
+			var parts []any
+			if content, _ := msg["content"].(string); content != "" {
+				parts = append(parts, map[string]any{"text": content})
+			}
+			for _, tc := range toolCallList(msg["tool_calls"]) {
+				fn, _ := tc["function"].(map[string]any)
+				name, _ := fn["name"].(string)
+				argsStr, _ := fn["arguments"].(string)
+
+				var args map[string]any
+				if err := json.Unmarshal([]byte(argsStr), &args); err != nil {
+					args = map[string]any{"raw": argsStr}
+				}
+				call := map[string]any{"name": name, "args": args}
+				if id, _ := tc["id"].(string); id != "" {
+					call["id"] = id
+				}
+				part := map[string]any{"functionCall": call}
+				if sig, _ := tc["thought_signature"].(string); sig != "" {
+					part["thoughtSignature"] = sig
+				}
+				parts = append(parts, part)
+			}
+			if len(parts) == 0 {
+				parts = append(parts, map[string]any{"text": ""})
+			}
+			result = append(result, map[string]any{"role": "model", "parts": parts})
+
+		case "tool":
+			name, _ := msg["name"].(string)
+			content, _ := msg["content"].(string)
+			response := map[string]any{
+				"name":     name,
+				"response": map[string]any{"content": content},
+			}
+			if id, _ := msg["tool_call_id"].(string); id != "" {
+				response["id"] = id
+			}
+			result = append(result, map[string]any{
+				"role":  "user",
+				"parts": []any{map[string]any{"functionResponse": response}},
+			})
+
+		case "user":
+			result = append(result, map[string]any{
+				"role":  "user",
+				"parts": userParts(msg["content"]),
+			})
+		}
+	}
+
+	return system, mergeConsecutiveParts(result)
+}
+
+// userParts converts user message content to Gemini parts. Inline images
+// and files become inlineData parts; remote URLs, which Gemini cannot fetch,
+// are passed as text references.
+func userParts(content any) []any {
+	parts := contentParts(content)
+	if parts == nil {
+		text, _ := content.(string)
+		return []any{map[string]any{"text": text}}
+	}
+	var result []any
+	for _, part := range parts {
+		switch part["type"] {
+		case "image_url", "file":
+			mimeType, data, url := mediaSource(part)
+			if url != "" {
+				result = append(result, map[string]any{"text": "[attachment: " + url + "]"})
+				continue
+			}
+			result = append(result, map[string]any{
+				"inlineData": map[string]any{"mimeType": mimeType, "data": data},
+			})
+		case "text":
+			result = append(result, map[string]any{"text": part["text"]})
+		}
+	}
+	if len(result) == 0 {
+		result = append(result, map[string]any{"text": ""})
+	}
+	return result
+}
+
+// convertTools converts OpenAI tool definitions to Gemini function declarations.
+func (p *GeminiProvider) convertTools(tools []map[string]any) []map[string]any {
+	var result []map[string]any
+	for _, t := range tools {
+		fn, _ := t["function"].(map[string]any)
+		if fn == nil {
+			continue
+		}
+		decl := map[string]any{
+			"name":        fn["name"],
+			"description": fn["description"],
+		}
+		if params, ok := fn["parameters"].(map[string]any); ok && len(params) > 0 {
+			decl["parameters"] = cleanGeminiSchema(params)
+		}
+		result = append(result, decl)
+	}
+	return result
+}
+
+// cleanGeminiSchema drops JSON Schema keywords that Gemini's OpenAPI subset
+// rejects, recursing into nested schemas.
+func cleanGeminiSchema(schema map[string]any) map[string]any {
+	unsupported := map[string]bool{
+		"$schema": true, "$id": true, "$ref": true, "$defs": true, "definitions": true,
+		"additionalProperties": true, "default": true, "examples": true,
+	}
+	out := make(map[string]any, len(schema))
+	for k, v := range schema {
+		if unsupported[k] {
+			continue
+		}
+		switch val := v.(type) {
+		case map[string]any:
+			if k == "properties" {
+				props := make(map[string]any, len(val))
+				for name, sub := range val {
+					if subMap, ok := sub.(map[string]any); ok {
+						props[name] = cleanGeminiSchema(subMap)
+					} else {
+						props[name] = sub
+					}
+				}
+				out[k] = props
+			} else {
+				out[k] = cleanGeminiSchema(val)
+			}
+		default:
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// mergeConsecutiveParts merges consecutive same-role contents so that
+// parallel tool results land in a single user turn.
+func mergeConsecutiveParts(contents []map[string]any) []map[string]any {
+	var result []map[string]any
+	for _, c := range contents {
+		if len(result) > 0 {
+			prev := result[len(result)-1]
+			if prev["role"] == c["role"] {
+				prevParts, _ := prev["parts"].([]any)
+				currParts, _ := c["parts"].([]any)
+				prev["parts"] = append(prevParts, currParts...)
+				continue
+			}
+		}
+		result = append(result, c)
+	}
+	return result
+}
+
+// toolCallList normalizes an assistant message's tool_calls, which may be
+// []map[string]any (built in-process) or []any (decoded from JSON).
+func toolCallList(v any) []map[string]any {
+	switch calls := v.(type) {
+	case []map[string]any:
+		return calls
+	case []any:
+		out := make([]map[string]any, 0, len(calls))
+		for _, c := range calls {
+			if tc, ok := c.(map[string]any); ok {
+				out = append(out, tc)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// geminiResponse is a GenerateContentResponse (or one streamed chunk of it).
+type geminiResponse struct {
+	Candidates []struct {
+		Content struct {
+			Parts []struct {
+				Text             string `json:"text"`
+				Thought          bool   `json:"thought"`
+				ThoughtSignature string `json:"thoughtSignature"`
+				FunctionCall     *struct {
+					ID   string         `json:"id"`
+					Name string         `json:"name"`
+					Args map[string]any `json:"args"`
+				} `json:"functionCall"`
+			} `json:"parts"`
+		} `json:"content"`
+		FinishReason string `json:"finishReason"`
+	} `json:"candidates"`
+	PromptFeedback struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		TotalTokenCount      int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+// geminiAccumulator merges one or more GenerateContentResponse chunks into a
+// ChatResponse, emitting stream events along the way.
+type geminiAccumulator struct {
+	onEvent   StreamHandler
+	text      strings.Builder
+	reasoning strings.Builder
+	calls     []ToolCallRequest
+	finish    string
+	usage     map[string]int
+}
+
+func newGeminiAccumulator(onEvent StreamHandler) *geminiAccumulator {
+	return &geminiAccumulator{onEvent: onEvent, usage: map[string]int{}}
+}
+
+func (a *geminiAccumulator) add(r *geminiResponse) {
+	if r.UsageMetadata.TotalTokenCount > 0 {
+		a.usage["prompt_tokens"] = r.UsageMetadata.PromptTokenCount
+		a.usage["completion_tokens"] = r.UsageMetadata.CandidatesTokenCount
+		a.usage["total_tokens"] = r.UsageMetadata.TotalTokenCount
+	}
+	if r.PromptFeedback.BlockReason != "" {
+		a.finish = "SAFETY"
+	}
+	if len(r.Candidates) == 0 {
+		return
+	}
+	cand := r.Candidates[0]
+	if cand.FinishReason != "" {
+		a.finish = cand.FinishReason
+	}
+	for _, part := range cand.Content.Parts {
+		switch {
+		case part.FunctionCall != nil:
+			id := part.FunctionCall.ID
+			if id == "" {
+				id = fmt.Sprintf("call_%d", len(a.calls)+1)
+			}
+			args := part.FunctionCall.Args
+			if args == nil {
+				args = map[string]any{}
+			}
+			tc := ToolCallRequest{ID: id, Name: part.FunctionCall.Name, Arguments: args, Signature: part.ThoughtSignature}
+			a.calls = append(a.calls, tc)
+			emit(a.onEvent, StreamEvent{Type: StreamToolCall, ToolCall: &tc})
+		case part.Thought:
+			a.reasoning.WriteString(part.Text)
+			emit(a.onEvent, StreamEvent{Type: StreamReasoning, Delta: part.Text})
+		case part.Text != "":
+			a.text.WriteString(part.Text)
+			emit(a.onEvent, StreamEvent{Type: StreamText, Delta: part.Text})
+		}
+	}
+}
+
+func (a *geminiAccumulator) result() (*ChatResponse, error) {
+	result := &ChatResponse{
+		Content:          a.text.String(),
+		ReasoningContent: a.reasoning.String(),
+		ToolCalls:        a.calls,
+		Usage:            a.usage,
+	}
+	// Map Gemini finishReason to OpenAI finish_reason. Gemini reports STOP
+	// even when the turn ends in function calls.
+	switch {
+	case len(a.calls) > 0:
+		result.FinishReason = "tool_calls"
+	case a.finish == "STOP":
+		result.FinishReason = "stop"
+	case a.finish == "MAX_TOKENS":
+		result.FinishReason = "length"
+	case a.finish == "SAFETY", a.finish == "RECITATION", a.finish == "PROHIBITED_CONTENT":
+		result.FinishReason = "content_filter"
+	default:
+		result.FinishReason = strings.ToLower(a.finish)
+	}
+	if err := checkFiltered("gemini", result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
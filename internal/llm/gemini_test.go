@@ -0,0 +1,199 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGeminiChat(t *testing.T) {
+	var gotPath, gotKey string
+	var gotBody map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotKey = r.Header.Get("x-goog-api-key")
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &gotBody)
+		w.Write([]byte(`{
+			"candidates": [{
+				"content": {"role": "model", "parts": [
+					{"text": "Checking."},
+					{"functionCall": {"name": "exec", "args": {"command": "ls"}}}
+				]},
+				"finishReason": "STOP"
+			}],
+			"usageMetadata": {"promptTokenCount": 30, "candidatesTokenCount": 8, "totalTokenCount": 38}
+		}`))
+	}))
+	defer srv.Close()
+
+	p := NewGeminiProvider("gkey", srv.URL, "gemini-2.5-flash", nil)
+	resp, err := p.Chat(context.Background(), ChatRequest{
+		Model: "google/gemini-2.5-pro",
+		Messages: []map[string]any{
+			{"role": "system", "content": "be brief"},
+			{"role": "user", "content": "list files"},
+			{"role": "assistant", "content": "", "tool_calls": []map[string]any{{
+				"id": "call_1", "type": "function",
+				"function": map[string]any{"name": "exec", "arguments": `{"command":"pwd"}`},
+			}}},
+			{"role": "tool", "tool_call_id": "call_1", "name": "exec", "content": "/tmp"},
+		},
+		Tools: []map[string]any{{
+			"type": "function",
+			"function": map[string]any{
+				"name":        "exec",
+				"description": "run a command",
+				"parameters": map[string]any{
+					"type":                 "object",
+					"additionalProperties": false,
+					"properties": map[string]any{
+						"command": map[string]any{"type": "string", "default": "ls"},
+					},
+				},
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gotPath != "/models/gemini-2.5-pro:generateContent" {
+		t.Errorf("path = %q", gotPath)
+	}
+	if gotKey != "gkey" {
+		t.Errorf("api key header = %q", gotKey)
+	}
+
+	sys, _ := json.Marshal(gotBody["systemInstruction"])
+	if !strings.Contains(string(sys), "be brief") {
+		t.Errorf("systemInstruction = %s", sys)
+	}
+	contents, _ := gotBody["contents"].([]any)
+	if len(contents) != 3 {
+		t.Fatalf("contents = %v", gotBody["contents"])
+	}
+	model, _ := json.Marshal(contents[1])
+	if !strings.Contains(string(model), `"role":"model"`) || !strings.Contains(string(model), `"functionCall":{"args":{"command":"pwd"},"id":"call_1","name":"exec"}`) {
+		t.Errorf("model turn = %s", model)
+	}
+	toolTurn, _ := json.Marshal(contents[2])
+	if !strings.Contains(string(toolTurn), `"functionResponse":{"id":"call_1","name":"exec","response":{"content":"/tmp"}}`) {
+		t.Errorf("tool turn = %s", toolTurn)
+	}
+	tools, _ := json.Marshal(gotBody["tools"])
+	if strings.Contains(string(tools), "additionalProperties") || strings.Contains(string(tools), "default") {
+		t.Errorf("unsupported schema keys not stripped: %s", tools)
+	}
+
+	if resp.Content != "Checking." {
+		t.Errorf("content = %q", resp.Content)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Name != "exec" || resp.ToolCalls[0].Arguments["command"] != "ls" {
+		t.Fatalf("tool calls = %+v", resp.ToolCalls)
+	}
+	if resp.ToolCalls[0].ID == "" {
+		t.Error("tool call ID not synthesized")
+	}
+	if resp.FinishReason != "tool_calls" || resp.Usage["total_tokens"] != 38 {
+		t.Errorf("finish = %q, usage = %v", resp.FinishReason, resp.Usage)
+	}
+}
+
+func TestGeminiChatStream(t *testing.T) {
+	srv := sseServer(t, []string{
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"Hel"}]}}]}`,
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"lo"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":5,"candidatesTokenCount":2,"totalTokenCount":7}}`,
+	})
+
+	p := NewGeminiProvider("gkey", srv.URL, "gemini-2.5-flash", nil)
+	var text strings.Builder
+	resp, err := p.ChatStream(context.Background(), ChatRequest{
+		Messages: []map[string]any{{"role": "user", "content": "hi"}},
+	}, func(ev StreamEvent) {
+		if ev.Type == StreamText {
+			text.WriteString(ev.Delta)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "Hello" || text.String() != "Hello" {
+		t.Errorf("content = %q, streamed = %q", resp.Content, text.String())
+	}
+	if resp.FinishReason != "stop" || resp.Usage["total_tokens"] != 7 {
+		t.Errorf("finish = %q, usage = %v", resp.FinishReason, resp.Usage)
+	}
+}
+
+func TestGeminiSameNameToolCalls(t *testing.T) {
+	p := NewGeminiProvider("gkey", "", "gemini-2.5-flash", nil)
+	_, contents := p.convertMessages([]map[string]any{
+		{"role": "user", "content": "read both"},
+		{"role": "assistant", "content": "", "tool_calls": []map[string]any{
+			{"id": "call_a", "type": "function", "function": map[string]any{"name": "read_file", "arguments": `{"path":"a.txt"}`}},
+			{"id": "call_b", "type": "function", "function": map[string]any{"name": "read_file", "arguments": `{"path":"b.txt"}`}},
+		}},
+		{"role": "tool", "tool_call_id": "call_a", "name": "read_file", "content": "alpha"},
+		{"role": "tool", "tool_call_id": "call_b", "name": "read_file", "content": "beta"},
+	})
+	if len(contents) != 3 {
+		t.Fatalf("contents = %v", contents)
+	}
+	calls := contents[1]["parts"].([]any)
+	responses := contents[2]["parts"].([]any)
+	if len(calls) != 2 || len(responses) != 2 {
+		t.Fatalf("calls = %v, responses = %v", calls, responses)
+	}
+	for i, want := range []struct{ id, content string }{{"call_a", "alpha"}, {"call_b", "beta"}} {
+		call := calls[i].(map[string]any)["functionCall"].(map[string]any)
+		resp := responses[i].(map[string]any)["functionResponse"].(map[string]any)
+		if call["id"] != want.id || resp["id"] != want.id || resp["response"].(map[string]any)["content"] != want.content {
+			t.Errorf("pair %d: call %v, response %v", i, call, resp)
+		}
+	}
+}
+
+func TestGeminiThoughtSignature(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"candidates": [{"content": {"role": "model", "parts": [
+			{"functionCall": {"id": "call_1", "name": "exec", "args": {"command": "ls"}}, "thoughtSignature": "c2lnbmVk"}
+		]}, "finishReason": "STOP"}]}`))
+	}))
+	defer srv.Close()
+
+	p := NewGeminiProvider("gkey", srv.URL, "gemini-2.5-flash", nil)
+	resp, err := p.Chat(context.Background(), ChatRequest{Messages: []map[string]any{{"role": "user", "content": "list files"}}, ThinkingBudget: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].Signature != "c2lnbmVk" {
+		t.Fatalf("tool calls = %+v", resp.ToolCalls)
+	}
+
+	// The signature goes back with the call, and not to other providers.
+	messages := []map[string]any{
+		{"role": "user", "content": "list files"},
+		{"role": "assistant", "content": "", "tool_calls": []map[string]any{{
+			"id": "call_1", "type": "function", "thought_signature": "c2lnbmVk",
+			"function": map[string]any{"name": "exec", "arguments": `{"command":"ls"}`},
+		}}},
+		{"role": "tool", "tool_call_id": "call_1", "name": "exec", "content": "a.txt"},
+	}
+	_, contents := p.convertMessages(messages)
+	part := contents[1]["parts"].([]any)[0].(map[string]any)
+	if part["thoughtSignature"] != "c2lnbmVk" || part["functionCall"] == nil {
+		t.Errorf("call part = %v", part)
+	}
+	stripped := stripProviderFields(messages)
+	if call := stripped[1]["tool_calls"].([]map[string]any)[0]; call["thought_signature"] != nil || call["id"] != "call_1" {
+		t.Errorf("chat/completions call = %v", call)
+	}
+	if messages[1]["tool_calls"].([]map[string]any)[0]["thought_signature"] == nil {
+		t.Error("stripping changed the original message")
+	}
+}
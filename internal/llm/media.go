@@ -0,0 +1,143 @@
+package llm
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+// Multimodal user content uses the OpenAI chat format: a message's "content"
+// is either a string or a list of parts built with TextPart, ImagePart and
+// FilePart. Providers with a different wire format convert the parts.
+
+// TextPart returns a text content part.
+func TextPart(text string) map[string]any {
+	return map[string]any{"type": "text", "text": text}
+}
+
+// ImagePart returns an image content part carrying data inline as a data URL.
+func ImagePart(mimeType string, data []byte) map[string]any {
+	return map[string]any{
+		"type":      "image_url",
+		"image_url": map[string]any{"url": dataURL(mimeType, data)},
+	}
+}
+
+// FilePart returns a document content part (e.g. a PDF) carrying data inline.
+func FilePart(filename, mimeType string, data []byte) map[string]any {
+	return map[string]any{
+		"type": "file",
+		"file": map[string]any{"filename": filename, "file_data": dataURL(mimeType, data)},
+	}
+}
+
+// ContentText returns the text of a message content, joining text parts.
+func ContentText(content any) string {
+	if s, ok := content.(string); ok {
+		return s
+	}
+	var texts []string
+	for _, part := range contentParts(content) {
+		if part["type"] == "text" {
+			if t, _ := part["text"].(string); t != "" {
+				texts = append(texts, t)
+			}
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// StripMedia returns a copy of messages with image and file parts replaced
+// by a short text placeholder, for models without vision support, along
+// with the number of parts replaced. Messages without media are shared.
+func StripMedia(messages []map[string]any) ([]map[string]any, int) {
+	out := make([]map[string]any, len(messages))
+	stripped := 0
+	for i, msg := range messages {
+		out[i] = msg
+		parts := contentParts(msg["content"])
+		if !hasMediaPart(parts) {
+			continue
+		}
+		newParts := make([]any, 0, len(parts))
+		for _, part := range parts {
+			switch part["type"] {
+			case "image_url":
+				newParts = append(newParts, TextPart("[image omitted]"))
+				stripped++
+			case "file":
+				newParts = append(newParts, TextPart("[file omitted]"))
+				stripped++
+			default:
+				newParts = append(newParts, part)
+			}
+		}
+		copied := make(map[string]any, len(msg))
+		for k, v := range msg {
+			copied[k] = v
+		}
+		copied["content"] = newParts
+		out[i] = copied
+	}
+	return out, stripped
+}
+
+// HasMedia reports whether any message carries image or file parts.
+func HasMedia(messages []map[string]any) bool {
+	for _, msg := range messages {
+		if hasMediaPart(contentParts(msg["content"])) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasMediaPart(parts []map[string]any) bool {
+	for _, part := range parts {
+		if part["type"] == "image_url" || part["type"] == "file" {
+			return true
+		}
+	}
+	return false
+}
+
+// contentParts returns the parts of a list content, or nil for string content.
+func contentParts(content any) []map[string]any {
+	switch v := content.(type) {
+	case []map[string]any:
+		return v
+	case []any:
+		parts := make([]map[string]any, 0, len(v))
+		for _, p := range v {
+			if m, ok := p.(map[string]any); ok {
+				parts = append(parts, m)
+			}
+		}
+		return parts
+	}
+	return nil
+}
+
+// mediaSource extracts the URL or inline data of an image or file part.
+// For data URLs it returns the MIME type and base64 payload; otherwise url
+// is the remote location.
+func mediaSource(part map[string]any) (mimeType, data, url string) {
+	var raw string
+	switch part["type"] {
+	case "image_url":
+		img, _ := part["image_url"].(map[string]any)
+		raw, _ = img["url"].(string)
+	case "file":
+		f, _ := part["file"].(map[string]any)
+		raw, _ = f["file_data"].(string)
+	}
+	if rest, ok := strings.CutPrefix(raw, "data:"); ok {
+		if meta, payload, ok := strings.Cut(rest, ","); ok {
+			return strings.TrimSuffix(meta, ";base64"), payload, ""
+		}
+	}
+	return "", "", raw
+}
+
+func dataURL(mimeType string, data []byte) string {
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
@@ -0,0 +1,57 @@
+package llm
+
+import (
+	"testing"
+)
+
+func TestMediaConversion(t *testing.T) {
+	content := []any{
+		TextPart("what is this?"),
+		ImagePart("image/png", []byte("png")),
+		FilePart("a.pdf", "application/pdf", []byte("pdf")),
+	}
+
+	p := &AnthropicProvider{}
+	blocks, _ := p.convertUserContent(content).([]any)
+	if len(blocks) != 3 {
+		t.Fatalf("anthropic blocks = %v", blocks)
+	}
+	img := blocks[1].(map[string]any)
+	src, _ := img["source"].(map[string]any)
+	if img["type"] != "image" || src["media_type"] != "image/png" || src["data"] != "cG5n" {
+		t.Errorf("anthropic image block = %v", img)
+	}
+	if doc := blocks[2].(map[string]any); doc["type"] != "document" {
+		t.Errorf("anthropic file block = %v", doc)
+	}
+
+	parts := userParts(content)
+	if len(parts) != 3 {
+		t.Fatalf("gemini parts = %v", parts)
+	}
+	inline, _ := parts[2].(map[string]any)["inlineData"].(map[string]any)
+	if inline["mimeType"] != "application/pdf" || inline["data"] != "cGRm" {
+		t.Errorf("gemini file part = %v", parts[2])
+	}
+}
+
+func TestStripMedia(t *testing.T) {
+	messages := []map[string]any{
+		{"role": "system", "content": "sys"},
+		{"role": "user", "content": []any{TextPart("look"), ImagePart("image/jpeg", []byte("x"))}},
+	}
+	if !HasMedia(messages) {
+		t.Fatal("HasMedia = false, want true")
+	}
+
+	stripped, n := StripMedia(messages)
+	if n != 1 || HasMedia(stripped) {
+		t.Errorf("StripMedia replaced %d parts, HasMedia = %v", n, HasMedia(stripped))
+	}
+	if got := ContentText(stripped[1]["content"]); got != "look\n[image omitted]" {
+		t.Errorf("ContentText = %q", got)
+	}
+	if !HasMedia(messages) {
+		t.Error("original messages were modified")
+	}
+}
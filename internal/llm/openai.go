@@ -7,11 +7,14 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
+	"sort"
 )
 
 // OpenAIProvider implements the Provider interface using the OpenAI-compatible API.
 // Works with OpenRouter, Anthropic (via proxy), DeepSeek, vLLM, etc.
 type OpenAIProvider struct {
+	name         string // configured provider name, reported in errors
 	apiKey       string
 	apiBase      string
 	defaultModel string
@@ -19,8 +22,13 @@ type OpenAIProvider struct {
 	client       *http.Client
 }
 
-// NewOpenAIProvider creates a new OpenAI-compatible provider.
-func NewOpenAIProvider(apiKey, apiBase, defaultModel string, extraHeaders map[string]string) *OpenAIProvider {
+// NewOpenAIProvider creates a new OpenAI-compatible provider. name is the
+// configured provider (e.g. "openrouter" or "deepseek") that errors are
+// attributed to; empty is "openai".
+func NewOpenAIProvider(name, apiKey, apiBase, defaultModel string, extraHeaders map[string]string) *OpenAIProvider {
+	if name == "" {
+		name = "openai"
+	}
 	if apiBase == "" {
 		apiBase = "https://openrouter.ai/api/v1"
 	}
@@ -28,6 +36,7 @@ func NewOpenAIProvider(apiKey, apiBase, defaultModel string, extraHeaders map[st
 		defaultModel = "anthropic/claude-sonnet-4-5"
 	}
 	return &OpenAIProvider{
+		name:         name,
 		apiKey:       apiKey,
 		apiBase:      apiBase,
 		defaultModel: defaultModel,
@@ -41,6 +50,51 @@ func (p *OpenAIProvider) DefaultModel() string {
 }
 
 func (p *OpenAIProvider) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	resp, err := p.do(ctx, p.buildBody(req))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := parseOpenAIError(resp.StatusCode, resp.Header, respBody)
+		apiErr.Provider = p.name
+		return nil, apiErr
+	}
+
+	return p.parseResponse(respBody)
+}
+
+// ChatStream sends a streaming chat completion request and assembles the
+// SSE chunks into a ChatResponse, reporting deltas to onEvent as they arrive.
+func (p *OpenAIProvider) ChatStream(ctx context.Context, req ChatRequest, onEvent StreamHandler) (*ChatResponse, error) {
+	body := p.buildBody(req)
+	body["stream"] = true
+	body["stream_options"] = map[string]any{"include_usage": true}
+
+	resp, err := p.do(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		apiErr := parseOpenAIError(resp.StatusCode, resp.Header, respBody)
+		apiErr.Provider = p.name
+		return nil, apiErr
+	}
+
+	return p.parseStream(resp.Body, onEvent)
+}
+
+// buildBody converts a ChatRequest into the chat/completions request body.
+func (p *OpenAIProvider) buildBody(req ChatRequest) map[string]any {
 	model := req.Model
 	if model == "" {
 		model = p.defaultModel
@@ -49,23 +103,67 @@ func (p *OpenAIProvider) Chat(ctx context.Context, req ChatRequest) (*ChatRespon
 	if maxTokens == 0 {
 		maxTokens = 4096
 	}
-	temp := req.Temperature
-	if temp == 0 {
-		temp = 0.7
-	}
-
 	body := map[string]any{
-		"model":       model,
-		"messages":    req.Messages,
-		"max_tokens":  maxTokens,
-		"temperature": temp,
+		"model":      model,
+		"messages":   stripProviderFields(req.Messages),
+		"max_tokens": maxTokens,
+	}
+	if req.Temperature != nil {
+		body["temperature"] = *req.Temperature
+	}
+	if req.ReasoningEffort != "" {
+		body["reasoning_effort"] = req.ReasoningEffort
 	}
 
 	if len(req.Tools) > 0 {
 		body["tools"] = req.Tools
 		body["tool_choice"] = "auto"
 	}
+	return body
+}
 
+// stripProviderFields drops what other providers keep in assistant
+// messages and chat/completions APIs do not accept: Anthropic's
+// "thinking_blocks" and the "thought_signature" of Gemini tool calls.
+// Messages without them are shared.
+func stripProviderFields(messages []map[string]any) []map[string]any {
+	out := make([]map[string]any, len(messages))
+	for i, msg := range messages {
+		out[i] = msg
+		_, blocks := msg["thinking_blocks"]
+		calls := toolCallList(msg["tool_calls"])
+		signed := slices.ContainsFunc(calls, func(tc map[string]any) bool {
+			_, ok := tc["thought_signature"]
+			return ok
+		})
+		if !blocks && !signed {
+			continue
+		}
+		copied := make(map[string]any, len(msg))
+		for k, v := range msg {
+			if k != "thinking_blocks" {
+				copied[k] = v
+			}
+		}
+		if signed {
+			stripped := make([]map[string]any, len(calls))
+			for j, tc := range calls {
+				stripped[j] = make(map[string]any, len(tc))
+				for k, v := range tc {
+					if k != "thought_signature" {
+						stripped[j][k] = v
+					}
+				}
+			}
+			copied["tool_calls"] = stripped
+		}
+		out[i] = copied
+	}
+	return out
+}
+
+// do posts a request body to the chat/completions endpoint.
+func (p *OpenAIProvider) do(ctx context.Context, body map[string]any) (*http.Response, error) {
 	jsonBody, err := json.Marshal(body)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request: %w", err)
@@ -89,24 +187,10 @@ func (p *OpenAIProvider) Chat(ctx context.Context, req ChatRequest) (*ChatRespon
 	if err != nil {
 		return nil, fmt.Errorf("http request: %w", err)
 	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("read response: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return &ChatResponse{
-			Content:      fmt.Sprintf("Error calling LLM (HTTP %d): %s", resp.StatusCode, string(respBody)),
-			FinishReason: "error",
-		}, nil
-	}
-
-	return parseResponse(respBody)
+	return resp, nil
 }
 
-func parseResponse(data []byte) (*ChatResponse, error) {
+func (p *OpenAIProvider) parseResponse(data []byte) (*ChatResponse, error) {
 	var raw struct {
 		Choices []struct {
 			Message struct {
@@ -130,6 +214,7 @@ func parseResponse(data []byte) (*ChatResponse, error) {
 		} `json:"usage"`
 		Error *struct {
 			Message string `json:"message"`
+			Type    string `json:"type"`
 		} `json:"error"`
 	}
 
@@ -137,18 +222,13 @@ func parseResponse(data []byte) (*ChatResponse, error) {
 		return nil, fmt.Errorf("parse response: %w", err)
 	}
 
+	// Some OpenAI-compatible gateways report errors in a 200 response.
 	if raw.Error != nil {
-		return &ChatResponse{
-			Content:      "Error calling LLM: " + raw.Error.Message,
-			FinishReason: "error",
-		}, nil
+		return nil, newAPIError(p.name, 0, nil, raw.Error.Type, raw.Error.Message)
 	}
 
 	if len(raw.Choices) == 0 {
-		return &ChatResponse{
-			Content:      "Error: no choices in LLM response",
-			FinishReason: "error",
-		}, nil
+		return nil, &APIError{Kind: ErrServer, Provider: p.name, Message: "no choices in response"}
 	}
 
 	choice := raw.Choices[0]
@@ -175,5 +255,151 @@ func parseResponse(data []byte) (*ChatResponse, error) {
 		})
 	}
 
+	if err := checkFiltered(p.name, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// checkFiltered turns an empty response stopped by a content filter into
+// ErrContentFiltered. Partially generated answers are kept.
+func checkFiltered(provider string, resp *ChatResponse) error {
+	if resp.FinishReason != "content_filter" || resp.Content != "" || resp.HasToolCalls() {
+		return nil
+	}
+	return &APIError{Kind: ErrContentFiltered, Provider: provider, Message: "response blocked by content filter"}
+}
+
+// parseStream assembles an OpenAI-compatible SSE stream into a ChatResponse.
+// Tool call fragments are accumulated by index and emitted once the stream
+// finishes, since their arguments are only valid JSON when complete.
+func (p *OpenAIProvider) parseStream(r io.Reader, onEvent StreamHandler) (*ChatResponse, error) {
+	type partialCall struct {
+		id   string
+		name string
+		args []byte
+	}
+
+	result := &ChatResponse{Usage: map[string]int{}}
+	var content, reasoning []byte
+	calls := make(map[int]*partialCall)
+	var streamErr *APIError
+
+	err := readSSE(r, func(ev sseEvent) bool {
+		if ev.Data == "" {
+			return true
+		}
+		if ev.Data == "[DONE]" {
+			return false
+		}
+
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content          string `json:"content"`
+					ReasoningContent string `json:"reasoning_content"`
+					ToolCalls        []struct {
+						Index    int    `json:"index"`
+						ID       string `json:"id"`
+						Function struct {
+							Name      string `json:"name"`
+							Arguments string `json:"arguments"`
+						} `json:"function"`
+					} `json:"tool_calls"`
+				} `json:"delta"`
+				FinishReason string `json:"finish_reason"`
+			} `json:"choices"`
+			Usage *struct {
+				PromptTokens     int `json:"prompt_tokens"`
+				CompletionTokens int `json:"completion_tokens"`
+				TotalTokens      int `json:"total_tokens"`
+			} `json:"usage"`
+			Error *struct {
+				Message string `json:"message"`
+				Type    string `json:"type"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(ev.Data), &chunk); err != nil {
+			return true
+		}
+		if chunk.Error != nil {
+			streamErr = newAPIError(p.name, 0, nil, chunk.Error.Type, chunk.Error.Message)
+			return false
+		}
+		if chunk.Usage != nil {
+			result.Usage["prompt_tokens"] = chunk.Usage.PromptTokens
+			result.Usage["completion_tokens"] = chunk.Usage.CompletionTokens
+			result.Usage["total_tokens"] = chunk.Usage.TotalTokens
+		}
+		if len(chunk.Choices) == 0 {
+			return true
+		}
+
+		choice := chunk.Choices[0]
+		if choice.FinishReason != "" {
+			result.FinishReason = choice.FinishReason
+		}
+		if d := choice.Delta.Content; d != "" {
+			content = append(content, d...)
+			emit(onEvent, StreamEvent{Type: StreamText, Delta: d})
+		}
+		if d := choice.Delta.ReasoningContent; d != "" {
+			reasoning = append(reasoning, d...)
+			emit(onEvent, StreamEvent{Type: StreamReasoning, Delta: d})
+		}
+		for _, tc := range choice.Delta.ToolCalls {
+			pc, ok := calls[tc.Index]
+			if !ok {
+				pc = &partialCall{}
+				calls[tc.Index] = pc
+			}
+			if tc.ID != "" {
+				pc.id = tc.ID
+			}
+			if tc.Function.Name != "" {
+				pc.name += tc.Function.Name
+			}
+			pc.args = append(pc.args, tc.Function.Arguments...)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read stream: %w", err)
+	}
+	if streamErr != nil {
+		return nil, streamErr
+	}
+
+	result.Content = string(content)
+	result.ReasoningContent = string(reasoning)
+
+	indexes := make([]int, 0, len(calls))
+	for i := range calls {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	for _, i := range indexes {
+		pc := calls[i]
+		var args map[string]any
+		if len(pc.args) == 0 {
+			args = map[string]any{}
+		} else if err := json.Unmarshal(pc.args, &args); err != nil {
+			args = map[string]any{"raw": string(pc.args)}
+		}
+		tc := ToolCallRequest{ID: pc.id, Name: pc.name, Arguments: args}
+		result.ToolCalls = append(result.ToolCalls, tc)
+		emit(onEvent, StreamEvent{Type: StreamToolCall, ToolCall: &tc})
+	}
+
+	if err := checkFiltered(p.name, result); err != nil {
+		return nil, err
+	}
 	return result, nil
 }
+
+// emit calls onEvent if it is set.
+func emit(onEvent StreamHandler, ev StreamEvent) {
+	if onEvent != nil {
+		onEvent(ev)
+	}
+}
@@ -7,6 +7,10 @@ type ToolCallRequest struct {
 	ID        string
 	Name      string
 	Arguments map[string]any
+	// Signature is Gemini's thoughtSignature for the call, made while
+	// thinking. It must be sent back unchanged, as the tool call's
+	// "thought_signature", when the conversation continues.
+	Signature string
 }
 
 // ChatResponse is the response from an LLM chat completion.
@@ -16,6 +20,12 @@ type ChatResponse struct {
 	FinishReason     string
 	Usage            map[string]int
 	ReasoningContent string
+	// ThinkingBlocks holds provider-native reasoning blocks (Anthropic
+	// thinking blocks with their signatures). They must be sent back
+	// unchanged, as the assistant message's "thinking_blocks", when the
+	// conversation continues with tool results.
+	ThinkingBlocks []map[string]any
+	Model          string // model that served the request, when known
 }
 
 // HasToolCalls returns true if the response contains tool calls.
@@ -29,11 +39,64 @@ type ChatRequest struct {
 	Tools       []map[string]any
 	Model       string
 	MaxTokens   int
-	Temperature float64
+	Temperature *float64 // nil leaves the provider's default
+
+	// ThinkingBudget is the number of tokens the model may spend on
+	// reasoning before answering; 0 leaves reasoning off unless
+	// ReasoningEffort is set.
+	ThinkingBudget int
+	// ReasoningEffort is EffortLow, EffortMedium or EffortHigh. Providers
+	// that take a token budget instead map it to one.
+	ReasoningEffort string
+}
+
+// Reasoning effort levels.
+const (
+	EffortLow    = "low"
+	EffortMedium = "medium"
+	EffortHigh   = "high"
+)
+
+// effortBudgets maps effort levels to thinking budgets for providers that
+// only accept a token budget.
+var effortBudgets = map[string]int{
+	EffortLow:    2048,
+	EffortMedium: 8192,
+	EffortHigh:   24576,
+}
+
+// thinkingBudget returns the reasoning token budget for a request, or 0 if
+// reasoning is not requested.
+func (r ChatRequest) thinkingBudget() int {
+	if r.ThinkingBudget > 0 {
+		return r.ThinkingBudget
+	}
+	return effortBudgets[r.ReasoningEffort]
 }
 
+// Stream event types.
+const (
+	StreamText      = "text"      // Delta holds a chunk of answer text
+	StreamReasoning = "reasoning" // Delta holds a chunk of reasoning text
+	StreamToolCall  = "tool_call" // ToolCall holds a fully assembled tool call
+)
+
+// StreamEvent is an incremental update emitted while a response is streamed.
+type StreamEvent struct {
+	Type     string
+	Delta    string
+	ToolCall *ToolCallRequest
+}
+
+// StreamHandler receives stream events in the order they are produced.
+type StreamHandler func(ev StreamEvent)
+
 // Provider is the interface for LLM providers.
 type Provider interface {
 	Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error)
+	// ChatStream is like Chat but streams the response, calling onEvent for
+	// each text delta, reasoning delta and completed tool call. The returned
+	// response is the fully assembled result, identical in shape to Chat's.
+	ChatStream(ctx context.Context, req ChatRequest, onEvent StreamHandler) (*ChatResponse, error)
 	DefaultModel() string
 }
@@ -0,0 +1,37 @@
+package llm
+
+import "testing"
+
+func TestRequestTemperature(t *testing.T) {
+	zero, warm := 0.0, 0.4
+	messages := []map[string]any{{"role": "user", "content": "hi"}}
+	anthropic := NewAnthropicProvider("key", "", "claude-test", nil)
+	gemini := NewGeminiProvider("key", "", "gemini-test", nil)
+	openai := NewOpenAIProvider("openai", "key", "", "gpt-test", nil)
+
+	tests := []struct {
+		name string
+		body func(ChatRequest) map[string]any // the map holding "temperature"
+		req  ChatRequest
+		want any // nil: not sent
+	}{
+		{"anthropic", anthropic.buildBody, ChatRequest{Messages: messages, Temperature: &warm}, 0.4},
+		{"anthropic zero", anthropic.buildBody, ChatRequest{Messages: messages, Temperature: &zero}, 0.0},
+		{"anthropic unset", anthropic.buildBody, ChatRequest{Messages: messages}, nil},
+		{"anthropic thinking", anthropic.buildBody, ChatRequest{Messages: messages, Temperature: &warm, ThinkingBudget: 1024}, nil},
+		{"gemini zero", func(req ChatRequest) map[string]any {
+			return gemini.buildBody(req)["generationConfig"].(map[string]any)
+		}, ChatRequest{Messages: messages, Temperature: &zero}, 0.0},
+		{"gemini unset", func(req ChatRequest) map[string]any {
+			return gemini.buildBody(req)["generationConfig"].(map[string]any)
+		}, ChatRequest{Messages: messages}, nil},
+		{"openai zero", openai.buildBody, ChatRequest{Messages: messages, Temperature: &zero}, 0.0},
+		{"openai unset", openai.buildBody, ChatRequest{Messages: messages}, nil},
+	}
+	for _, tt := range tests {
+		got, ok := tt.body(tt.req)["temperature"]
+		if tt.want == nil && ok || tt.want != nil && got != tt.want {
+			t.Errorf("%s: temperature = %v (sent %v), want %v", tt.name, got, ok, tt.want)
+		}
+	}
+}
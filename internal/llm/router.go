@@ -0,0 +1,248 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RouterTarget is one provider in a failover chain.
+type RouterTarget struct {
+	Name     string // display name, e.g. "anthropic"
+	Provider Provider
+	Model    string // model to request; empty means the caller's model (primary) or the provider default
+}
+
+// RouterOptions tunes the router's circuit breaker.
+type RouterOptions struct {
+	FailureThreshold int           // consecutive failures before a target is skipped (default 3)
+	Cooldown         time.Duration // how long a tripped target is skipped (default 60s)
+}
+
+// Router is a Provider that sends each call to the first healthy target and
+// fails over down the chain on rate limits, overloads, auth failures and
+// transport errors. Other failures (bad requests, context overflow) are
+// returned as-is since another provider would fail the same way.
+//
+// Each target has a simple circuit breaker: after FailureThreshold
+// consecutive failures it is skipped for Cooldown. Rate limits and auth
+// failures trip the breaker immediately.
+type Router struct {
+	targets   []RouterTarget
+	threshold int
+	cooldown  time.Duration
+
+	mu     sync.Mutex
+	health []targetHealth
+}
+
+type targetHealth struct {
+	failures  int
+	openUntil time.Time
+}
+
+// NewRouter creates a failover router over targets, in order of preference.
+func NewRouter(targets []RouterTarget, opts RouterOptions) *Router {
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = 3
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = 60 * time.Second
+	}
+	return &Router{
+		targets:   targets,
+		threshold: opts.FailureThreshold,
+		cooldown:  opts.Cooldown,
+		health:    make([]targetHealth, len(targets)),
+	}
+}
+
+// DefaultModel returns the primary target's model.
+func (r *Router) DefaultModel() string {
+	if len(r.targets) == 0 {
+		return ""
+	}
+	if r.targets[0].Model != "" {
+		return r.targets[0].Model
+	}
+	return r.targets[0].Provider.DefaultModel()
+}
+
+func (r *Router) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	return r.route(ctx, req, func(p Provider, req ChatRequest) (*ChatResponse, error) {
+		return p.Chat(ctx, req)
+	}, nil)
+}
+
+// ChatStream streams from the first healthy target. Once a target has
+// emitted any event the router no longer fails over, since the caller has
+// already rendered part of that answer.
+func (r *Router) ChatStream(ctx context.Context, req ChatRequest, onEvent StreamHandler) (*ChatResponse, error) {
+	var emitted bool
+	tracked := func(ev StreamEvent) {
+		emitted = true
+		emit(onEvent, ev)
+	}
+	return r.route(ctx, req, func(p Provider, req ChatRequest) (*ChatResponse, error) {
+		return p.ChatStream(ctx, req, tracked)
+	}, func() bool { return emitted })
+}
+
+func (r *Router) route(
+	ctx context.Context,
+	req ChatRequest,
+	call func(p Provider, req ChatRequest) (*ChatResponse, error),
+	committed func() bool,
+) (*ChatResponse, error) {
+	if len(r.targets) == 0 {
+		return nil, errors.New("router: no providers configured")
+	}
+
+	var lastErr error
+	for _, i := range r.order() {
+		t := r.targets[i]
+		treq := req
+		// The primary honors the caller's model; fallbacks use their own.
+		if i > 0 || (t.Model != "" && req.Model == "") {
+			treq.Model = t.Model
+		}
+
+		resp, err := call(t.Provider, treq)
+		if err == nil {
+			r.recordSuccess(i)
+			if resp.Model == "" {
+				resp.Model = treq.Model
+				if resp.Model == "" {
+					resp.Model = t.Provider.DefaultModel()
+				}
+			}
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		lastErr = err
+		class := classifyFailure(err)
+		if !class.failover() {
+			return nil, err
+		}
+		r.recordFailure(i, class, err)
+		slog.Warn("LLM provider failed, trying next", "provider", t.Name, "class", class.String(), "err", err)
+		if committed != nil && committed() {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// order returns target indexes to try: healthy targets in preference order,
+// then tripped targets by soonest recovery so that a call is always attempted.
+func (r *Router) order() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var healthy, tripped []int
+	for i, h := range r.health {
+		if now.Before(h.openUntil) {
+			tripped = append(tripped, i)
+		} else {
+			healthy = append(healthy, i)
+		}
+	}
+	sort.Slice(tripped, func(a, b int) bool {
+		return r.health[tripped[a]].openUntil.Before(r.health[tripped[b]].openUntil)
+	})
+	return append(healthy, tripped...)
+}
+
+func (r *Router) recordSuccess(i int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.health[i] = targetHealth{}
+}
+
+func (r *Router) recordFailure(i int, class failureClass, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h := &r.health[i]
+	h.failures++
+	switch class {
+	case failRateLimit:
+		wait := RetryAfter(err)
+		if wait <= 0 {
+			wait = r.cooldown
+		}
+		h.openUntil = time.Now().Add(wait)
+	case failAuth:
+		// Credentials rarely fix themselves; keep the target out much longer.
+		h.openUntil = time.Now().Add(10 * r.cooldown)
+	default:
+		if h.failures >= r.threshold {
+			h.openUntil = time.Now().Add(r.cooldown)
+		}
+	}
+	if !h.openUntil.IsZero() && time.Now().Before(h.openUntil) {
+		slog.Warn("LLM provider circuit open", "provider", r.targets[i].Name, "until", h.openUntil.Format(time.TimeOnly))
+	}
+}
+
+// failureClass categorizes a failed call for routing decisions.
+type failureClass int
+
+const (
+	failNone failureClass = iota
+	failRateLimit
+	failOverloaded
+	failAuth
+	failTransport
+	failOther
+)
+
+func (c failureClass) String() string {
+	switch c {
+	case failNone:
+		return "none"
+	case failRateLimit:
+		return "rate_limit"
+	case failOverloaded:
+		return "overloaded"
+	case failAuth:
+		return "auth"
+	case failTransport:
+		return "transport"
+	}
+	return "other"
+}
+
+// failover reports whether another provider might succeed where this one failed.
+func (c failureClass) failover() bool {
+	return c == failRateLimit || c == failOverloaded || c == failAuth || c == failTransport
+}
+
+// classifyFailure maps a provider error to a routing class. Errors that
+// are not *APIError are transport failures.
+func classifyFailure(err error) failureClass {
+	switch {
+	case err == nil:
+		return failNone
+	case errors.Is(err, context.Canceled):
+		return failOther
+	case errors.Is(err, ErrRateLimited):
+		return failRateLimit
+	case errors.Is(err, ErrOverloaded), errors.Is(err, ErrServer):
+		return failOverloaded
+	case errors.Is(err, ErrAuth):
+		return failAuth
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return failOther
+	}
+	return failTransport
+}
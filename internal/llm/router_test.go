@@ -0,0 +1,134 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeProvider returns canned results and records the models it was asked for.
+type fakeProvider struct {
+	results []func() (*ChatResponse, error)
+	models  []string
+}
+
+func (f *fakeProvider) DefaultModel() string { return "fake" }
+
+func (f *fakeProvider) Chat(_ context.Context, req ChatRequest) (*ChatResponse, error) {
+	f.models = append(f.models, req.Model)
+	next := f.results[0]
+	if len(f.results) > 1 {
+		f.results = f.results[1:]
+	}
+	return next()
+}
+
+func (f *fakeProvider) ChatStream(ctx context.Context, req ChatRequest, onEvent StreamHandler) (*ChatResponse, error) {
+	resp, err := f.Chat(ctx, req)
+	if err == nil {
+		emit(onEvent, StreamEvent{Type: StreamText, Delta: resp.Content})
+	}
+	return resp, err
+}
+
+func ok(content string) func() (*ChatResponse, error) {
+	return func() (*ChatResponse, error) { return &ChatResponse{Content: content, FinishReason: "stop"}, nil }
+}
+
+func apiFail(kind error) func() (*ChatResponse, error) {
+	return func() (*ChatResponse, error) {
+		return nil, &APIError{Kind: kind, Provider: "fake", Message: kind.Error()}
+	}
+}
+
+func TestRouterFailsOverOnRateLimit(t *testing.T) {
+	primary := &fakeProvider{results: []func() (*ChatResponse, error){apiFail(ErrRateLimited)}}
+	backup := &fakeProvider{results: []func() (*ChatResponse, error){ok("from backup")}}
+	r := NewRouter([]RouterTarget{
+		{Name: "primary", Provider: primary, Model: "big"},
+		{Name: "backup", Provider: backup, Model: "small"},
+	}, RouterOptions{Cooldown: time.Minute})
+
+	resp, err := r.Chat(context.Background(), ChatRequest{Model: "big"})
+	if err != nil || resp.Content != "from backup" {
+		t.Fatalf("resp = %+v, err = %v", resp, err)
+	}
+	if backup.models[0] != "small" {
+		t.Errorf("backup asked for model %q, want its own", backup.models[0])
+	}
+
+	// The rate-limited primary is skipped while its circuit is open.
+	if _, err := r.Chat(context.Background(), ChatRequest{Model: "big"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(primary.models) != 1 {
+		t.Errorf("primary called %d times, want 1 (circuit open)", len(primary.models))
+	}
+}
+
+func TestRouterDoesNotFailOverOnBadRequest(t *testing.T) {
+	primary := &fakeProvider{results: []func() (*ChatResponse, error){apiFail(ErrInvalidRequest)}}
+	backup := &fakeProvider{results: []func() (*ChatResponse, error){ok("unused")}}
+	r := NewRouter([]RouterTarget{
+		{Name: "primary", Provider: primary},
+		{Name: "backup", Provider: backup},
+	}, RouterOptions{})
+
+	_, err := r.Chat(context.Background(), ChatRequest{})
+	if !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("err = %v, want ErrInvalidRequest passed through", err)
+	}
+	if len(backup.models) != 0 {
+		t.Error("backup should not be tried for a bad request")
+	}
+}
+
+func TestRouterCircuitThreshold(t *testing.T) {
+	transport := func() (*ChatResponse, error) { return nil, errors.New("connection reset") }
+	primary := &fakeProvider{results: []func() (*ChatResponse, error){transport}}
+	backup := &fakeProvider{results: []func() (*ChatResponse, error){ok("b")}}
+	r := NewRouter([]RouterTarget{
+		{Name: "primary", Provider: primary},
+		{Name: "backup", Provider: backup},
+	}, RouterOptions{FailureThreshold: 2, Cooldown: time.Minute})
+
+	for i := 0; i < 3; i++ {
+		if _, err := r.Chat(context.Background(), ChatRequest{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(primary.models) != 2 {
+		t.Errorf("primary called %d times, want 2 before circuit opens", len(primary.models))
+	}
+}
+
+func TestRouterStreamDoesNotFailOverAfterOutput(t *testing.T) {
+	primary := &fakeProvider{results: []func() (*ChatResponse, error){ok("partial")}}
+	r := NewRouter([]RouterTarget{{Name: "primary", Provider: primary}}, RouterOptions{})
+
+	var got string
+	resp, err := r.ChatStream(context.Background(), ChatRequest{}, func(ev StreamEvent) { got += ev.Delta })
+	if err != nil || resp.Content != "partial" || got != "partial" {
+		t.Fatalf("resp = %+v, streamed = %q, err = %v", resp, got, err)
+	}
+}
+
+func TestRouterHonorsRetryAfter(t *testing.T) {
+	limited := func() (*ChatResponse, error) {
+		return nil, &APIError{Kind: ErrRateLimited, RetryAfter: time.Hour}
+	}
+	primary := &fakeProvider{results: []func() (*ChatResponse, error){limited}}
+	backup := &fakeProvider{results: []func() (*ChatResponse, error){ok("b")}}
+	r := NewRouter([]RouterTarget{
+		{Name: "primary", Provider: primary},
+		{Name: "backup", Provider: backup},
+	}, RouterOptions{Cooldown: time.Millisecond})
+
+	r.Chat(context.Background(), ChatRequest{})
+	time.Sleep(5 * time.Millisecond)
+	r.Chat(context.Background(), ChatRequest{})
+	if len(primary.models) != 1 {
+		t.Errorf("primary called %d times, want 1 (Retry-After outlasts cooldown)", len(primary.models))
+	}
+}
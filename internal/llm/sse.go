@@ -0,0 +1,55 @@
+package llm
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// sseEvent is a single server-sent event.
+type sseEvent struct {
+	Event string
+	Data  string
+}
+
+// readSSE reads server-sent events from r and calls fn for each one.
+// Multi-line data fields are joined with newlines. Reading stops when fn
+// returns false, the stream ends, or an error occurs.
+func readSSE(r io.Reader, fn func(ev sseEvent) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var ev sseEvent
+	var data []string
+	flush := func() bool {
+		if len(data) == 0 && ev.Event == "" {
+			return true
+		}
+		ev.Data = strings.Join(data, "\n")
+		cont := fn(ev)
+		ev = sseEvent{}
+		data = nil
+		return cont
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if !flush() {
+				return nil
+			}
+		case strings.HasPrefix(line, ":"):
+			// comment / keep-alive
+		case strings.HasPrefix(line, "event:"):
+			ev.Event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	flush()
+	return nil
+}
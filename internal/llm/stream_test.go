@@ -0,0 +1,110 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func sseServer(t *testing.T, events []string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, ev := range events {
+			fmt.Fprint(w, ev+"\n\n")
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOpenAIChatStream(t *testing.T) {
+	srv := sseServer(t, []string{
+		`data: {"choices":[{"delta":{"content":"Hel"}}]}`,
+		`data: {"choices":[{"delta":{"content":"lo","reasoning_content":"hmm"}}]}`,
+		`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"read_file","arguments":"{\"pa"}}]}}]}`,
+		`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"th\":\"a.txt\"}"}}]},"finish_reason":"tool_calls"}]}`,
+		`data: {"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`,
+		`data: [DONE]`,
+	})
+
+	p := NewOpenAIProvider("", "key", srv.URL, "gpt-4o", nil)
+	var text strings.Builder
+	var calls int
+	resp, err := p.ChatStream(context.Background(), ChatRequest{}, func(ev StreamEvent) {
+		switch ev.Type {
+		case StreamText:
+			text.WriteString(ev.Delta)
+		case StreamToolCall:
+			calls++
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "Hello" || text.String() != "Hello" {
+		t.Errorf("content = %q, streamed = %q", resp.Content, text.String())
+	}
+	if resp.ReasoningContent != "hmm" {
+		t.Errorf("reasoning = %q", resp.ReasoningContent)
+	}
+	if len(resp.ToolCalls) != 1 || calls != 1 {
+		t.Fatalf("tool calls = %+v, events = %d", resp.ToolCalls, calls)
+	}
+	if tc := resp.ToolCalls[0]; tc.ID != "call_1" || tc.Name != "read_file" || tc.Arguments["path"] != "a.txt" {
+		t.Errorf("tool call = %+v", tc)
+	}
+	if resp.FinishReason != "tool_calls" || resp.Usage["total_tokens"] != 15 {
+		t.Errorf("finish = %q, usage = %v", resp.FinishReason, resp.Usage)
+	}
+}
+
+func TestAnthropicChatStream(t *testing.T) {
+	srv := sseServer(t, []string{
+		"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":12,\"output_tokens\":1}}}",
+		"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Let me look\"}}",
+		"event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":0}",
+		"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":1,\"content_block\":{\"type\":\"tool_use\",\"id\":\"toolu_1\",\"name\":\"exec\"}}",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":1,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"{\\\"command\\\":\"}}",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":1,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"\\\"ls\\\"}\"}}",
+		"event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":1}",
+		"event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"tool_use\"},\"usage\":{\"output_tokens\":20}}",
+		"event: message_stop\ndata: {\"type\":\"message_stop\"}",
+	})
+
+	p := NewAnthropicProvider("key", srv.URL, "claude-sonnet-4-5", nil)
+	var text strings.Builder
+	var streamed []ToolCallRequest
+	resp, err := p.ChatStream(context.Background(), ChatRequest{
+		Messages: []map[string]any{{"role": "user", "content": "hi"}},
+	}, func(ev StreamEvent) {
+		switch ev.Type {
+		case StreamText:
+			text.WriteString(ev.Delta)
+		case StreamToolCall:
+			streamed = append(streamed, *ev.ToolCall)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "Let me look" || text.String() != "Let me look" {
+		t.Errorf("content = %q, streamed = %q", resp.Content, text.String())
+	}
+	if len(resp.ToolCalls) != 1 || len(streamed) != 1 {
+		t.Fatalf("tool calls = %+v, streamed = %+v", resp.ToolCalls, streamed)
+	}
+	if tc := resp.ToolCalls[0]; tc.ID != "toolu_1" || tc.Arguments["command"] != "ls" {
+		t.Errorf("tool call = %+v", tc)
+	}
+	if resp.FinishReason != "tool_calls" {
+		t.Errorf("finish = %q", resp.FinishReason)
+	}
+	if resp.Usage["prompt_tokens"] != 12 || resp.Usage["completion_tokens"] != 20 {
+		t.Errorf("usage = %v", resp.Usage)
+	}
+}
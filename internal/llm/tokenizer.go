@@ -0,0 +1,245 @@
+package llm
+
+import (
+	"encoding/json"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenizer counts the tokens a model would see for a piece of text.
+type Tokenizer interface {
+	Name() string
+	Count(text string) int
+}
+
+// Estimator approximates token counts from character classes. Its ratios
+// are calibrated per model family; CJK text is counted per character since
+// it packs far more tokens per byte than English.
+type Estimator struct {
+	Label              string
+	CharsPerToken      float64 // ASCII characters per token
+	TokensPerCJK       float64 // tokens per Han, kana or Hangul character
+	OtherBytesPerToken float64 // UTF-8 bytes per token for everything else
+}
+
+func (e Estimator) Name() string { return e.Label }
+
+// Count estimates the number of tokens in text.
+func (e Estimator) Count(text string) int {
+	var ascii, cjk, other int
+	for _, r := range text {
+		switch {
+		case r < utf8.RuneSelf:
+			ascii++
+		case isCJK(r):
+			cjk++
+		default:
+			other += utf8.RuneLen(r)
+		}
+	}
+	n := float64(ascii)/e.CharsPerToken + float64(cjk)*e.TokensPerCJK + float64(other)/e.OtherBytesPerToken
+	return int(math.Ceil(n))
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		(r >= 0x3000 && r <= 0x303F) || (r >= 0xFF00 && r <= 0xFFEF) // CJK and full-width punctuation
+}
+
+// Calibrated estimators per model family.
+var (
+	openAIEstimate   = Estimator{Label: "estimate:openai", CharsPerToken: 4.0, TokensPerCJK: 0.8, OtherBytesPerToken: 3.0}
+	claudeEstimate   = Estimator{Label: "estimate:claude", CharsPerToken: 3.5, TokensPerCJK: 1.2, OtherBytesPerToken: 2.5}
+	geminiEstimate   = Estimator{Label: "estimate:gemini", CharsPerToken: 4.0, TokensPerCJK: 0.8, OtherBytesPerToken: 3.0}
+	deepSeekEstimate = Estimator{Label: "estimate:deepseek", CharsPerToken: 3.8, TokensPerCJK: 0.7, OtherBytesPerToken: 3.0}
+	defaultEstimate  = Estimator{Label: "estimate", CharsPerToken: 3.5, TokensPerCJK: 1.2, OtherBytesPerToken: 2.5}
+)
+
+// TokenizerDir is where BPE rank files are looked up, as
+// <encoding>.tiktoken (e.g. o200k_base.tiktoken). Without them OpenAI
+// models fall back to the calibrated estimator.
+var TokenizerDir = defaultTokenizerDir()
+
+func defaultTokenizerDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".nagobot", "tokenizers")
+}
+
+var (
+	tokenizerMu sync.Mutex
+	// tokenizers maps a model name prefix to a tokenizer constructor.
+	tokenizers = map[string]func() Tokenizer{
+		"gpt-4o":     bpeEncoding("o200k_base", o200kPattern, openAIEstimate),
+		"chatgpt-4o": bpeEncoding("o200k_base", o200kPattern, openAIEstimate),
+		"gpt-4.1":    bpeEncoding("o200k_base", o200kPattern, openAIEstimate),
+		"gpt-4.5":    bpeEncoding("o200k_base", o200kPattern, openAIEstimate),
+		"gpt-5":      bpeEncoding("o200k_base", o200kPattern, openAIEstimate),
+		"o1":         bpeEncoding("o200k_base", o200kPattern, openAIEstimate),
+		"o3":         bpeEncoding("o200k_base", o200kPattern, openAIEstimate),
+		"o4":         bpeEncoding("o200k_base", o200kPattern, openAIEstimate),
+		"gpt-4":      bpeEncoding("cl100k_base", cl100kPattern, openAIEstimate),
+		"gpt-3.5":    bpeEncoding("cl100k_base", cl100kPattern, openAIEstimate),
+		"claude":     func() Tokenizer { return claudeEstimate },
+		"gemini":     func() Tokenizer { return geminiEstimate },
+		"deepseek":   func() Tokenizer { return deepSeekEstimate },
+	}
+	bpeCache = make(map[string]Tokenizer)
+)
+
+// RegisterTokenizer makes models whose name starts with prefix use the
+// tokenizer returned by newTokenizer. It overrides built-in entries.
+func RegisterTokenizer(prefix string, newTokenizer func() Tokenizer) {
+	tokenizerMu.Lock()
+	defer tokenizerMu.Unlock()
+	tokenizers[prefix] = newTokenizer
+}
+
+// TokenizerFor returns the tokenizer for a model. A routing prefix such as
+// "openai/" is ignored and the longest matching name prefix wins.
+func TokenizerFor(model string) Tokenizer {
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+	}
+	model = strings.ToLower(model)
+
+	tokenizerMu.Lock()
+	var best string
+	var newTokenizer func() Tokenizer
+	for prefix, fn := range tokenizers {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best, newTokenizer = prefix, fn
+		}
+	}
+	tokenizerMu.Unlock()
+
+	if newTokenizer == nil {
+		return defaultEstimate
+	}
+	return newTokenizer()
+}
+
+// bpeEncoding returns a constructor that loads a tiktoken encoding from
+// TokenizerDir once, falling back to an estimator if it is unavailable.
+func bpeEncoding(name, pattern string, fallback Tokenizer) func() Tokenizer {
+	return func() Tokenizer {
+		tokenizerMu.Lock()
+		defer tokenizerMu.Unlock()
+		if t, ok := bpeCache[name]; ok {
+			return t
+		}
+		var t Tokenizer = fallback
+		path := filepath.Join(TokenizerDir, name+".tiktoken")
+		if ranks, err := LoadTiktoken(path); err != nil {
+			slog.Debug("BPE ranks unavailable, using estimator", "encoding", name, "err", err)
+		} else if bpe, err := NewBPE(name, ranks, pattern); err != nil {
+			slog.Warn("Invalid BPE encoding", "encoding", name, "err", err)
+		} else {
+			t = bpe
+		}
+		bpeCache[name] = t
+		return t
+	}
+}
+
+const (
+	// messageOverhead covers the role and delimiters around each message.
+	messageOverhead = 4
+	// mediaTokens is the rough prompt cost of one inline image or document.
+	mediaTokens = 1600
+)
+
+// CountMessages returns the prompt size of messages and tool definitions
+// as counted by t.
+func CountMessages(t Tokenizer, messages []map[string]any, tools []map[string]any) int {
+	n := 0
+	for _, msg := range messages {
+		n += messageOverhead
+		if s, ok := msg["content"].(string); ok {
+			n += t.Count(s)
+		}
+		for _, part := range contentParts(msg["content"]) {
+			if part["type"] == "image_url" || part["type"] == "file" {
+				n += mediaTokens
+			} else if text, ok := part["text"].(string); ok {
+				n += t.Count(text)
+			}
+		}
+		if s, ok := msg["reasoning_content"].(string); ok {
+			n += t.Count(s)
+		}
+		for _, block := range contentParts(msg["thinking_blocks"]) {
+			if s, ok := block["thinking"].(string); ok {
+				n += t.Count(s)
+			}
+		}
+		for _, tc := range contentParts(msg["tool_calls"]) {
+			fn, _ := tc["function"].(map[string]any)
+			name, _ := fn["name"].(string)
+			args, _ := fn["arguments"].(string)
+			n += messageOverhead + t.Count(name) + t.Count(args)
+		}
+	}
+	if len(tools) > 0 {
+		data, _ := json.Marshal(tools)
+		n += t.Count(string(data))
+	}
+	return n
+}
+
+// TokenCounter counts prompt tokens for a model. Observe feeds back the
+// prompt_tokens a provider reported, and later counts are scaled by the
+// observed ratio, so estimates converge on the provider's real numbers.
+type TokenCounter struct {
+	tokenizer Tokenizer
+
+	mu       sync.Mutex
+	scale    float64
+	observed bool
+}
+
+// NewTokenCounter creates a counter using the tokenizer for model.
+func NewTokenCounter(model string) *TokenCounter {
+	return &TokenCounter{tokenizer: TokenizerFor(model), scale: 1}
+}
+
+// Tokenizer returns the underlying tokenizer.
+func (c *TokenCounter) Tokenizer() Tokenizer {
+	return c.tokenizer
+}
+
+// Count returns the calibrated prompt size of messages and tools.
+func (c *TokenCounter) Count(messages []map[string]any, tools []map[string]any) int {
+	raw := CountMessages(c.tokenizer, messages, tools)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return int(math.Ceil(float64(raw) * c.scale))
+}
+
+// Observe records that the provider reported promptTokens for a request
+// with these messages and tools.
+func (c *TokenCounter) Observe(messages []map[string]any, tools []map[string]any, promptTokens int) {
+	raw := CountMessages(c.tokenizer, messages, tools)
+	if raw == 0 || promptTokens <= 0 {
+		return
+	}
+	// Clamp so that one odd report (e.g. a proxy counting differently)
+	// cannot throw the counter far off.
+	ratio := math.Min(math.Max(float64(promptTokens)/float64(raw), 0.5), 3)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.observed {
+		c.scale, c.observed = ratio, true
+		return
+	}
+	c.scale = 0.7*c.scale + 0.3*ratio
+}
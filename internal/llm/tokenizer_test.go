@@ -0,0 +1,114 @@
+package llm
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testRanks returns single-byte ranks plus the given merges, ranked in order.
+func testRanks(merges ...string) map[string]int {
+	ranks := make(map[string]int)
+	for b := 0; b < 256; b++ {
+		ranks[string([]byte{byte(b)})] = b
+	}
+	for i, m := range merges {
+		ranks[m] = 256 + i
+	}
+	return ranks
+}
+
+func TestBPECount(t *testing.T) {
+	bpe, err := NewBPE("test", testRanks("he", "ll", "hell", "hello", " w", " wo", " wor"), cl100kPattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"hello", 1},
+		{"hell", 1},
+		{"help", 3},         // he + l + p
+		{" world", 3},       // " wor" + l + d
+		{"hello  world", 5}, // hello, " ", " wor", l, d
+	}
+	for _, tt := range tests {
+		if got := bpe.Count(tt.text); got != tt.want {
+			t.Errorf("Count(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+
+	// A whitespace run leaves its last space to the following word, as
+	// the \s+(?!\S) alternative does in tiktoken.
+	got := bpe.split("a  b\n\nc ")
+	want := []string{"a", " ", " b", "\n\n", "c", " "}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("split = %q, want %q", got, want)
+	}
+}
+
+func TestTokenizerFor(t *testing.T) {
+	dir := t.TempDir()
+	old := TokenizerDir
+	TokenizerDir = dir
+	defer func() { TokenizerDir = old; bpeCache = make(map[string]Tokenizer) }()
+	bpeCache = make(map[string]Tokenizer)
+
+	if got := TokenizerFor("openai/gpt-4o-mini").Name(); got != "estimate:openai" {
+		t.Errorf("without rank file: %s, want estimate:openai", got)
+	}
+
+	var data []byte
+	for tok, rank := range testRanks() {
+		data = fmt.Appendf(data, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(tok)), rank)
+	}
+	os.WriteFile(filepath.Join(dir, "cl100k_base.tiktoken"), data, 0o644)
+	if got := TokenizerFor("gpt-4-turbo").Name(); got != "cl100k_base" {
+		t.Errorf("with rank file: %s, want cl100k_base", got)
+	}
+
+	if got := TokenizerFor("anthropic/claude-sonnet-4-5").Name(); got != "estimate:claude" {
+		t.Errorf("claude: %s", got)
+	}
+	if got := TokenizerFor("some-local-model").Name(); got != "estimate" {
+		t.Errorf("unknown model: %s", got)
+	}
+}
+
+func TestEstimatorCJK(t *testing.T) {
+	// 20 Han characters weigh far more than 20 ASCII letters.
+	cjk := claudeEstimate.Count("我们团队大量使用中文进行日常交流和技术讨论呀")
+	ascii := claudeEstimate.Count("abcdefghijklmnopqrst")
+	if cjk <= 3*ascii {
+		t.Errorf("CJK = %d tokens, ASCII = %d tokens; CJK should count per character", cjk, ascii)
+	}
+}
+
+func TestTokenCounterObserve(t *testing.T) {
+	c := NewTokenCounter("claude-test")
+	messages := []map[string]any{
+		{"role": "user", "content": "hello there, how are you doing today?"},
+		{"role": "assistant", "content": "", "tool_calls": []map[string]any{{
+			"id": "1", "function": map[string]any{"name": "exec", "arguments": `{"command":"ls -la"}`},
+		}}},
+		{"role": "user", "content": []any{TextPart("and this"), ImagePart("image/png", []byte("x"))}},
+	}
+	raw := c.Count(messages, nil)
+	if raw < mediaTokens {
+		t.Fatalf("Count = %d, want the image counted", raw)
+	}
+
+	c.Observe(messages, nil, raw*2)
+	if got := c.Count(messages, nil); got != raw*2 {
+		t.Errorf("after first report Count = %d, want %d", got, raw*2)
+	}
+	// Later reports are smoothed.
+	c.Observe(messages, nil, raw)
+	if got := c.Count(messages, nil); got <= raw || got >= raw*2 {
+		t.Errorf("after second report Count = %d, want between %d and %d", got, raw, raw*2)
+	}
+}
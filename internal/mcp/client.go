@@ -82,6 +82,7 @@ type MCPContent struct {
 type toolCallParams struct {
 	Name      string         `json:"name"`
 	Arguments map[string]any `json:"arguments,omitempty"`
+	Meta      map[string]any `json:"_meta,omitempty"`
 }
 
 type toolCallResult struct {
@@ -129,11 +130,13 @@ func (c *Client) ListTools(ctx context.Context) ([]MCPTool, error) {
 	return result.Tools, nil
 }
 
-// CallTool invokes a tool on the MCP server.
-func (c *Client) CallTool(ctx context.Context, name string, arguments map[string]any) (string, error) {
+// CallTool invokes a tool on the MCP server. meta is sent as the request's
+// _meta field and may be nil.
+func (c *Client) CallTool(ctx context.Context, name string, arguments, meta map[string]any) (string, error) {
 	raw, err := c.call(ctx, "tools/call", toolCallParams{
 		Name:      name,
 		Arguments: arguments,
+		Meta:      meta,
 	})
 	if err != nil {
 		return "", fmt.Errorf("mcp tools/call %s.%s: %w", c.name, name, err)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"slices"
 	"time"
 
 	"github.com/joebot/nagobot/internal/config"
@@ -48,7 +49,7 @@ func NewManager(ctx context.Context, cfg config.MCPConfig) (*Manager, error) {
 
 		m.clients = append(m.clients, client)
 		for _, mt := range mcpTools {
-			m.tools = append(m.tools, NewMCPBridgeTool(client, mt))
+			m.tools = append(m.tools, NewMCPBridgeTool(client, mt, serverCfg.SendMeta))
 		}
 
 		slog.Info("MCP server connected", "server", name, "tools", len(mcpTools))
@@ -57,10 +58,13 @@ func NewManager(ctx context.Context, cfg config.MCPConfig) (*Manager, error) {
 	return m, nil
 }
 
-// RegisterTools registers all MCP tools into the given tool registry.
-func (m *Manager) RegisterTools(registry *tool.Registry) {
+// RegisterTools registers MCP tools into the given tool registry: those of
+// the named servers, or of all servers if none are named.
+func (m *Manager) RegisterTools(registry *tool.Registry, servers ...string) {
 	for _, t := range m.tools {
-		registry.Register(t)
+		if len(servers) == 0 || slices.Contains(servers, t.client.Name()) {
+			registry.Register(t)
+		}
 	}
 }
 
@@ -91,17 +95,20 @@ func (m *Manager) Close() {
 
 // MCPBridgeTool wraps an MCP tool so it can be registered in tool.Registry.
 type MCPBridgeTool struct {
-	client  *Client
-	mcpTool MCPTool
-	name    string
+	client   *Client
+	mcpTool  MCPTool
+	name     string
+	sendMeta bool // describe the invoking turn in each call's _meta
 }
 
-// NewMCPBridgeTool creates an adapter from an MCP tool definition.
-func NewMCPBridgeTool(client *Client, mcpTool MCPTool) *MCPBridgeTool {
+// NewMCPBridgeTool creates an adapter from an MCP tool definition. With
+// sendMeta, calls tell the server which chat and sender they come from.
+func NewMCPBridgeTool(client *Client, mcpTool MCPTool, sendMeta bool) *MCPBridgeTool {
 	return &MCPBridgeTool{
-		client:  client,
-		mcpTool: mcpTool,
-		name:    fmt.Sprintf("mcp__%s__%s", client.Name(), mcpTool.Name),
+		client:   client,
+		mcpTool:  mcpTool,
+		name:     fmt.Sprintf("mcp__%s__%s", client.Name(), mcpTool.Name),
+		sendMeta: sendMeta,
 	}
 }
 
@@ -109,13 +116,38 @@ func (t *MCPBridgeTool) Name() string        { return t.name }
 func (t *MCPBridgeTool) Description() string  { return t.mcpTool.Description }
 func (t *MCPBridgeTool) Parameters() map[string]any { return t.mcpTool.InputSchema }
 
-func (t *MCPBridgeTool) Execute(ctx context.Context, params map[string]any) (tool.ToolResult, error) {
+func (t *MCPBridgeTool) Execute(ctx context.Context, ec tool.ExecContext, params map[string]any) (tool.ToolResult, error) {
 	callCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	text, err := t.client.CallTool(callCtx, t.mcpTool.Name, params)
+	var meta map[string]any
+	if t.sendMeta {
+		meta = callMeta(ec)
+	}
+	text, err := t.client.CallTool(callCtx, t.mcpTool.Name, params, meta)
 	if err != nil {
 		return tool.ToolResult{Content: fmt.Sprintf("MCP tool error: %s", err)}, nil
 	}
 	return tool.ToolResult{Content: text}, nil
 }
+
+// callMeta describes the invoking turn to an MCP server configured with
+// sendMeta, so it can tell sessions and senders apart. Empty fields are
+// omitted.
+func callMeta(ec tool.ExecContext) map[string]any {
+	meta := make(map[string]any)
+	for key, value := range map[string]string{
+		"nagobot/channel": ec.Channel,
+		"nagobot/chatId":  ec.ChatID,
+		"nagobot/sender":  ec.SenderID,
+		"nagobot/session": ec.SessionKey,
+	} {
+		if value != "" {
+			meta[key] = value
+		}
+	}
+	if len(meta) == 0 {
+		return nil
+	}
+	return meta
+}
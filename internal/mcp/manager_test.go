@@ -0,0 +1,50 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/joebot/nagobot/internal/tool"
+)
+
+// recordingTransport answers every request with a text result and keeps
+// the params of the last one.
+type recordingTransport struct{ params map[string]any }
+
+func (t *recordingTransport) Start(context.Context) error { return nil }
+func (t *recordingTransport) Close() error                { return nil }
+
+func (t *recordingTransport) Notify(context.Context, []byte) error { return nil }
+
+func (t *recordingTransport) RoundTrip(_ context.Context, request []byte) ([]byte, error) {
+	var req struct {
+		ID     int64          `json:"id"`
+		Params map[string]any `json:"params"`
+	}
+	if err := json.Unmarshal(request, &req); err != nil {
+		return nil, err
+	}
+	t.params = req.Params
+	return fmt.Appendf(nil, `{"jsonrpc":"2.0","id":%d,"result":{"content":[{"type":"text","text":"ok"}]}}`, req.ID), nil
+}
+
+func TestBridgeToolSendsMetaOnlyWhenEnabled(t *testing.T) {
+	ec := tool.ExecContext{Channel: "discord", ChatID: "42", SenderID: "alice", SessionKey: "discord:42"}
+	for _, sendMeta := range []bool{false, true} {
+		transport := &recordingTransport{}
+		bt := NewMCPBridgeTool(NewClient("srv", transport), MCPTool{Name: "lookup"}, sendMeta)
+		result, err := bt.Execute(context.Background(), ec, map[string]any{"q": "x"})
+		if err != nil || result.Content != "ok" {
+			t.Fatalf("sendMeta=%v: result = %+v, err = %v", sendMeta, result, err)
+		}
+		meta, sent := transport.params["_meta"].(map[string]any)
+		if sent != sendMeta {
+			t.Errorf("sendMeta=%v: _meta = %v", sendMeta, transport.params["_meta"])
+		}
+		if sendMeta && (meta["nagobot/sender"] != "alice" || meta["nagobot/session"] != "discord:42") {
+			t.Errorf("_meta = %v", meta)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Checkpoint statuses.
+const (
+	CheckpointRunning = "running" // the turn is in progress, or was cut off by a restart
+	CheckpointStopped = "stopped" // the turn stopped early and waits for /continue
+)
+
+// Checkpoint is the state of an unfinished turn's ReAct loop. It is saved
+// after every step, so that the turn can be continued after a restart or
+// once it has run out of iterations.
+type Checkpoint struct {
+	Key     string `json:"key"`   // session the turn runs in
+	Agent   string `json:"agent"` // profile whose loop runs the turn
+	Channel string `json:"channel"`
+	ChatID  string `json:"chat_id"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"` // why a stopped turn stopped
+
+	Content      string   `json:"content"` // the user message
+	Media        []string `json:"media,omitempty"`
+	MediaMessage int      `json:"media_message,omitempty"` // 1-based index of the message whose inline media was left out
+
+	Messages   []map[string]any `json:"messages"`          // the LLM conversation so far
+	Iterations int              `json:"iterations"`        // LLM calls made
+	Limit      int              `json:"limit"`             // LLM calls allowed
+	Pending    []ToolCall       `json:"pending,omitempty"` // requested calls not yet run
+
+	Transcript []Message `json:"transcript,omitempty"` // tool steps saved with the turn
+	Steps      []string  `json:"steps,omitempty"`      // summaries kept if the turn is abandoned
+	ToolsUsed  []string  `json:"tools_used,omitempty"`
+	MediaFiles []string  `json:"media_files,omitempty"` // files produced by tools
+	Reasoning  []string  `json:"reasoning,omitempty"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SaveCheckpoint persists the checkpoint of the turn running in cp.Key.
+func (m *Manager) SaveCheckpoint(cp *Checkpoint) error {
+	cp.UpdatedAt = time.Now()
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("encode checkpoint: %w", err)
+	}
+	path := m.checkpointPath(cp.Key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create checkpoint dir: %w", err)
+	}
+	// Write then rename, so a crash never leaves a torn checkpoint.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadCheckpoint returns the checkpoint of an unfinished turn in the
+// session, or nil.
+func (m *Manager) LoadCheckpoint(key string) *Checkpoint {
+	data, err := os.ReadFile(m.checkpointPath(key))
+	if err != nil {
+		return nil
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil
+	}
+	return &cp
+}
+
+// DeleteCheckpoint removes the session's checkpoint, if any.
+func (m *Manager) DeleteCheckpoint(key string) {
+	os.Remove(m.checkpointPath(key))
+}
+
+// Checkpoints returns the checkpoints of all sessions.
+func (m *Manager) Checkpoints() []*Checkpoint {
+	entries, err := os.ReadDir(filepath.Join(m.sessionsDir, "checkpoints"))
+	if err != nil {
+		return nil
+	}
+	var cps []*Checkpoint
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(m.sessionsDir, "checkpoints", e.Name()))
+		if err != nil {
+			continue
+		}
+		var cp Checkpoint
+		if json.Unmarshal(data, &cp) == nil {
+			cps = append(cps, &cp)
+		}
+	}
+	return cps
+}
+
+func (m *Manager) checkpointPath(key string) string {
+	safe := safeFilename(strings.ReplaceAll(key, ":", "_"))
+	return filepath.Join(m.sessionsDir, "checkpoints", safe+".json")
+}
@@ -12,20 +12,101 @@ import (
 	"time"
 )
 
-// Message is a single message in a session.
+// Message is a single message in a session. Besides the user and assistant
+// text, a turn stores its intermediate steps: assistant messages carrying
+// ToolCalls, each followed by one "tool" message per call with its result.
 type Message struct {
-	Role      string   `json:"role"`
-	Content   string   `json:"content"`
-	Timestamp string   `json:"timestamp,omitempty"`
-	ToolsUsed []string `json:"tools_used,omitempty"`
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	Timestamp  string     `json:"timestamp,omitempty"`
+	ToolsUsed  []string   `json:"tools_used,omitempty"`
+	Media      []string   `json:"media,omitempty"` // paths of attached or produced files
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"` // tool results: the call answered
+	Name       string     `json:"name,omitempty"`         // tool results: the tool
 }
 
+// ToolCall is a tool invocation requested by the assistant.
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"` // JSON-encoded
+}
+
+// IsStep reports whether m is an intermediate tool step rather than user
+// or assistant text.
+func (m Message) IsStep() bool {
+	return m.Role == "tool" || len(m.ToolCalls) > 0
+}
+
+// NewToolCallMessage returns an assistant step requesting tool calls.
+func NewToolCallMessage(content string, calls []ToolCall) Message {
+	return Message{
+		Role:      "assistant",
+		Content:   content,
+		Timestamp: time.Now().Format(time.RFC3339),
+		ToolCalls: calls,
+	}
+}
+
+// NewToolResultMessage returns the result of a tool call.
+func NewToolResultMessage(callID, name, content string, media []string) Message {
+	return Message{
+		Role:       "tool",
+		Content:    content,
+		Timestamp:  time.Now().Format(time.RFC3339),
+		Media:      media,
+		ToolCallID: callID,
+		Name:       name,
+	}
+}
+
+// ToolDetail controls how much tool activity GetHistory replays.
+type ToolDetail string
+
+const (
+	// ToolDetailFull replays tool calls with their stored results.
+	ToolDetailFull ToolDetail = "full"
+	// ToolDetailCalls replays tool calls with results cut to a preview.
+	ToolDetailCalls ToolDetail = "calls"
+	// ToolDetailNone replays only user and assistant text.
+	ToolDetailNone ToolDetail = "none"
+)
+
+// resultPreviewChars is how much of a tool result ToolDetailCalls keeps.
+const resultPreviewChars = 200
+
 // Session holds conversation history for a channel:chat_id pair.
 type Session struct {
 	Key       string
 	Messages  []Message
 	CreatedAt time.Time
 	UpdatedAt time.Time
+
+	ShowReasoning bool   // include the model's reasoning in replies
+	Model         string // overrides the agent's model; empty uses it
+	Active        string // on a chat's default conversation: the active one's name
+}
+
+// DefaultConversation names the conversation stored under a chat's own
+// session key.
+const DefaultConversation = "default"
+
+// ConversationKey returns the session key of a named conversation in the
+// chat whose session key is base.
+func ConversationKey(base, name string) string {
+	if name == "" || name == DefaultConversation {
+		return base
+	}
+	return base + "#" + name
+}
+
+// ConversationName returns the conversation name part of a session key.
+func ConversationName(key string) string {
+	if _, name, ok := strings.Cut(key, "#"); ok {
+		return name
+	}
+	return DefaultConversation
 }
 
 // AddMessage appends a message to the session.
@@ -39,19 +120,97 @@ func (s *Session) AddMessage(role, content string, toolsUsed ...string) {
 	s.UpdatedAt = time.Now()
 }
 
-// GetHistory returns the last maxMessages in LLM-friendly format.
-func (s *Session) GetHistory(maxMessages int) []map[string]any {
-	msgs := s.Messages
-	if len(msgs) > maxMessages {
-		msgs = msgs[len(msgs)-maxMessages:]
+// AddMessageWithMedia appends a message that had files attached.
+func (s *Session) AddMessageWithMedia(role, content string, media []string) {
+	s.AddMessage(role, content)
+	s.Messages[len(s.Messages)-1].Media = media
+}
+
+// AddSteps appends the intermediate steps of a turn.
+func (s *Session) AddSteps(steps []Message) {
+	s.Messages = append(s.Messages, steps...)
+	s.UpdatedAt = time.Now()
+}
+
+// Len returns the number of user and assistant text messages, not
+// counting tool steps.
+func (s *Session) Len() int {
+	n := 0
+	for _, m := range s.Messages {
+		if !m.IsStep() {
+			n++
+		}
+	}
+	return n
+}
+
+// RecentStart returns the index in Messages where the last n text messages
+// begin, moved back to include the steps that belong to them.
+func (s *Session) RecentStart(n int) int {
+	i := len(s.Messages)
+	for i > 0 && n > 0 {
+		i--
+		if !s.Messages[i].IsStep() {
+			n--
+		}
+	}
+	// Steps never start a window: their assistant message and results
+	// must stay together.
+	for i > 0 && i < len(s.Messages) && s.Messages[i].IsStep() {
+		i--
 	}
-	history := make([]map[string]any, len(msgs))
-	for i, m := range msgs {
-		history[i] = map[string]any{"role": m.Role, "content": m.Content}
+	return i
+}
+
+// GetHistory returns the last maxMessages text messages, with the tool steps
+// between them as selected by detail, in LLM-friendly format. Attached and
+// produced files are referenced by path, not re-sent.
+func (s *Session) GetHistory(maxMessages int, detail ToolDetail) []map[string]any {
+	msgs := s.Messages[s.RecentStart(maxMessages):]
+	history := make([]map[string]any, 0, len(msgs))
+	for _, m := range msgs {
+		if m.IsStep() && detail == ToolDetailNone {
+			continue
+		}
+		content := m.Content
+		if m.Role == "tool" && detail == ToolDetailCalls {
+			content = preview(content)
+		}
+		for _, path := range m.Media {
+			content += "\n[Attached file: " + path + "]"
+		}
+		h := map[string]any{"role": m.Role, "content": content}
+		if len(m.ToolCalls) > 0 {
+			calls := make([]map[string]any, len(m.ToolCalls))
+			for i, tc := range m.ToolCalls {
+				calls[i] = map[string]any{
+					"id":   tc.ID,
+					"type": "function",
+					"function": map[string]any{
+						"name":      tc.Name,
+						"arguments": tc.Arguments,
+					},
+				}
+			}
+			h["tool_calls"] = calls
+		}
+		if m.Role == "tool" {
+			h["tool_call_id"] = m.ToolCallID
+			h["name"] = m.Name
+		}
+		history = append(history, h)
 	}
 	return history
 }
 
+func preview(s string) string {
+	r := []rune(s)
+	if len(r) <= resultPreviewChars {
+		return s
+	}
+	return string(r[:resultPreviewChars]) + "… (truncated)"
+}
+
 // Clear removes all messages.
 func (s *Session) Clear() {
 	s.Messages = nil
@@ -63,6 +222,9 @@ type Manager struct {
 	sessionsDir string
 	cache       map[string]*Session
 	mu          sync.Mutex
+
+	lockMu sync.Mutex
+	locks  map[string]*sync.Mutex
 }
 
 // NewManager creates a new session manager.
@@ -72,7 +234,59 @@ func NewManager() *Manager {
 	return &Manager{
 		sessionsDir: dir,
 		cache:       make(map[string]*Session),
+		locks:       make(map[string]*sync.Mutex),
+	}
+}
+
+// Lock acquires the turn lock for a session and returns the function that
+// releases it. Holders may read and modify the session freely; it keeps
+// concurrent turns (e.g. a chat message and a cron job) from interleaving.
+func (m *Manager) Lock(key string) (unlock func()) {
+	m.lockMu.Lock()
+	mu, ok := m.locks[key]
+	if !ok {
+		mu = &sync.Mutex{}
+		m.locks[key] = mu
 	}
+	m.lockMu.Unlock()
+	mu.Lock()
+	return mu.Unlock
+}
+
+// Active returns the session key of the chat's active conversation.
+func (m *Manager) Active(base string) string {
+	return ConversationKey(base, m.GetOrCreate(base).Active)
+}
+
+// Exists reports whether a session has been saved or holds messages.
+func (m *Manager) Exists(key string) bool {
+	m.mu.Lock()
+	s, ok := m.cache[key]
+	m.mu.Unlock()
+	if ok && len(s.Messages) > 0 {
+		return true
+	}
+	_, err := os.Stat(m.sessionPath(key))
+	return err == nil
+}
+
+// Conversations returns the names of the saved conversations of the chat
+// whose session key is base, sorted, starting with DefaultConversation.
+func (m *Manager) Conversations(base string) []string {
+	names := []string{DefaultConversation}
+	entries, err := os.ReadDir(m.sessionsDir)
+	if err != nil {
+		return names
+	}
+	prefix := safeFilename(strings.ReplaceAll(base, ":", "_")) + "#"
+	var named []string
+	for _, e := range entries {
+		if name, ok := strings.CutPrefix(e.Name(), prefix); ok && strings.HasSuffix(name, ".jsonl") {
+			named = append(named, strings.TrimSuffix(name, ".jsonl"))
+		}
+	}
+	sort.Strings(named)
+	return append(names, named...)
 }
 
 // GetOrCreate returns an existing session or creates a new one.
@@ -116,6 +330,15 @@ func (m *Manager) Save(s *Session) error {
 		"created_at": s.CreatedAt.Format(time.RFC3339),
 		"updated_at": s.UpdatedAt.Format(time.RFC3339),
 	}
+	if s.ShowReasoning {
+		meta["show_reasoning"] = true
+	}
+	if s.Model != "" {
+		meta["model"] = s.Model
+	}
+	if s.Active != "" {
+		meta["active"] = s.Active
+	}
 	metaJSON, _ := json.Marshal(meta)
 	f.Write(metaJSON)
 	f.WriteString("\n")
@@ -195,6 +418,8 @@ func (m *Manager) load(key string) *Session {
 
 	var messages []Message
 	var createdAt time.Time
+	var showReasoning bool
+	var model, active string
 
 	scanner := bufio.NewScanner(f)
 	scanner.Buffer(make([]byte, 1024*1024), 1024*1024) // 1MB buffer
@@ -211,6 +436,9 @@ func (m *Manager) load(key string) *Session {
 			if ts, ok := raw["created_at"].(string); ok {
 				createdAt, _ = time.Parse(time.RFC3339, ts)
 			}
+			showReasoning, _ = raw["show_reasoning"].(bool)
+			model, _ = raw["model"].(string)
+			active, _ = raw["active"].(string)
 		} else {
 			var msg Message
 			if json.Unmarshal([]byte(line), &msg) == nil {
@@ -224,10 +452,13 @@ func (m *Manager) load(key string) *Session {
 	}
 
 	return &Session{
-		Key:       key,
-		Messages:  messages,
-		CreatedAt: createdAt,
-		UpdatedAt: time.Now(),
+		Key:           key,
+		Messages:      messages,
+		CreatedAt:     createdAt,
+		UpdatedAt:     time.Now(),
+		ShowReasoning: showReasoning,
+		Model:         model,
+		Active:        active,
 	}
 }
 
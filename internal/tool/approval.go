@@ -0,0 +1,189 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/joebot/nagobot/internal/bus"
+)
+
+// ApprovalRule marks tool calls that need the user's confirmation before
+// they run.
+type ApprovalRule struct {
+	Tool   string         // tool name or path.Match pattern
+	Param  string         // argument Match is applied to; empty uses all arguments as JSON
+	Match  *regexp.Regexp // nil matches every call of Tool
+	Reason string         // shown to the user when asking
+}
+
+func (r ApprovalRule) matches(name string, params map[string]any) bool {
+	if ok, _ := path.Match(r.Tool, name); !ok {
+		return false
+	}
+	if r.Match == nil {
+		return true
+	}
+	var subject string
+	if r.Param != "" {
+		v, ok := params[r.Param]
+		if !ok {
+			return false
+		}
+		if s, ok := v.(string); ok {
+			subject = s
+		} else {
+			b, _ := json.Marshal(v)
+			subject = string(b)
+		}
+	} else {
+		b, _ := json.Marshal(params)
+		subject = string(b)
+	}
+	return r.Match.MatchString(subject)
+}
+
+// Approval decisions recorded in the audit trail.
+const (
+	ApprovalApproved    = "approved"
+	ApprovalDeclined    = "declined"
+	ApprovalTimedOut    = "timeout"
+	ApprovalCancelled   = "cancelled"   // the turn was interrupted while waiting
+	ApprovalUnavailable = "unavailable" // the channel cannot ask anyone
+)
+
+// ApprovalRecord is one decision in the audit trail.
+type ApprovalRecord struct {
+	Time      time.Time `json:"time"`
+	Session   string    `json:"session,omitempty"`
+	Channel   string    `json:"channel,omitempty"`
+	Sender    string    `json:"sender,omitempty"`
+	Tool      string    `json:"tool"`
+	Arguments string    `json:"arguments"`
+	Reason    string    `json:"reason,omitempty"`
+	Decision  string    `json:"decision"`
+	WaitMs    int64     `json:"wait_ms"`
+}
+
+// ApprovalPolicy holds the rules that gate tool calls, asks the user through
+// ExecContext.Approve when one matches, and appends every decision to a
+// JSONL audit file. A nil policy approves everything. It is safe for
+// concurrent use.
+type ApprovalPolicy struct {
+	rules     []ApprovalRule
+	timeout   time.Duration
+	auditPath string
+	mu        sync.Mutex
+}
+
+// NewApprovalPolicy creates a policy. Unanswered requests are declined
+// after timeout; an empty auditPath disables the audit trail.
+func NewApprovalPolicy(rules []ApprovalRule, timeout time.Duration, auditPath string) *ApprovalPolicy {
+	if timeout <= 0 {
+		timeout = 2 * time.Minute
+	}
+	return &ApprovalPolicy{rules: rules, timeout: timeout, auditPath: auditPath}
+}
+
+// Match returns the first rule that requires confirming the call.
+func (p *ApprovalPolicy) Match(name string, params map[string]any) (ApprovalRule, bool) {
+	if p == nil {
+		return ApprovalRule{}, false
+	}
+	for _, r := range p.rules {
+		if r.matches(name, params) {
+			return r, true
+		}
+	}
+	return ApprovalRule{}, false
+}
+
+// confirm asks whether the call may run. It returns "" when approved and
+// otherwise the result to give the model instead of running the tool.
+func (p *ApprovalPolicy) confirm(ctx context.Context, ec ExecContext, rule ApprovalRule, name string, params map[string]any) string {
+	argsJSON, _ := json.Marshal(params)
+	rec := ApprovalRecord{
+		Session:   ec.SessionKey,
+		Channel:   ec.Channel,
+		Sender:    ec.SenderID,
+		Tool:      name,
+		Arguments: string(argsJSON),
+		Reason:    rule.Reason,
+	}
+
+	if ec.Approve == nil {
+		rec.Decision = ApprovalUnavailable
+		p.record(rec)
+		return fmt.Sprintf("Error: %s needs the user's approval, but nobody can be asked from this channel. The call was not run.", name)
+	}
+
+	slog.Info("Waiting for approval", "tool", name, "session", ec.SessionKey, "reason", rule.Reason)
+	askCtx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	start := time.Now()
+	ok, err := ec.Approve(askCtx, bus.ApprovalRequest{
+		Tool:      name,
+		Arguments: string(argsJSON),
+		Reason:    rule.Reason,
+		Timeout:   p.timeout,
+	})
+	rec.WaitMs = time.Since(start).Milliseconds()
+
+	var result string
+	switch {
+	case err == nil && ok:
+		rec.Decision = ApprovalApproved
+	case err == nil:
+		rec.Decision = ApprovalDeclined
+		result = fmt.Sprintf("The user declined this %s call. It was not run; do not retry it unless the user asks.", name)
+	case ctx.Err() != nil:
+		rec.Decision = ApprovalCancelled
+		result = fmt.Sprintf("Error: %s was cancelled while waiting for approval.", name)
+	case errors.Is(err, context.DeadlineExceeded):
+		rec.Decision = ApprovalTimedOut
+		result = fmt.Sprintf("Error: nobody approved this %s call within %s. It was not run.", name, p.timeout)
+	default:
+		rec.Decision = ApprovalUnavailable
+		result = fmt.Sprintf("Error: could not ask for approval of %s: %s. The call was not run.", name, err)
+	}
+	slog.Info("Approval decision", "tool", name, "session", ec.SessionKey, "decision", rec.Decision)
+	p.record(rec)
+	return result
+}
+
+// record appends rec to the audit file. Write failures are logged rather
+// than returned so auditing never breaks a conversation.
+func (p *ApprovalPolicy) record(rec ApprovalRecord) {
+	if p.auditPath == "" {
+		return
+	}
+	rec.Time = time.Now()
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(p.auditPath), 0755); err != nil {
+		slog.Warn("Failed to create approval audit dir", "err", err)
+		return
+	}
+	f, err := os.OpenFile(p.auditPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		slog.Warn("Failed to open approval audit", "err", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		slog.Warn("Failed to write approval audit", "err", err)
+	}
+}
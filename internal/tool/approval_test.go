@@ -0,0 +1,94 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joebot/nagobot/internal/bus"
+)
+
+// countingTool records how often it ran.
+type countingTool struct{ runs int }
+
+func (t *countingTool) Name() string               { return "exec" }
+func (t *countingTool) Description() string        { return "" }
+func (t *countingTool) Parameters() map[string]any { return nil }
+func (t *countingTool) Execute(_ context.Context, ec ExecContext, params map[string]any) (ToolResult, error) {
+	t.runs++
+	return ToolResult{Content: "ran"}, nil
+}
+
+func TestApprovalPolicy(t *testing.T) {
+	audit := filepath.Join(t.TempDir(), "approvals.jsonl")
+	policy := NewApprovalPolicy([]ApprovalRule{
+		{Tool: "exec", Param: "command", Match: regexp.MustCompile(`\bgit\s+push\b`), Reason: "pushes code"},
+	}, 50*time.Millisecond, audit)
+
+	if _, ok := policy.Match("exec", map[string]any{"command": "git status"}); ok {
+		t.Error("git status should not need approval")
+	}
+	if _, ok := policy.Match("read_file", map[string]any{"command": "git push"}); ok {
+		t.Error("rule for exec matched read_file")
+	}
+
+	ct := &countingTool{}
+	r := NewRegistry()
+	r.Register(ct)
+	r.SetApprovals(policy)
+	push := map[string]any{"command": "git push origin main"}
+	answer := func(ok bool) bus.ApproveFunc {
+		return func(ctx context.Context, req bus.ApprovalRequest) (bool, error) {
+			if req.Tool != "exec" || req.Reason != "pushes code" {
+				t.Errorf("request = %+v", req)
+			}
+			return ok, nil
+		}
+	}
+	ctx, ec := context.Background(), ExecContext{}
+
+	ec.Approve = answer(true)
+	if res := r.Execute(ctx, ec, "exec", push); res.Content != "ran" {
+		t.Errorf("approved call: %q", res.Content)
+	}
+	ec.Approve = answer(false)
+	if res := r.Execute(ctx, ec, "exec", push); !strings.Contains(res.Content, "declined") {
+		t.Errorf("declined call: %q", res.Content)
+	}
+	ec.Approve = func(ctx context.Context, req bus.ApprovalRequest) (bool, error) {
+		<-ctx.Done()
+		return false, ctx.Err()
+	}
+	if res := r.Execute(ctx, ec, "exec", push); !strings.Contains(res.Content, "within") {
+		t.Errorf("timed out call: %q", res.Content)
+	}
+	ec.Approve = nil
+	r.Execute(ctx, ec, "exec", push)
+	r.Execute(ctx, ec, "exec", map[string]any{"command": "ls"})
+
+	if ct.runs != 2 {
+		t.Errorf("tool ran %d times, want 2", ct.runs)
+	}
+
+	data, err := os.ReadFile(audit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decisions []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var rec ApprovalRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatal(err)
+		}
+		decisions = append(decisions, rec.Decision)
+	}
+	want := []string{ApprovalApproved, ApprovalDeclined, ApprovalTimedOut, ApprovalUnavailable}
+	if strings.Join(decisions, ",") != strings.Join(want, ",") {
+		t.Errorf("audit decisions = %v, want %v", decisions, want)
+	}
+}
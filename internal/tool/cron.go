@@ -11,9 +11,7 @@ import (
 
 // CronTool allows the agent to schedule, list, and remove cron jobs.
 type CronTool struct {
-	service        *cron.Service
-	defaultChannel string
-	defaultChatID  string
+	service *cron.Service
 }
 
 // NewCronTool creates a new cron tool.
@@ -21,12 +19,6 @@ func NewCronTool(service *cron.Service) *CronTool {
 	return &CronTool{service: service}
 }
 
-// SetContext sets the current channel/chat context for job delivery.
-func (t *CronTool) SetContext(channel, chatID string) {
-	t.defaultChannel = channel
-	t.defaultChatID = chatID
-}
-
 func (t *CronTool) Name() string { return "cron" }
 func (t *CronTool) Description() string {
 	return "Schedule reminders and recurring tasks. Actions: add, list, remove."
@@ -65,7 +57,7 @@ func (t *CronTool) Parameters() map[string]any {
 	}
 }
 
-func (t *CronTool) Execute(_ context.Context, params map[string]any) (ToolResult, error) {
+func (t *CronTool) Execute(_ context.Context, ec ExecContext, params map[string]any) (ToolResult, error) {
 	action, err := requireStringParam(params, "action")
 	if err != nil {
 		return ToolResult{}, err
@@ -73,7 +65,7 @@ func (t *CronTool) Execute(_ context.Context, params map[string]any) (ToolResult
 
 	switch action {
 	case "add":
-		return t.addJob(params)
+		return t.addJob(ec, params)
 	case "list":
 		return t.listJobs()
 	case "remove":
@@ -83,12 +75,14 @@ func (t *CronTool) Execute(_ context.Context, params map[string]any) (ToolResult
 	}
 }
 
-func (t *CronTool) addJob(params map[string]any) (ToolResult, error) {
+func (t *CronTool) addJob(ec ExecContext, params map[string]any) (ToolResult, error) {
 	message := getStringParam(params, "message")
 	if message == "" {
 		return ToolResult{Content: "Error: message is required for add"}, nil
 	}
-	if t.defaultChannel == "" || t.defaultChatID == "" {
+	// Jobs deliver to the chat they were created from.
+	channel, chatID := ec.Channel, ec.ChatID
+	if channel == "" || chatID == "" {
 		return ToolResult{Content: "Error: no session context (channel/chat_id)"}, nil
 	}
 
@@ -123,7 +117,7 @@ func (t *CronTool) addJob(params map[string]any) (ToolResult, error) {
 		name = name[:30]
 	}
 
-	job := t.service.AddJob(name, schedule, message, true, t.defaultChannel, t.defaultChatID, deleteAfter)
+	job := t.service.AddJob(name, schedule, message, true, channel, chatID, deleteAfter)
 	return ToolResult{Content: fmt.Sprintf("Created job '%s' (id: %s)", job.Name, job.ID)}, nil
 }
 
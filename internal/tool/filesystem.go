@@ -10,11 +10,15 @@ import (
 	"strings"
 )
 
-func resolvePath(path string, allowedDir string) (string, error) {
+// resolvePath makes path absolute, resolving a relative one against
+// workdir (or the process directory when it is empty).
+func resolvePath(path string, workdir string, allowedDir string) (string, error) {
 	expanded := path
 	if strings.HasPrefix(expanded, "~/") {
 		home, _ := os.UserHomeDir()
 		expanded = filepath.Join(home, expanded[2:])
+	} else if workdir != "" && !filepath.IsAbs(expanded) {
+		expanded = filepath.Join(workdir, expanded)
 	}
 	resolved, err := filepath.Abs(expanded)
 	if err != nil {
@@ -32,7 +36,8 @@ func resolvePath(path string, allowedDir string) (string, error) {
 // ReadFileTool reads file contents.
 type ReadFileTool struct {
 	AllowedDir string
-	EmbedFS    fs.FS // optional fallback for embedded files (e.g. builtin skills)
+	Workdir    string // base of relative paths
+	EmbedFS    fs.FS  // optional fallback for embedded files (e.g. builtin skills)
 }
 
 func (t *ReadFileTool) Name() string        { return "read_file" }
@@ -50,7 +55,7 @@ func (t *ReadFileTool) Parameters() map[string]any {
 	}
 }
 
-func (t *ReadFileTool) Execute(_ context.Context, params map[string]any) (ToolResult, error) {
+func (t *ReadFileTool) Execute(_ context.Context, _ ExecContext, params map[string]any) (ToolResult, error) {
 	path, err := requireStringParam(params, "path")
 	if err != nil {
 		return ToolResult{}, err
@@ -66,7 +71,7 @@ func (t *ReadFileTool) Execute(_ context.Context, params map[string]any) (ToolRe
 		}
 	}
 
-	resolved, err := resolvePath(path, t.AllowedDir)
+	resolved, err := resolvePath(path, t.Workdir, t.AllowedDir)
 	if err != nil {
 		return ToolResult{Content: fmt.Sprintf("Error: %s", err)}, nil
 	}
@@ -87,6 +92,7 @@ func (t *ReadFileTool) Execute(_ context.Context, params map[string]any) (ToolRe
 // WriteFileTool writes content to a file.
 type WriteFileTool struct {
 	AllowedDir string
+	Workdir    string // base of relative paths
 }
 
 func (t *WriteFileTool) Name() string        { return "write_file" }
@@ -108,13 +114,13 @@ func (t *WriteFileTool) Parameters() map[string]any {
 	}
 }
 
-func (t *WriteFileTool) Execute(_ context.Context, params map[string]any) (ToolResult, error) {
+func (t *WriteFileTool) Execute(_ context.Context, _ ExecContext, params map[string]any) (ToolResult, error) {
 	path, err := requireStringParam(params, "path")
 	if err != nil {
 		return ToolResult{}, err
 	}
 	content := getStringParam(params, "content")
-	resolved, err := resolvePath(path, t.AllowedDir)
+	resolved, err := resolvePath(path, t.Workdir, t.AllowedDir)
 	if err != nil {
 		return ToolResult{Content: fmt.Sprintf("Error: %s", err)}, nil
 	}
@@ -130,6 +136,7 @@ func (t *WriteFileTool) Execute(_ context.Context, params map[string]any) (ToolR
 // EditFileTool edits a file by replacing text.
 type EditFileTool struct {
 	AllowedDir string
+	Workdir    string // base of relative paths
 }
 
 func (t *EditFileTool) Name() string { return "edit_file" }
@@ -157,7 +164,7 @@ func (t *EditFileTool) Parameters() map[string]any {
 	}
 }
 
-func (t *EditFileTool) Execute(_ context.Context, params map[string]any) (ToolResult, error) {
+func (t *EditFileTool) Execute(_ context.Context, _ ExecContext, params map[string]any) (ToolResult, error) {
 	path, err := requireStringParam(params, "path")
 	if err != nil {
 		return ToolResult{}, err
@@ -168,7 +175,7 @@ func (t *EditFileTool) Execute(_ context.Context, params map[string]any) (ToolRe
 	}
 	newText := getStringParam(params, "new_text")
 
-	resolved, err := resolvePath(path, t.AllowedDir)
+	resolved, err := resolvePath(path, t.Workdir, t.AllowedDir)
 	if err != nil {
 		return ToolResult{Content: fmt.Sprintf("Error: %s", err)}, nil
 	}
@@ -194,6 +201,7 @@ func (t *EditFileTool) Execute(_ context.Context, params map[string]any) (ToolRe
 // ListDirTool lists directory contents.
 type ListDirTool struct {
 	AllowedDir string
+	Workdir    string // base of relative paths
 }
 
 func (t *ListDirTool) Name() string        { return "list_dir" }
@@ -211,12 +219,12 @@ func (t *ListDirTool) Parameters() map[string]any {
 	}
 }
 
-func (t *ListDirTool) Execute(_ context.Context, params map[string]any) (ToolResult, error) {
+func (t *ListDirTool) Execute(_ context.Context, _ ExecContext, params map[string]any) (ToolResult, error) {
 	path, err := requireStringParam(params, "path")
 	if err != nil {
 		return ToolResult{}, err
 	}
-	resolved, err := resolvePath(path, t.AllowedDir)
+	resolved, err := resolvePath(path, t.Workdir, t.AllowedDir)
 	if err != nil {
 		return ToolResult{Content: fmt.Sprintf("Error: %s", err)}, nil
 	}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"testing/fstest"
 )
@@ -43,7 +44,7 @@ func TestReadFileTool_EmbedFSFallback(t *testing.T) {
 
 	ctx := context.Background()
 
-	result, err := tool.Execute(ctx, map[string]any{"path": "builtin_skills/weather/SKILL.md"})
+	result, err := tool.Execute(ctx, ExecContext{}, map[string]any{"path": "builtin_skills/weather/SKILL.md"})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -51,7 +52,7 @@ func TestReadFileTool_EmbedFSFallback(t *testing.T) {
 		t.Errorf("Test 1 (direct path): got %q", result.Content)
 	}
 
-	result, err = tool.Execute(ctx, map[string]any{"path": "/Users/joe/.nagobot/workspace/builtin_skills/weather/SKILL.md"})
+	result, err = tool.Execute(ctx, ExecContext{}, map[string]any{"path": "/Users/joe/.nagobot/workspace/builtin_skills/weather/SKILL.md"})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -59,7 +60,7 @@ func TestReadFileTool_EmbedFSFallback(t *testing.T) {
 		t.Errorf("Test 2 (prefixed path): got %q", result.Content)
 	}
 
-	result, err = tool.Execute(ctx, map[string]any{"path": "/nonexistent/file.txt"})
+	result, err = tool.Execute(ctx, ExecContext{}, map[string]any{"path": "/nonexistent/file.txt"})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -84,7 +85,7 @@ func TestReadFileTool_EmbedWithRestrictToWorkspace(t *testing.T) {
 
 	ctx := context.Background()
 
-	result, err := tool.Execute(ctx, map[string]any{"path": "builtin_skills/weather/SKILL.md"})
+	result, err := tool.Execute(ctx, ExecContext{}, map[string]any{"path": "builtin_skills/weather/SKILL.md"})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -92,7 +93,7 @@ func TestReadFileTool_EmbedWithRestrictToWorkspace(t *testing.T) {
 		t.Errorf("embed with RestrictToWorkspace: got %q", result.Content)
 	}
 
-	result, err = tool.Execute(ctx, map[string]any{"path": filepath.Join(tmpDir, "builtin_skills/weather/SKILL.md")})
+	result, err = tool.Execute(ctx, ExecContext{}, map[string]any{"path": filepath.Join(tmpDir, "builtin_skills/weather/SKILL.md")})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -102,7 +103,7 @@ func TestReadFileTool_EmbedWithRestrictToWorkspace(t *testing.T) {
 
 	testFile := filepath.Join(tmpDir, "test.txt")
 	os.WriteFile(testFile, []byte("hello"), 0644)
-	result, err = tool.Execute(ctx, map[string]any{"path": testFile})
+	result, err = tool.Execute(ctx, ExecContext{}, map[string]any{"path": testFile})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -110,3 +111,28 @@ func TestReadFileTool_EmbedWithRestrictToWorkspace(t *testing.T) {
 		t.Errorf("regular file: got %q", result.Content)
 	}
 }
+
+func TestFileToolsResolveAgainstWorkdir(t *testing.T) {
+	workspace := t.TempDir()
+	workdir := filepath.Join(workspace, "repo")
+	os.Mkdir(workdir, 0755)
+	ctx := context.Background()
+
+	write := &WriteFileTool{AllowedDir: workspace, Workdir: workdir}
+	if _, err := write.Execute(ctx, ExecContext{}, map[string]any{"path": "notes.txt", "content": "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(workdir, "notes.txt")); err != nil || string(data) != "hi" {
+		t.Fatalf("notes.txt in workdir = %q, %v", data, err)
+	}
+
+	read := &ReadFileTool{AllowedDir: workspace, Workdir: workdir}
+	result, err := read.Execute(ctx, ExecContext{}, map[string]any{"path": "notes.txt"})
+	if err != nil || result.Content != "hi" {
+		t.Errorf("read = %q, %v", result.Content, err)
+	}
+	result, _ = read.Execute(ctx, ExecContext{}, map[string]any{"path": "../../outside.txt"})
+	if !strings.Contains(result.Content, "outside allowed directory") {
+		t.Errorf("escape from workspace: %q", result.Content)
+	}
+}
@@ -0,0 +1,29 @@
+package tool
+
+import "context"
+
+// BeforeFunc runs before a tool call. It may modify params in place; an
+// error vetoes the call and is reported to the model instead of a result.
+type BeforeFunc func(ctx context.Context, ec ExecContext, name string, params map[string]any) error
+
+// AfterFunc runs after a tool call. It may modify result; an error
+// withholds the result from the model.
+type AfterFunc func(ctx context.Context, ec ExecContext, name string, params map[string]any, result *ToolResult) error
+
+// Hooks holds the functions run around tool calls, in the order they were
+// added. Several registries may share one Hooks. Add hooks before tools
+// run: adding is not safe while calls are in flight.
+type Hooks struct {
+	before []BeforeFunc
+	after  []AfterFunc
+}
+
+// Before adds a hook run before every tool call.
+func (h *Hooks) Before(fn BeforeFunc) {
+	h.before = append(h.before, fn)
+}
+
+// After adds a hook run after every tool call that was not vetoed.
+func (h *Hooks) After(fn AfterFunc) {
+	h.after = append(h.after, fn)
+}
@@ -10,9 +10,7 @@ import (
 
 // MessageTool sends messages to users on chat channels.
 type MessageTool struct {
-	sendFunc       func(msg *bus.OutboundMessage)
-	defaultChannel string
-	defaultChatID  string
+	sendFunc func(msg *bus.OutboundMessage)
 }
 
 // NewMessageTool creates a new message tool.
@@ -20,12 +18,6 @@ func NewMessageTool(sendFunc func(msg *bus.OutboundMessage)) *MessageTool {
 	return &MessageTool{sendFunc: sendFunc}
 }
 
-// SetContext sets the current channel/chat context for this tool.
-func (t *MessageTool) SetContext(channel, chatID string) {
-	t.defaultChannel = channel
-	t.defaultChatID = chatID
-}
-
 func (t *MessageTool) Name() string        { return "message" }
 func (t *MessageTool) Description() string {
 	return "Send a message to the user. Supports file attachments via the files parameter."
@@ -56,7 +48,7 @@ func (t *MessageTool) Parameters() map[string]any {
 	}
 }
 
-func (t *MessageTool) Execute(_ context.Context, params map[string]any) (ToolResult, error) {
+func (t *MessageTool) Execute(_ context.Context, ec ExecContext, params map[string]any) (ToolResult, error) {
 	content, err := requireStringParam(params, "content")
 	if err != nil {
 		return ToolResult{}, err
@@ -64,10 +56,10 @@ func (t *MessageTool) Execute(_ context.Context, params map[string]any) (ToolRes
 	channel := getStringParam(params, "channel")
 	chatID := getStringParam(params, "chat_id")
 	if channel == "" {
-		channel = t.defaultChannel
+		channel = ec.Channel
 	}
 	if chatID == "" {
-		chatID = t.defaultChatID
+		chatID = ec.ChatID
 	}
 	if channel == "" || chatID == "" {
 		return ToolResult{Content: "Error: No target channel/chat specified"}, nil
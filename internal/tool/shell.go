@@ -66,7 +66,7 @@ func (t *ShellTool) Parameters() map[string]any {
 	}
 }
 
-func (t *ShellTool) Execute(ctx context.Context, params map[string]any) (ToolResult, error) {
+func (t *ShellTool) Execute(ctx context.Context, ec ExecContext, params map[string]any) (ToolResult, error) {
 	command, err := requireStringParam(params, "command")
 	if err != nil {
 		return ToolResult{}, err
@@ -75,6 +75,9 @@ func (t *ShellTool) Execute(ctx context.Context, params map[string]any) (ToolRes
 	if cwd == "" {
 		cwd = t.WorkingDir
 	}
+	if cwd == "" {
+		cwd = ec.Workspace
+	}
 
 	if msg := t.guardCommand(command, cwd); msg != "" {
 		return ToolResult{Content: msg}, nil
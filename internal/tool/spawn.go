@@ -2,27 +2,39 @@ package tool
 
 import (
 	"context"
+	"fmt"
+	"time"
 )
 
+// SpawnRequest is a subagent the model asked for. Zero fields take the
+// configured defaults.
+type SpawnRequest struct {
+	Task    string
+	Label   string
+	Channel string // origin chat the result is announced to
+	ChatID  string
+
+	Profile       string // tool profile
+	Model         string // model role
+	MaxIterations int
+	Timeout       time.Duration
+	Workdir       string // working directory, relative to the workspace
+}
+
 // SpawnFunc is the function signature for spawning a subagent.
-type SpawnFunc func(ctx context.Context, task, label, channel, chatID string) string
+type SpawnFunc func(ctx context.Context, req SpawnRequest) (string, error)
 
 // SpawnTool spawns a subagent to handle a task in the background.
 type SpawnTool struct {
-	spawnFunc      SpawnFunc
-	defaultChannel string
-	defaultChatID  string
-}
-
-// NewSpawnTool creates a new spawn tool.
-func NewSpawnTool(spawnFunc SpawnFunc) *SpawnTool {
-	return &SpawnTool{spawnFunc: spawnFunc}
+	spawnFunc SpawnFunc
+	profiles  []string
+	models    []string
 }
 
-// SetContext sets the origin channel/chat for subagent announcements.
-func (t *SpawnTool) SetContext(channel, chatID string) {
-	t.defaultChannel = channel
-	t.defaultChatID = chatID
+// NewSpawnTool creates a new spawn tool offering the given tool profiles
+// and model roles.
+func NewSpawnTool(spawnFunc SpawnFunc, profiles, models []string) *SpawnTool {
+	return &SpawnTool{spawnFunc: spawnFunc, profiles: profiles, models: models}
 }
 
 func (t *SpawnTool) Name() string { return "spawn" }
@@ -33,31 +45,198 @@ func (t *SpawnTool) Description() string {
 }
 
 func (t *SpawnTool) Parameters() map[string]any {
+	profile := map[string]any{
+		"type":        "string",
+		"description": "Tool profile of the subagent, e.g. research for web access or coder for shell commands (default: default)",
+	}
+	if len(t.profiles) > 0 {
+		profile["enum"] = t.profiles
+	}
+	properties := map[string]any{
+		"task": map[string]any{
+			"type":        "string",
+			"description": "The task for the subagent to complete",
+		},
+		"label": map[string]any{
+			"type":        "string",
+			"description": "Optional short label for the task (for display)",
+		},
+		"profile": profile,
+		"max_iterations": map[string]any{
+			"type":        "integer",
+			"description": "Optional limit on the subagent's steps; capped by the configured maximum",
+		},
+		"timeout_seconds": map[string]any{
+			"type":        "integer",
+			"description": "Optional limit on the subagent's run time; capped by the configured maximum",
+		},
+		"workdir": map[string]any{
+			"type":        "string",
+			"description": "Optional working directory for the subagent, relative to the workspace; its commands run there and relative file paths resolve against it",
+		},
+	}
+	if len(t.models) > 0 {
+		properties["model"] = map[string]any{
+			"type":        "string",
+			"enum":        t.models,
+			"description": "Optional model for the subagent",
+		}
+	}
 	return map[string]any{
-		"type": "object",
-		"properties": map[string]any{
-			"task": map[string]any{
-				"type":        "string",
-				"description": "The task for the subagent to complete",
-			},
-			"label": map[string]any{
-				"type":        "string",
-				"description": "Optional short label for the task (for display)",
+		"type":       "object",
+		"properties": properties,
+		"required":   []string{"task"},
+	}
+}
+
+func (t *SpawnTool) Execute(ctx context.Context, ec ExecContext, params map[string]any) (ToolResult, error) {
+	task, err := requireStringParam(params, "task")
+	if err != nil {
+		return ToolResult{}, err
+	}
+
+	// Subagents announce their result to the session that spawned them.
+	channel, chatID := ec.Channel, ec.ChatID
+	if channel == "" {
+		channel = "cli"
+	}
+	if chatID == "" {
+		chatID = "direct"
+	}
+
+	result, err := t.spawnFunc(ctx, SpawnRequest{
+		Task:          task,
+		Label:         getStringParam(params, "label"),
+		Channel:       channel,
+		ChatID:        chatID,
+		Profile:       getStringParam(params, "profile"),
+		Model:         getStringParam(params, "model"),
+		MaxIterations: getIntParam(params, "max_iterations"),
+		Timeout:       time.Duration(getIntParam(params, "timeout_seconds")) * time.Second,
+		Workdir:       getStringParam(params, "workdir"),
+	})
+	if err != nil {
+		return ToolResult{Content: "Error: " + err.Error()}, nil
+	}
+	return ToolResult{Content: result}, nil
+}
+
+// SpawnGroupRequest is a group of subagents working toward a shared goal.
+// Each member's Channel and ChatID are those of the group.
+type SpawnGroupRequest struct {
+	Goal    string
+	Label   string
+	Channel string // origin chat the combined result is announced to
+	ChatID  string
+	Timeout time.Duration // deadline of the whole group; 0 takes the configured one
+	Members []SpawnRequest
+}
+
+// SpawnGroupFunc is the function signature for spawning a subagent group.
+type SpawnGroupFunc func(ctx context.Context, req SpawnGroupRequest) (string, error)
+
+// SpawnGroupTool spawns subagents that work in parallel and report back
+// together.
+type SpawnGroupTool struct {
+	spawnFunc SpawnGroupFunc
+	profiles  []string
+	models    []string
+}
+
+// NewSpawnGroupTool creates a new spawn_group tool offering the given tool
+// profiles and model roles.
+func NewSpawnGroupTool(spawnFunc SpawnGroupFunc, profiles, models []string) *SpawnGroupTool {
+	return &SpawnGroupTool{spawnFunc: spawnFunc, profiles: profiles, models: models}
+}
+
+func (t *SpawnGroupTool) Name() string { return "spawn_group" }
+func (t *SpawnGroupTool) Description() string {
+	return "Spawn several subagents in parallel toward a shared goal, e.g. researching different sources or " +
+		"changing different files. Their results are reported back together once all have finished or " +
+		"the time limit has passed, with the status of each."
+}
+
+func (t *SpawnGroupTool) Parameters() map[string]any {
+	member := map[string]any{
+		"task": map[string]any{
+			"type":        "string",
+			"description": "The part of the goal this subagent completes",
+		},
+		"label": map[string]any{
+			"type":        "string",
+			"description": "Optional short label (for display)",
+		},
+		"profile": map[string]any{
+			"type":        "string",
+			"description": "Optional tool profile overriding the group's",
+		},
+	}
+	profile := map[string]any{
+		"type":        "string",
+		"description": "Tool profile of the subagents (default: default)",
+	}
+	if len(t.profiles) > 0 {
+		profile["enum"] = t.profiles
+		member["profile"].(map[string]any)["enum"] = t.profiles
+	}
+	properties := map[string]any{
+		"goal": map[string]any{
+			"type":        "string",
+			"description": "The shared goal, given to every subagent as context",
+		},
+		"label": map[string]any{
+			"type":        "string",
+			"description": "Optional short label for the group (for display)",
+		},
+		"tasks": map[string]any{
+			"type":        "array",
+			"description": "One entry per subagent",
+			"items": map[string]any{
+				"type":       "object",
+				"properties": member,
+				"required":   []string{"task"},
 			},
 		},
-		"required": []string{"task"},
+		"profile": profile,
+		"max_iterations": map[string]any{
+			"type":        "integer",
+			"description": "Optional limit on each subagent's steps; capped by the configured maximum",
+		},
+		"timeout_seconds": map[string]any{
+			"type":        "integer",
+			"description": "Optional deadline for the whole group, counted from now; subagents still running then are stopped and reported as timed out. Capped by, and defaulting to, the configured group deadline",
+		},
+		"workdir": map[string]any{
+			"type":        "string",
+			"description": "Optional working directory for the subagents, relative to the workspace; their commands run there and relative file paths resolve against it",
+		},
+	}
+	if len(t.models) > 0 {
+		properties["model"] = map[string]any{
+			"type":        "string",
+			"enum":        t.models,
+			"description": "Optional model for the subagents",
+		}
+	}
+	return map[string]any{
+		"type":       "object",
+		"properties": properties,
+		"required":   []string{"goal", "tasks"},
 	}
 }
 
-func (t *SpawnTool) Execute(ctx context.Context, params map[string]any) (ToolResult, error) {
-	task, err := requireStringParam(params, "task")
+func (t *SpawnGroupTool) Execute(ctx context.Context, ec ExecContext, params map[string]any) (ToolResult, error) {
+	goal, err := requireStringParam(params, "goal")
 	if err != nil {
 		return ToolResult{}, err
 	}
-	label := getStringParam(params, "label")
+	items, _ := params["tasks"].([]any)
+	if len(items) == 0 {
+		return ToolResult{}, fmt.Errorf("tasks must list at least one task")
+	}
 
-	channel := t.defaultChannel
-	chatID := t.defaultChatID
+	// Like spawn, the group reports to the session that spawned it.
+	channel, chatID := ec.Channel, ec.ChatID
 	if channel == "" {
 		channel = "cli"
 	}
@@ -65,6 +244,38 @@ func (t *SpawnTool) Execute(ctx context.Context, params map[string]any) (ToolRes
 		chatID = "direct"
 	}
 
-	result := t.spawnFunc(ctx, task, label, channel, chatID)
+	req := SpawnGroupRequest{
+		Goal:    goal,
+		Label:   getStringParam(params, "label"),
+		Channel: channel,
+		ChatID:  chatID,
+		Timeout: time.Duration(getIntParam(params, "timeout_seconds")) * time.Second,
+	}
+	for i, item := range items {
+		m, _ := item.(map[string]any)
+		task := getStringParam(m, "task")
+		if task == "" {
+			return ToolResult{}, fmt.Errorf("tasks[%d].task is required", i)
+		}
+		profile := getStringParam(m, "profile")
+		if profile == "" {
+			profile = getStringParam(params, "profile")
+		}
+		req.Members = append(req.Members, SpawnRequest{
+			Task:          task,
+			Label:         getStringParam(m, "label"),
+			Channel:       channel,
+			ChatID:        chatID,
+			Profile:       profile,
+			Model:         getStringParam(params, "model"),
+			MaxIterations: getIntParam(params, "max_iterations"),
+			Workdir:       getStringParam(params, "workdir"),
+		})
+	}
+
+	result, err := t.spawnFunc(ctx, req)
+	if err != nil {
+		return ToolResult{Content: "Error: " + err.Error()}, nil
+	}
 	return ToolResult{Content: result}, nil
 }
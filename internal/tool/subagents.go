@@ -0,0 +1,103 @@
+package tool
+
+import (
+	"context"
+	"fmt"
+)
+
+// SubagentControl reaches the running subagents spawned from a chat,
+// identified as "channel:chatID".
+type SubagentControl interface {
+	List(chat string) string
+	Transcript(chat, id string) (string, error)
+	Cancel(chat, id string) error
+	Send(chat, id, message string) error
+}
+
+// SubagentsTool lets the agent list, inspect, cancel and message the
+// subagents it spawned.
+type SubagentsTool struct {
+	control SubagentControl
+}
+
+// NewSubagentsTool creates a new subagents tool.
+func NewSubagentsTool(control SubagentControl) *SubagentsTool {
+	return &SubagentsTool{control: control}
+}
+
+func (t *SubagentsTool) Name() string { return "subagents" }
+func (t *SubagentsTool) Description() string {
+	return "Manage the subagents spawned from this chat. Actions: list (running subagents with their age, " +
+		"iterations and last tool), transcript (what a subagent has done so far), cancel (stop one, or " +
+		"every member of a group by its group ID; the partial result is reported back), message (send it further instructions)."
+}
+
+func (t *SubagentsTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"action": map[string]any{
+				"type":        "string",
+				"enum":        []string{"list", "transcript", "cancel", "message"},
+				"description": "Action to perform",
+			},
+			"id": map[string]any{
+				"type":        "string",
+				"description": "Subagent ID (for transcript, cancel and message), or group ID (for cancel)",
+			},
+			"message": map[string]any{
+				"type":        "string",
+				"description": "Instructions to pass to the subagent (for message)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *SubagentsTool) Execute(_ context.Context, ec ExecContext, params map[string]any) (ToolResult, error) {
+	action, err := requireStringParam(params, "action")
+	if err != nil {
+		return ToolResult{}, err
+	}
+	// Subagents belong to the chat that spawned them; see SpawnTool.
+	channel, chatID := ec.Channel, ec.ChatID
+	if channel == "" {
+		channel = "cli"
+	}
+	if chatID == "" {
+		chatID = "direct"
+	}
+	chat := channel + ":" + chatID
+	if action == "list" {
+		return ToolResult{Content: t.control.List(chat)}, nil
+	}
+
+	id, err := requireStringParam(params, "id")
+	if err != nil {
+		return ToolResult{}, err
+	}
+	switch action {
+	case "transcript":
+		transcript, err := t.control.Transcript(chat, id)
+		if err != nil {
+			return ToolResult{Content: fmt.Sprintf("Error: %s", err)}, nil
+		}
+		return ToolResult{Content: transcript}, nil
+	case "cancel":
+		if err := t.control.Cancel(chat, id); err != nil {
+			return ToolResult{Content: fmt.Sprintf("Error: %s", err)}, nil
+		}
+		return ToolResult{Content: fmt.Sprintf("Subagent %s cancelled. Its partial result will be reported back.", id)}, nil
+	case "message":
+		message, err := requireStringParam(params, "message")
+		if err != nil {
+			return ToolResult{}, err
+		}
+		if err := t.control.Send(chat, id, message); err != nil {
+			return ToolResult{Content: fmt.Sprintf("Error: %s", err)}, nil
+		}
+		return ToolResult{Content: fmt.Sprintf("Message passed to subagent %s; it reads it before its next step.", id)}, nil
+	default:
+		return ToolResult{Content: fmt.Sprintf("Unknown action: %s", action)}, nil
+	}
+}
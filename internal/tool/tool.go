@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"path"
 	"strings"
+
+	"github.com/joebot/nagobot/internal/bus"
 )
 
 // ToolResult holds the output of a tool execution.
@@ -18,24 +21,89 @@ type Tool interface {
 	Name() string
 	Description() string
 	Parameters() map[string]any // JSON Schema
-	Execute(ctx context.Context, params map[string]any) (ToolResult, error)
+	// Execute runs the call. ctx is cancelled when the turn is
+	// interrupted or the app stops.
+	Execute(ctx context.Context, ec ExecContext, params map[string]any) (ToolResult, error)
+}
+
+// ExecContext describes the turn a tool invocation belongs to. Tools read
+// the origin from here rather than keeping per-turn state, so a single
+// Registry can serve concurrent turns. The zero value describes a call made
+// outside any conversation, such as the CLI listing cron jobs.
+type ExecContext struct {
+	Channel    string // channel the turn came from (e.g. "discord", "cli")
+	ChatID     string
+	SenderID   string
+	SessionKey string // key of the session the turn runs in
+	Workspace  string
+
+	Approve bus.ApproveFunc // asks the sender to confirm gated calls; nil declines them
 }
 
 // Registry manages tool registration and execution.
 type Registry struct {
-	tools map[string]Tool
+	tools     map[string]Tool
+	allowed   []string        // name patterns; empty allows every tool
+	approvals *ApprovalPolicy // gates dangerous calls; nil runs everything
+	hooks     *Hooks
 }
 
 // NewRegistry creates a new tool registry.
 func NewRegistry() *Registry {
-	return &Registry{tools: make(map[string]Tool)}
+	return &Registry{tools: make(map[string]Tool), hooks: &Hooks{}}
 }
 
-// Register adds a tool to the registry.
+// Register adds a tool to the registry. Tools not allowed by Restrict are
+// ignored.
 func (r *Registry) Register(t Tool) {
+	if !r.isAllowed(t.Name()) {
+		slog.Debug("Tool disabled", "tool", t.Name())
+		return
+	}
 	r.tools[t.Name()] = t
 }
 
+// Restrict limits the registry to tools matching the given names or
+// path.Match patterns (e.g. "mcp__github__*"). Registered tools that do not
+// match are removed, and later ones are ignored. No patterns allows all.
+func (r *Registry) Restrict(patterns []string) {
+	r.allowed = patterns
+	for name := range r.tools {
+		if !r.isAllowed(name) {
+			delete(r.tools, name)
+		}
+	}
+}
+
+// SetApprovals makes calls matching the policy wait for the user's
+// confirmation before they run.
+func (r *Registry) SetApprovals(p *ApprovalPolicy) {
+	r.approvals = p
+}
+
+// Hooks returns the hooks run around this registry's tool calls.
+func (r *Registry) Hooks() *Hooks {
+	return r.hooks
+}
+
+// SetHooks makes the registry run h around its tool calls, sharing it with
+// the registries h came from.
+func (r *Registry) SetHooks(h *Hooks) {
+	r.hooks = h
+}
+
+func (r *Registry) isAllowed(name string) bool {
+	if len(r.allowed) == 0 {
+		return true
+	}
+	for _, p := range r.allowed {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
 // Get returns a tool by name, or nil if not found.
 func (r *Registry) Get(name string) Tool {
 	return r.tools[name]
@@ -57,15 +125,43 @@ func (r *Registry) Definitions() []map[string]any {
 	return defs
 }
 
-// Execute runs a tool by name with the given parameters.
+// Execute runs a tool by name with the given parameters, passing the call
+// through the registry's hooks.
 // Errors are returned as strings (error isolation — lets LLM decide recovery).
-func (r *Registry) Execute(ctx context.Context, name string, params map[string]any) ToolResult {
+func (r *Registry) Execute(ctx context.Context, ec ExecContext, name string, params map[string]any) ToolResult {
 	t := r.tools[name]
 	if t == nil {
 		return ToolResult{Content: fmt.Sprintf("Error: Tool '%s' not found", name)}
 	}
+	if params == nil {
+		params = make(map[string]any) // hooks may add arguments
+	}
+	for _, fn := range r.hooks.before {
+		if err := fn(ctx, ec, name, params); err != nil {
+			slog.Info("Tool call blocked by hook", "tool", name, "err", err)
+			return ToolResult{Content: fmt.Sprintf("Error: %s was blocked: %s. The call was not run.", name, err)}
+		}
+	}
+
+	result := r.execute(ctx, ec, t, name, params)
+	for _, fn := range r.hooks.after {
+		if err := fn(ctx, ec, name, params, &result); err != nil {
+			slog.Info("Tool result withheld by hook", "tool", name, "err", err)
+			return ToolResult{Content: fmt.Sprintf("Error: the result of %s was withheld: %s", name, err)}
+		}
+	}
+	return result
+}
+
+// execute runs t once the call has passed the before hooks.
+func (r *Registry) execute(ctx context.Context, ec ExecContext, t Tool, name string, params map[string]any) ToolResult {
+	if rule, ok := r.approvals.Match(name, params); ok {
+		if declined := r.approvals.confirm(ctx, ec, rule, name, params); declined != "" {
+			return ToolResult{Content: declined}
+		}
+	}
 
-	result, err := t.Execute(ctx, params)
+	result, err := t.Execute(ctx, ec, params)
 	if err != nil {
 		slog.Error("tool execution error", "tool", name, "err", err)
 		return ToolResult{Content: fmt.Sprintf("Error executing %s: %s", name, err)}
@@ -49,7 +49,7 @@ func (t *WebSearchTool) Parameters() map[string]any {
 	}
 }
 
-func (t *WebSearchTool) Execute(ctx context.Context, params map[string]any) (ToolResult, error) {
+func (t *WebSearchTool) Execute(ctx context.Context, ec ExecContext, params map[string]any) (ToolResult, error) {
 	query, err := requireStringParam(params, "query")
 	if err != nil {
 		return ToolResult{}, err
@@ -157,7 +157,7 @@ func (t *WebFetchTool) Parameters() map[string]any {
 	}
 }
 
-func (t *WebFetchTool) Execute(ctx context.Context, params map[string]any) (ToolResult, error) {
+func (t *WebFetchTool) Execute(ctx context.Context, ec ExecContext, params map[string]any) (ToolResult, error) {
 	rawURL, err := requireStringParam(params, "url")
 	if err != nil {
 		return ToolResult{}, err
@@ -0,0 +1,261 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits caps what may be spent. Zero fields are unlimited.
+type Limits struct {
+	Tokens    int
+	Cost      float64       // USD
+	Time      time.Duration // wall-clock time of turns
+	ToolCalls int
+	Tools     map[string]int // calls of individual tools
+}
+
+// Spend is what was used against Limits.
+type Spend struct {
+	Tokens    int            `json:"tokens,omitempty"`
+	Cost      float64        `json:"cost,omitempty"`
+	Time      time.Duration  `json:"time,omitempty"`
+	ToolCalls int            `json:"tool_calls,omitempty"`
+	Tools     map[string]int `json:"tools,omitempty"`
+}
+
+// Add folds o into s.
+func (s *Spend) Add(o Spend) {
+	s.Tokens += o.Tokens
+	s.Cost += o.Cost
+	s.Time += o.Time
+	s.ToolCalls += o.ToolCalls
+	if len(o.Tools) > 0 {
+		tools := make(map[string]int, len(s.Tools)+len(o.Tools))
+		maps.Copy(tools, s.Tools) // s may share its map with a copy
+		for name, n := range o.Tools {
+			tools[name] += n
+		}
+		s.Tools = tools
+	}
+}
+
+// measure is one limited quantity of a budget.
+type measure struct {
+	name        string
+	used, limit float64
+	format      func(float64) string
+	tool        bool // a count of tool calls
+}
+
+func (m measure) String() string {
+	return fmt.Sprintf("%s %s/%s", m.name, m.format(m.used), m.format(m.limit))
+}
+
+func (l Limits) measures(s Spend) []measure {
+	count := func(v float64) string { return fmt.Sprintf("%.0f", v) }
+	var ms []measure
+	if l.Tokens > 0 {
+		ms = append(ms, measure{"tokens", float64(s.Tokens), float64(l.Tokens), func(v float64) string { return FormatTokens(int(v)) }, false})
+	}
+	if l.Cost > 0 {
+		ms = append(ms, measure{"cost", s.Cost, l.Cost, func(v float64) string { return fmt.Sprintf("$%.2f", v) }, false})
+	}
+	if l.Time > 0 {
+		ms = append(ms, measure{"time", float64(s.Time), float64(l.Time), func(v float64) string { return time.Duration(v).Round(time.Second).String() }, false})
+	}
+	if l.ToolCalls > 0 {
+		ms = append(ms, measure{"tool calls", float64(s.ToolCalls), float64(l.ToolCalls), count, true})
+	}
+	for _, name := range slices.Sorted(maps.Keys(l.Tools)) {
+		if limit := l.Tools[name]; limit > 0 {
+			ms = append(ms, measure{name + " calls", float64(s.Tools[name]), float64(limit), count, true})
+		}
+	}
+	return ms
+}
+
+// Exceeded describes the first token, cost or time limit s has used up,
+// e.g. "tokens 200.0k/200.0k", or returns "". Tool call limits only
+// refuse further calls; see ToolExceeded.
+func (l Limits) Exceeded(s Spend) string {
+	for _, m := range l.measures(s) {
+		if !m.tool && m.used >= m.limit {
+			return m.String()
+		}
+	}
+	return ""
+}
+
+// ToolExceeded describes the limit that another call of the named tool
+// would go over, or returns "".
+func (l Limits) ToolExceeded(s Spend, tool string) string {
+	if l.ToolCalls > 0 && s.ToolCalls >= l.ToolCalls {
+		return fmt.Sprintf("tool calls %d/%d", s.ToolCalls, l.ToolCalls)
+	}
+	if limit := l.Tools[tool]; limit > 0 && s.Tools[tool] >= limit {
+		return fmt.Sprintf("%s calls %d/%d", tool, s.Tools[tool], limit)
+	}
+	return ""
+}
+
+// Near describes the limit s has used the largest share of, if that share
+// is at least fraction but the limit is not used up, e.g.
+// "tokens 85% (170.0k/200.0k)". Otherwise it returns "".
+func (l Limits) Near(s Spend, fraction float64) string {
+	var near measure
+	best := fraction
+	for _, m := range l.measures(s) {
+		if r := m.used / m.limit; r >= best && r < 1 {
+			near, best = m, r
+		}
+	}
+	if near.name == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s %.0f%% (%s/%s)", near.name, best*100, near.format(near.used), near.format(near.limit))
+}
+
+// Remaining describes what is left of each limit, e.g.
+// "tokens 30.0k of 200.0k left, exec calls 2 of 10 left", or returns "" if
+// l limits nothing.
+func (l Limits) Remaining(s Spend) string {
+	var parts []string
+	for _, m := range l.measures(s) {
+		parts = append(parts, fmt.Sprintf("%s %s of %s left", m.name, m.format(max(m.limit-m.used, 0)), m.format(m.limit)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Counter sums the spend of the LLM calls made with a context returned by
+// WithCounter. It is safe for concurrent use.
+type Counter struct {
+	mu    sync.Mutex
+	spend Spend
+}
+
+// Add adds s to the counter.
+func (c *Counter) Add(s Spend) {
+	c.mu.Lock()
+	c.spend.Add(s)
+	c.mu.Unlock()
+}
+
+// Spend returns the total so far.
+func (c *Counter) Spend() Spend {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.spend
+}
+
+type counterKey struct{}
+
+// WithCounter returns a context whose metered LLM calls add their tokens
+// and cost to c.
+func WithCounter(ctx context.Context, c *Counter) context.Context {
+	return context.WithValue(ctx, counterKey{}, c)
+}
+
+func counterFrom(ctx context.Context) *Counter {
+	c, _ := ctx.Value(counterKey{}).(*Counter)
+	return c
+}
+
+// Tracker keeps today's spend of each session and channel in a JSON file,
+// so that daily budgets survive restarts. It starts over at local midnight.
+// It is safe for concurrent use.
+type Tracker struct {
+	path string
+	mu   sync.Mutex
+	data trackerData
+}
+
+type trackerData struct {
+	Day      string           `json:"day"`
+	Sessions map[string]Spend `json:"sessions"`
+	Channels map[string]Spend `json:"channels"`
+}
+
+// NewTracker creates a tracker saved to path, loading today's spend from
+// it. An empty path keeps the spend in memory only.
+func NewTracker(path string) *Tracker {
+	t := &Tracker{path: path}
+	if path != "" {
+		if data, err := os.ReadFile(path); err == nil {
+			if err := json.Unmarshal(data, &t.data); err != nil {
+				slog.Warn("Ignoring unreadable budget tracker", "path", path, "err", err)
+				t.data = trackerData{}
+			}
+		}
+	}
+	return t
+}
+
+// rollover clears the spend of earlier days. The caller holds t.mu.
+func (t *Tracker) rollover() {
+	if today := time.Now().Format("2006-01-02"); t.data.Day != today {
+		t.data = trackerData{Day: today}
+	}
+	if t.data.Sessions == nil {
+		t.data.Sessions = make(map[string]Spend)
+	}
+	if t.data.Channels == nil {
+		t.data.Channels = make(map[string]Spend)
+	}
+}
+
+// Add records s as spent today by session and channel; empty keys are
+// skipped.
+func (t *Tracker) Add(session, channel string, s Spend) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollover()
+	if session != "" {
+		spend := t.data.Sessions[session]
+		spend.Add(s)
+		t.data.Sessions[session] = spend
+	}
+	if channel != "" {
+		spend := t.data.Channels[channel]
+		spend.Add(s)
+		t.data.Channels[channel] = spend
+	}
+	t.save()
+}
+
+// Today returns what session and channel have spent today.
+func (t *Tracker) Today(session, channel string) (sessionSpend, channelSpend Spend) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollover()
+	return t.data.Sessions[session], t.data.Channels[channel]
+}
+
+// save writes the tracker file. The caller holds t.mu. Write failures are
+// logged rather than returned so accounting never breaks a conversation.
+func (t *Tracker) save() {
+	if t.path == "" {
+		return
+	}
+	data, err := json.Marshal(t.data)
+	if err != nil {
+		return
+	}
+	os.MkdirAll(filepath.Dir(t.path), 0o755)
+	// Write then rename, so a crash never leaves a torn file.
+	err = os.WriteFile(t.path+".tmp", data, 0o644)
+	if err == nil {
+		err = os.Rename(t.path+".tmp", t.path)
+	}
+	if err != nil {
+		slog.Error("Budget tracker write failed", "path", t.path, "err", err)
+	}
+}
@@ -0,0 +1,51 @@
+package usage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLimits(t *testing.T) {
+	l := Limits{Tokens: 1000, Time: time.Minute, Tools: map[string]int{"exec": 2}}
+	s := Spend{Tokens: 850, Time: 10 * time.Second, ToolCalls: 5, Tools: map[string]int{"exec": 1}}
+
+	if r := l.Exceeded(s); r != "" {
+		t.Errorf("Exceeded = %q, want none", r)
+	}
+	if r := l.Near(s, 0.8); r != "tokens 85% (850/1.0k)" {
+		t.Errorf("Near = %q", r)
+	}
+	if r := l.ToolExceeded(s, "exec"); r != "" {
+		t.Errorf("ToolExceeded = %q, want none", r)
+	}
+	s.Add(Spend{Tokens: 200, Tools: map[string]int{"exec": 1}})
+	if r := l.Exceeded(s); r != "tokens 1.1k/1.0k" {
+		t.Errorf("Exceeded = %q", r)
+	}
+	if r := l.ToolExceeded(s, "exec"); r != "exec calls 2/2" {
+		t.Errorf("ToolExceeded = %q", r)
+	}
+	if r := l.Remaining(s); r != "tokens 0 of 1.0k left, time 50s of 1m0s left, exec calls 0 of 2 left" {
+		t.Errorf("Remaining = %q", r)
+	}
+	if r := (Limits{}).Remaining(s); r != "" {
+		t.Errorf("no limits: Remaining = %q", r)
+	}
+}
+
+func TestTrackerPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "budgets.json")
+	tr := NewTracker(path)
+	tr.Add("cli:direct", "cli", Spend{Tokens: 100, Cost: 0.5})
+	tr.Add("cli:direct", "cli", Spend{ToolCalls: 1, Tools: map[string]int{"exec": 1}})
+	tr.Add("discord:1", "discord", Spend{Tokens: 7})
+
+	sess, ch := NewTracker(path).Today("cli:direct", "cli")
+	if sess.Tokens != 100 || sess.Cost != 0.5 || sess.Tools["exec"] != 1 || ch.ToolCalls != 1 {
+		t.Errorf("reloaded spend = %+v, channel %+v", sess, ch)
+	}
+	if _, ch := tr.Today("", "discord"); ch.Tokens != 7 {
+		t.Errorf("discord spend = %+v", ch)
+	}
+}
@@ -0,0 +1,185 @@
+// Package usage records the token usage of every LLM call in an append-only
+// ledger and summarizes it by period, model and purpose.
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Purposes tag why an LLM call was made.
+const (
+	PurposeChat      = "chat"      // a user turn
+	PurposeCompress  = "compress"  // in-loop context compression
+	PurposeMemory    = "memory"    // memory consolidation
+	PurposeSubagent  = "subagent"  // a background subagent or its announcement
+	PurposeCron      = "cron"      // a scheduled cron job
+	PurposeHeartbeat = "heartbeat" // a heartbeat tick
+)
+
+// Record is one LLM call in the ledger.
+type Record struct {
+	Time             time.Time `json:"time"`
+	Session          string    `json:"session,omitempty"`
+	Channel          string    `json:"channel,omitempty"`
+	Model            string    `json:"model"`
+	Purpose          string    `json:"purpose"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	TotalTokens      int       `json:"total_tokens"`
+	CacheReadTokens  int       `json:"cache_read_tokens,omitempty"`  // part of PromptTokens
+	CacheWriteTokens int       `json:"cache_write_tokens,omitempty"` // part of PromptTokens
+	Cost             float64   `json:"cost,omitempty"`               // USD, 0 when the model has no price
+}
+
+// Price is the cost of a model in USD per million tokens. Zero cache
+// prices fall back to the input price.
+type Price struct {
+	Input      float64
+	Output     float64
+	CacheRead  float64
+	CacheWrite float64
+}
+
+// Ledger appends usage records to a JSONL file. It is safe for concurrent use.
+type Ledger struct {
+	path    string
+	prices  map[string]Price
+	tracker *Tracker
+	mu      sync.Mutex
+}
+
+// NewLedger creates a ledger writing to path. prices maps model names to
+// their price; see Cost for how models are matched.
+func NewLedger(path string, prices map[string]Price) *Ledger {
+	return &Ledger{path: path, prices: prices}
+}
+
+// Path returns the ledger file path.
+func (l *Ledger) Path() string {
+	return l.path
+}
+
+// Track makes the ledger add the tokens and cost of every record to t.
+func (l *Ledger) Track(t *Tracker) {
+	l.tracker = t
+}
+
+// Add stamps and prices r, then appends it to the ledger and its tracker. Write failures are
+// logged rather than returned so accounting never breaks a conversation.
+func (l *Ledger) Add(r Record) {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	if r.TotalTokens == 0 {
+		r.TotalTokens = r.PromptTokens + r.CompletionTokens
+	}
+	r.Cost = l.Cost(r)
+	if l.tracker != nil {
+		l.tracker.Add(r.Session, r.Channel, Spend{Tokens: r.TotalTokens, Cost: r.Cost})
+	}
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	os.MkdirAll(filepath.Dir(l.path), 0o755)
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		slog.Error("Usage ledger open failed", "path", l.path, "err", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		slog.Error("Usage ledger write failed", "path", l.path, "err", err)
+	}
+}
+
+// Cost returns the USD cost of r, or 0 if its model has no price.
+// Models are matched exactly first, then without a "provider/" prefix, then
+// by the longest price key the model name starts with, so a price for
+// "claude-sonnet-4-5" also covers "anthropic/claude-sonnet-4-5-20250929".
+func (l *Ledger) Cost(r Record) float64 {
+	p, ok := l.price(r.Model)
+	if !ok {
+		return 0
+	}
+	cacheRead, cacheWrite := p.CacheRead, p.CacheWrite
+	if cacheRead == 0 {
+		cacheRead = p.Input
+	}
+	if cacheWrite == 0 {
+		cacheWrite = p.Input
+	}
+	uncached := r.PromptTokens - r.CacheReadTokens - r.CacheWriteTokens
+	return (float64(uncached)*p.Input +
+		float64(r.CacheReadTokens)*cacheRead +
+		float64(r.CacheWriteTokens)*cacheWrite +
+		float64(r.CompletionTokens)*p.Output) / 1e6
+}
+
+func (l *Ledger) price(model string) (Price, bool) {
+	if p, ok := l.prices[model]; ok {
+		return p, true
+	}
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+		if p, ok := l.prices[model]; ok {
+			return p, true
+		}
+	}
+	best := ""
+	for key := range l.prices {
+		if strings.HasPrefix(model, key) && len(key) > len(best) {
+			best = key
+		}
+	}
+	if best == "" {
+		return Price{}, false
+	}
+	return l.prices[best], true
+}
+
+// Load returns the records made at or after since, oldest first.
+// A missing ledger yields no records; malformed lines are skipped.
+func (l *Ledger) Load(since time.Time) ([]Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("open usage ledger: %w", err)
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		if r.Time.Before(since) {
+			continue
+		}
+		records = append(records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return records, fmt.Errorf("read usage ledger: %w", err)
+	}
+	return records, nil
+}
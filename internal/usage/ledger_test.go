@@ -0,0 +1,126 @@
+package usage
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/joebot/nagobot/internal/llm"
+)
+
+func TestLedgerCostMatching(t *testing.T) {
+	l := NewLedger("", map[string]Price{
+		"claude-sonnet-4-5": {Input: 3, Output: 15},
+		"claude":            {Input: 1, Output: 1},
+		"openai/gpt-4o":     {Input: 2.5, Output: 10},
+	})
+	tests := []struct {
+		model string
+		want  float64
+	}{
+		{"claude-sonnet-4-5", 18},
+		{"anthropic/claude-sonnet-4-5-20250929", 18}, // prefix stripped, longest key wins
+		{"claude-haiku-4-5", 2},
+		{"openai/gpt-4o", 12.5},
+		{"deepseek-chat", 0},
+	}
+	for _, tt := range tests {
+		got := l.Cost(Record{Model: tt.model, PromptTokens: 1_000_000, CompletionTokens: 1_000_000})
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Cost(%q) = %v, want %v", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestLedgerAddLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.jsonl")
+	l := NewLedger(path, map[string]Price{"m": {Input: 1, Output: 2}})
+
+	old := time.Now().Add(-48 * time.Hour)
+	l.Add(Record{Time: old, Model: "m", Purpose: PurposeChat, PromptTokens: 10, CompletionTokens: 5})
+	l.Add(Record{Model: "m", Purpose: PurposeCron, PromptTokens: 1000, CompletionTokens: 500})
+
+	all, err := l.Load(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("got %d records, want 2", len(all))
+	}
+	if all[1].TotalTokens != 1500 || math.Abs(all[1].Cost-0.002) > 1e-12 {
+		t.Errorf("record = %+v, want total 1500 and cost 0.002", all[1])
+	}
+
+	recent, _ := l.Load(time.Now().Add(-time.Hour))
+	if len(recent) != 1 || recent[0].Purpose != PurposeCron {
+		t.Errorf("Load(since) = %+v, want only the cron record", recent)
+	}
+
+	groups := GroupBy(all, func(r Record) string { return r.Purpose })
+	if len(groups) != 2 || groups[0].Key != PurposeChat || groups[1].Calls != 1 {
+		t.Errorf("GroupBy = %+v", groups)
+	}
+}
+
+func TestLedgerLoadMissing(t *testing.T) {
+	l := NewLedger(filepath.Join(t.TempDir(), "none.jsonl"), nil)
+	records, err := l.Load(time.Time{})
+	if err != nil || records != nil {
+		t.Errorf("Load = %v, %v; want nil, nil", records, err)
+	}
+}
+
+func TestPeriodStart(t *testing.T) {
+	now := time.Date(2025, 3, 12, 15, 30, 0, 0, time.Local) // a Wednesday
+	tests := []struct {
+		period string
+		n      int
+		want   time.Time
+	}{
+		{PeriodDay, 0, time.Date(2025, 3, 12, 0, 0, 0, 0, time.Local)},
+		{PeriodDay, 6, time.Date(2025, 3, 6, 0, 0, 0, 0, time.Local)},
+		{PeriodWeek, 0, time.Date(2025, 3, 10, 0, 0, 0, 0, time.Local)},
+		{PeriodWeek, 1, time.Date(2025, 3, 3, 0, 0, 0, 0, time.Local)},
+		{PeriodMonth, 3, time.Date(2024, 12, 1, 0, 0, 0, 0, time.Local)},
+	}
+	for _, tt := range tests {
+		if got := PeriodStart(tt.period, now, tt.n); !got.Equal(tt.want) {
+			t.Errorf("PeriodStart(%s, %d) = %v, want %v", tt.period, tt.n, got, tt.want)
+		}
+	}
+}
+
+type stubProvider struct{}
+
+func (stubProvider) Chat(context.Context, llm.ChatRequest) (*llm.ChatResponse, error) {
+	return &llm.ChatResponse{Usage: map[string]int{"prompt_tokens": 7, "completion_tokens": 3, "total_tokens": 10}}, nil
+}
+
+func (p stubProvider) ChatStream(ctx context.Context, req llm.ChatRequest, _ llm.StreamHandler) (*llm.ChatResponse, error) {
+	return p.Chat(ctx, req)
+}
+
+func (stubProvider) DefaultModel() string { return "stub-model" }
+
+func TestMeterRecordsTags(t *testing.T) {
+	l := NewLedger(filepath.Join(t.TempDir(), "usage.jsonl"), nil)
+	p := Meter(stubProvider{}, l)
+
+	ctx := WithSession(context.Background(), "discord:42", "discord")
+	p.Chat(ctx, llm.ChatRequest{})
+	p.Chat(WithPurpose(ctx, PurposeCompress), llm.ChatRequest{Model: "other"})
+
+	records, _ := l.Load(time.Time{})
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	r := records[0]
+	if r.Session != "discord:42" || r.Channel != "discord" || r.Purpose != PurposeChat || r.Model != "stub-model" || r.TotalTokens != 10 {
+		t.Errorf("first record = %+v", r)
+	}
+	if r := records[1]; r.Purpose != PurposeCompress || r.Model != "other" {
+		t.Errorf("second record = %+v", r)
+	}
+}
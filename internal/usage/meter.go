@@ -0,0 +1,101 @@
+package usage
+
+import (
+	"context"
+
+	"github.com/joebot/nagobot/internal/llm"
+)
+
+// Tags attribute an LLM call to a session, channel and purpose.
+type Tags struct {
+	Session string
+	Channel string
+	Purpose string
+}
+
+type tagsKey struct{}
+
+// TagsFrom returns the usage tags carried by ctx.
+func TagsFrom(ctx context.Context) Tags {
+	t, _ := ctx.Value(tagsKey{}).(Tags)
+	return t
+}
+
+// WithSession returns a context whose LLM calls are attributed to the given
+// session and channel.
+func WithSession(ctx context.Context, session, channel string) context.Context {
+	t := TagsFrom(ctx)
+	t.Session, t.Channel = session, channel
+	return context.WithValue(ctx, tagsKey{}, t)
+}
+
+// WithPurpose returns a context whose LLM calls are tagged with purpose.
+func WithPurpose(ctx context.Context, purpose string) context.Context {
+	t := TagsFrom(ctx)
+	t.Purpose = purpose
+	return context.WithValue(ctx, tagsKey{}, t)
+}
+
+// meteredProvider records every successful call of the wrapped provider.
+type meteredProvider struct {
+	llm.Provider
+	ledger *Ledger
+}
+
+// Meter wraps p so that the usage of every successful call is added to
+// ledger, tagged from the call's context, and to the context's Counter.
+// Calls without a purpose are recorded as PurposeChat.
+func Meter(p llm.Provider, ledger *Ledger) llm.Provider {
+	if ledger == nil {
+		return p
+	}
+	return &meteredProvider{Provider: p, ledger: ledger}
+}
+
+func (m *meteredProvider) Chat(ctx context.Context, req llm.ChatRequest) (*llm.ChatResponse, error) {
+	resp, err := m.Provider.Chat(ctx, req)
+	if err == nil {
+		m.record(ctx, req, resp)
+	}
+	return resp, err
+}
+
+func (m *meteredProvider) ChatStream(ctx context.Context, req llm.ChatRequest, onEvent llm.StreamHandler) (*llm.ChatResponse, error) {
+	resp, err := m.Provider.ChatStream(ctx, req, onEvent)
+	if err == nil {
+		m.record(ctx, req, resp)
+	}
+	return resp, err
+}
+
+func (m *meteredProvider) record(ctx context.Context, req llm.ChatRequest, resp *llm.ChatResponse) {
+	t := TagsFrom(ctx)
+	if t.Purpose == "" {
+		t.Purpose = PurposeChat
+	}
+	model := resp.Model
+	if model == "" {
+		model = req.Model
+	}
+	if model == "" {
+		model = m.DefaultModel()
+	}
+	rec := Record{
+		Session:          t.Session,
+		Channel:          t.Channel,
+		Model:            model,
+		Purpose:          t.Purpose,
+		PromptTokens:     resp.Usage["prompt_tokens"],
+		CompletionTokens: resp.Usage["completion_tokens"],
+		TotalTokens:      resp.Usage["total_tokens"],
+		CacheReadTokens:  resp.Usage["cache_read_tokens"],
+		CacheWriteTokens: resp.Usage["cache_write_tokens"],
+	}
+	m.ledger.Add(rec)
+	if c := counterFrom(ctx); c != nil {
+		if rec.TotalTokens == 0 {
+			rec.TotalTokens = rec.PromptTokens + rec.CompletionTokens
+		}
+		c.Add(Spend{Tokens: rec.TotalTokens, Cost: m.ledger.Cost(rec)})
+	}
+}
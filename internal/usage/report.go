@@ -0,0 +1,125 @@
+package usage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Totals aggregates a set of records.
+type Totals struct {
+	Calls            int
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+	CacheReadTokens  int
+	Cost             float64
+}
+
+// Add folds r into t.
+func (t *Totals) Add(r Record) {
+	t.Calls++
+	t.PromptTokens += r.PromptTokens
+	t.CompletionTokens += r.CompletionTokens
+	t.TotalTokens += r.TotalTokens
+	t.CacheReadTokens += r.CacheReadTokens
+	t.Cost += r.Cost
+}
+
+// Sum returns the totals of records matching keep (all records if keep is nil).
+func Sum(records []Record, keep func(Record) bool) Totals {
+	var t Totals
+	for _, r := range records {
+		if keep == nil || keep(r) {
+			t.Add(r)
+		}
+	}
+	return t
+}
+
+// Group is the totals for one key of a breakdown.
+type Group struct {
+	Key string
+	Totals
+}
+
+// GroupBy aggregates records by key, sorted by key.
+func GroupBy(records []Record, key func(Record) string) []Group {
+	index := make(map[string]*Group)
+	for _, r := range records {
+		k := key(r)
+		g, ok := index[k]
+		if !ok {
+			g = &Group{Key: k}
+			index[k] = g
+		}
+		g.Add(r)
+	}
+	groups := make([]Group, 0, len(index))
+	for _, g := range index {
+		groups = append(groups, *g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Key < groups[j].Key })
+	return groups
+}
+
+// Breakdown periods.
+const (
+	PeriodDay   = "day"
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+)
+
+// PeriodKey returns a function labelling records by the local calendar day
+// (2006-01-02), ISO week (2006-W01) or month (2006-01) they fall in.
+func PeriodKey(period string) (func(Record) string, error) {
+	switch period {
+	case PeriodDay:
+		return func(r Record) string { return r.Time.Local().Format("2006-01-02") }, nil
+	case PeriodWeek:
+		return func(r Record) string {
+			y, w := r.Time.Local().ISOWeek()
+			return fmt.Sprintf("%d-W%02d", y, w)
+		}, nil
+	case PeriodMonth:
+		return func(r Record) string { return r.Time.Local().Format("2006-01") }, nil
+	}
+	return nil, fmt.Errorf("unknown period %q (want day, week or month)", period)
+}
+
+// PeriodStart returns the start of the n-th period before the one containing
+// now, so PeriodStart(PeriodDay, now, 0) is today's midnight.
+func PeriodStart(period string, now time.Time, n int) time.Time {
+	now = now.Local()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch period {
+	case PeriodWeek:
+		offset := (int(day.Weekday()) + 6) % 7 // days since Monday
+		return day.AddDate(0, 0, -offset-7*n)
+	case PeriodMonth:
+		return time.Date(now.Year(), now.Month()-time.Month(n), 1, 0, 0, 0, 0, now.Location())
+	}
+	return day.AddDate(0, 0, -n)
+}
+
+// String renders t on one line, e.g.
+// "12 calls · 34.5k in (30.1k cached) / 2.1k out · $0.1234".
+func (t Totals) String() string {
+	in := FormatTokens(t.PromptTokens)
+	if t.CacheReadTokens > 0 {
+		in += fmt.Sprintf(" (%s cached)", FormatTokens(t.CacheReadTokens))
+	}
+	return fmt.Sprintf("%d calls · %s in / %s out · $%.4f",
+		t.Calls, in, FormatTokens(t.CompletionTokens), t.Cost)
+}
+
+// FormatTokens renders a token count compactly: 950, 12.3k, 4.1M.
+func FormatTokens(n int) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1e6)
+	case n >= 1_000:
+		return fmt.Sprintf("%.1fk", float64(n)/1e3)
+	}
+	return fmt.Sprintf("%d", n)
+}